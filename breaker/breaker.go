@@ -13,6 +13,9 @@
 //
 // OPEN: The system decorated with this breaker is assumed to be unavailable
 // and the dependents thereof should not use it at this time.
+//
+// HALF-OPEN: The system decorated with this breaker is being probed by a
+// limited number of calls to determine whether it is available again.
 package breaker
 
 import (
@@ -21,21 +24,26 @@ import (
 	"time"
 )
 
-type state int
+// State is the state of a circuit.
+type State int
 
 const (
-	closed state = iota
-	open
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
 )
 
-func (s state) String() string {
+func (s State) String() string {
 	switch s {
-	case open:
+	case StateOpen:
 		return "OPEN"
 
-	case closed:
+	case StateClosed:
 		return "CLOSED"
 
+	case StateHalfOpen:
+		return "HALF-OPEN"
+
 	default:
 		return "InvalidState"
 	}
@@ -72,7 +80,7 @@ type Consecutive struct {
 
 	mutex sync.RWMutex
 
-	state    state
+	state    State
 	failures uint
 
 	nextClose       time.Time
@@ -108,7 +116,7 @@ func (b *Consecutive) Fail() {
 
 	b.failures++
 
-	if b.state == open {
+	if b.state == StateOpen {
 		return
 	}
 
@@ -118,7 +126,7 @@ func (b *Consecutive) Fail() {
 
 	if b.failures > b.FailureAllowance {
 		b.nextClose = b.instantProvider.Now().Add(b.RetryTimeout)
-		b.state = open
+		b.state = StateOpen
 	}
 }
 
@@ -132,7 +140,7 @@ func (b *Consecutive) Succeed() {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
-	if b.state == open {
+	if b.state == StateOpen {
 		b.reset()
 	}
 }
@@ -143,14 +151,14 @@ func (b *Consecutive) Open() bool {
 		return false
 	}
 
-    b.mutex.Lock()
+	b.mutex.Lock()
 
 	if b.instantProvider == nil {
 		b.instantProvider = systemTimer
 	}
 
 	switch {
-	case b.state == closed:
+	case b.state == StateClosed:
 		b.mutex.Unlock()
 		return false
 	case b.nextClose.Before(b.instantProvider.Now()):
@@ -181,5 +189,5 @@ func (b *Consecutive) Reset() {
 
 func (b *Consecutive) reset() {
 	b.failures = 0
-	b.state = closed
+	b.state = StateClosed
 }
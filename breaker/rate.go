@@ -0,0 +1,308 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOpen = errors.New("breaker: circuit open")
+)
+
+const (
+	defaultBuckets        = 10
+	defaultHalfOpenProbes = 1
+)
+
+type rateBucket struct {
+	epoch     int64
+	successes uint
+	failures  uint
+}
+
+// RateBreaker provides a circuit breaker that opens once the ratio of failures
+// over a rolling time window reaches a threshold.  After RetryTimeout the
+// circuit becomes HALF-OPEN and lets a limited number of probe calls through:
+// the circuit closes once all of them succeed and opens again on the first
+// failure.  Its initial state is CLOSED.
+//
+// It is concurrency safe.
+type RateBreaker struct {
+	// Window is the rolling period over which the failure ratio is computed.
+	Window time.Duration
+
+	// Buckets is the number of buckets Window is divided into; the window
+	// rolls forward one bucket at a time.  Defaults to 10.
+	Buckets int
+
+	// FailureRatio is the ratio of failures, in (0, 1], at which the
+	// circuit will open.
+	FailureRatio float64
+
+	// MinRequests is the minimum number of calls within Window before the
+	// failure ratio is taken into account.
+	MinRequests uint
+
+	// RetryTimeout is added to the time when the circuit opens to determine
+	// when it becomes HALF-OPEN.
+	RetryTimeout time.Duration
+
+	// HalfOpenProbes is the maximum number of calls allowed while HALF-OPEN.
+	// Defaults to 1.
+	HalfOpenProbes uint
+
+	// OnStateChange, if not nil, is called on every state transition.
+	// It is called without holding any lock, so it may call back into the
+	// breaker.
+	OnStateChange func(from, to State)
+
+	mutex sync.Mutex
+
+	state          State
+	buckets        []rateBucket
+	probes         uint
+	probeSuccesses uint
+	transitions    [][2]State
+
+	nextHalfOpen    time.Time
+	instantProvider instantProvider
+}
+
+func (b *RateBreaker) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	successes, failures := b.counts(b.now())
+	return fmt.Sprintf("Rate Breaker %s with %.2f Ratio over %s Window and %d Successes and %d Failures",
+		b.state, b.FailureRatio, b.Window, successes, failures)
+}
+
+// State returns the current state of the circuit.
+func (b *RateBreaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+func (b *RateBreaker) enabled() bool {
+	return b.FailureRatio > 0 && b.Window > 0
+}
+
+func (b *RateBreaker) now() time.Time {
+	if b.instantProvider == nil {
+		b.instantProvider = systemTimer
+	}
+
+	return b.instantProvider.Now()
+}
+
+func (b *RateBreaker) halfOpenProbes() uint {
+	if b.HalfOpenProbes == 0 {
+		return defaultHalfOpenProbes
+	}
+
+	return b.HalfOpenProbes
+}
+
+// Fail marks the decorated subsystem as having an operation fail and may
+// trigger its subsequent circuit opening.
+func (b *RateBreaker) Fail() {
+	if !b.enabled() {
+		return
+	}
+
+	b.mutex.Lock()
+	now := b.now()
+
+	switch b.state {
+	case StateClosed:
+		b.record(now, false)
+		successes, failures := b.counts(now)
+		total := successes + failures
+		if total >= b.MinRequests && float64(failures) >= b.FailureRatio*float64(total) {
+			b.trip(now)
+		}
+
+	case StateHalfOpen:
+		b.trip(now)
+	}
+
+	b.unlockAndNotify()
+}
+
+// Succeed marks the decorated subsystem as having an operation succeed and,
+// once enough probes succeed, closes the circuit if it's presently HALF-OPEN.
+func (b *RateBreaker) Succeed() {
+	if !b.enabled() {
+		return
+	}
+
+	b.mutex.Lock()
+
+	switch b.state {
+	case StateClosed:
+		b.record(b.now(), true)
+
+	case StateHalfOpen:
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.halfOpenProbes() {
+			b.reset()
+		}
+	}
+
+	b.unlockAndNotify()
+}
+
+// Open indicates whether the circuit for this subsystem is presently open.
+//
+// While HALF-OPEN every false return admits one probe call, so the caller
+// must report its outcome through Succeed or Fail.
+func (b *RateBreaker) Open() bool {
+	if !b.enabled() {
+		return false
+	}
+
+	b.mutex.Lock()
+
+	if b.state == StateOpen && !b.now().Before(b.nextHalfOpen) {
+		b.probes = 0
+		b.probeSuccesses = 0
+		b.setState(StateHalfOpen)
+	}
+
+	var open bool
+	switch b.state {
+	case StateOpen:
+		open = true
+
+	case StateHalfOpen:
+		if b.probes < b.halfOpenProbes() {
+			b.probes++
+		} else {
+			open = true
+		}
+	}
+
+	b.unlockAndNotify()
+	return open
+}
+
+// Execute runs fn unless the circuit is open, in which case ErrOpen is
+// returned, and records its outcome: a non-nil error or a panic counts as a
+// failure.
+func (b *RateBreaker) Execute(fn func() error) (err error) {
+	if b.Open() {
+		return ErrOpen
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			b.Fail()
+			panic(e)
+		}
+
+		if err != nil {
+			b.Fail()
+		} else {
+			b.Succeed()
+		}
+	}()
+
+	return fn()
+}
+
+// Reset returns this circuit back to its default state: closed, and
+// forgets all the calls recorded in the window.
+func (b *RateBreaker) Reset() {
+	if !b.enabled() {
+		return
+	}
+
+	b.mutex.Lock()
+	b.reset()
+	b.unlockAndNotify()
+}
+
+func (b *RateBreaker) reset() {
+	b.buckets = nil
+	b.setState(StateClosed)
+}
+
+func (b *RateBreaker) trip(now time.Time) {
+	b.nextHalfOpen = now.Add(b.RetryTimeout)
+	b.setState(StateOpen)
+}
+
+func (b *RateBreaker) setState(to State) {
+	if b.state == to {
+		return
+	}
+
+	if b.OnStateChange != nil {
+		b.transitions = append(b.transitions, [2]State{b.state, to})
+	}
+	b.state = to
+}
+
+// unlockAndNotify releases the mutex and then fires the pending state
+// change callbacks.
+func (b *RateBreaker) unlockAndNotify() {
+	transitions := b.transitions
+	b.transitions = nil
+	b.mutex.Unlock()
+
+	for _, t := range transitions {
+		b.OnStateChange(t[0], t[1])
+	}
+}
+
+func (b *RateBreaker) bucketSize() int64 {
+	n := b.Buckets
+	if n <= 0 {
+		n = defaultBuckets
+	}
+
+	size := int64(b.Window) / int64(n)
+	if size <= 0 {
+		size = 1
+	}
+	return size
+}
+
+func (b *RateBreaker) record(now time.Time, success bool) {
+	if b.buckets == nil {
+		n := b.Buckets
+		if n <= 0 {
+			n = defaultBuckets
+		}
+		b.buckets = make([]rateBucket, n)
+	}
+
+	epoch := now.UnixNano() / b.bucketSize()
+	bucket := &b.buckets[epoch%int64(len(b.buckets))]
+	if bucket.epoch != epoch {
+		*bucket = rateBucket{epoch: epoch}
+	}
+
+	if success {
+		bucket.successes++
+	} else {
+		bucket.failures++
+	}
+}
+
+// counts sums up the calls recorded in the buckets within the window.
+func (b *RateBreaker) counts(now time.Time) (successes, failures uint) {
+	epoch := now.UnixNano() / b.bucketSize()
+	for _, bucket := range b.buckets {
+		if bucket.epoch > epoch-int64(len(b.buckets)) {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+
+	return
+}
@@ -0,0 +1,158 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeInstantProvider struct {
+	now time.Time
+}
+
+func (i *fakeInstantProvider) Now() time.Time {
+	return i.now
+}
+
+func newTestRateBreaker() (*RateBreaker, *fakeInstantProvider) {
+	clock := &fakeInstantProvider{now: time.Unix(1000, 0)}
+	return &RateBreaker{
+		Window:          10 * time.Second,
+		FailureRatio:    0.5,
+		MinRequests:     4,
+		RetryTimeout:    time.Minute,
+		HalfOpenProbes:  2,
+		instantProvider: clock,
+	}, clock
+}
+
+func TestRateBreakerLifecycle(t *testing.T) {
+	rate := RateBreaker{}
+	rate.Fail()
+	if rate.Open() {
+		t.Fatal("expected false, got true")
+	}
+
+	rate.Reset()
+	if rate.Open() {
+		t.Fatal("expected false, got true")
+	}
+}
+
+func TestRateBreakerTrip(t *testing.T) {
+	b, _ := newTestRateBreaker()
+
+	// under MinRequests
+	b.Fail()
+	b.Fail()
+	b.Fail()
+	if b.Open() {
+		t.Fatal("expected closed under min requests")
+	}
+
+	b.Succeed()
+	b.Succeed()
+	b.Succeed()
+	b.Succeed()
+	if b.Open() {
+		t.Fatal("expected closed under failure ratio")
+	}
+
+	b.Fail()
+	if !b.Open() {
+		t.Fatalf("expected open, got %s", b)
+	}
+}
+
+func TestRateBreakerWindowSlides(t *testing.T) {
+	b, clock := newTestRateBreaker()
+
+	b.Fail()
+	b.Fail()
+	b.Fail()
+
+	clock.now = clock.now.Add(11 * time.Second)
+	b.Fail()
+	b.Succeed()
+	b.Succeed()
+	b.Succeed()
+	if b.Open() {
+		t.Fatal("expected old failures to slide out of window")
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("expected CLOSED, got %s", b.State())
+	}
+}
+
+func TestRateBreakerHalfOpen(t *testing.T) {
+	b, clock := newTestRateBreaker()
+
+	var transitions []State
+	b.OnStateChange = func(from, to State) {
+		transitions = append(transitions, to)
+	}
+
+	for i := 0; i < 4; i++ {
+		b.Fail()
+	}
+	if !b.Open() {
+		t.Fatal("expected open")
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	// two probes allowed
+	if b.Open() || b.Open() {
+		t.Fatal("expected probes to be allowed")
+	}
+	if !b.Open() {
+		t.Fatal("expected third call to be rejected while half open")
+	}
+
+	// a failed probe reopens the circuit
+	b.Fail()
+	if !b.Open() {
+		t.Fatal("expected open after failed probe")
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	b.Open()
+	b.Open()
+	b.Succeed()
+	if b.State() != StateHalfOpen {
+		t.Fatalf("expected HALF-OPEN, got %s", b.State())
+	}
+	b.Succeed()
+	if b.Open() {
+		t.Fatal("expected closed after successful probes")
+	}
+
+	expected := []State{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}
+	if len(transitions) != len(expected) {
+		t.Fatalf("expected transitions %v, got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Fatalf("expected transitions %v, got %v", expected, transitions)
+		}
+	}
+}
+
+func TestRateBreakerExecute(t *testing.T) {
+	b, _ := newTestRateBreaker()
+	errFoo := errors.New("foo")
+
+	for i := 0; i < 4; i++ {
+		if err := b.Execute(func() error { return errFoo }); err != errFoo {
+			t.Fatalf("expected %v, got %v", errFoo, err)
+		}
+	}
+
+	called := false
+	err := b.Execute(func() error {
+		called = true
+		return nil
+	})
+	if err != ErrOpen || called {
+		t.Fatalf("expected %v without calling, got %v", ErrOpen, err)
+	}
+}
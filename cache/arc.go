@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+type arcList int
+
+const (
+	arcT1 arcList = iota // recent entries
+	arcT2                // frequent entries
+	arcB1                // ghosts evicted from t1
+	arcB2                // ghosts evicted from t2
+)
+
+type arcEntry struct {
+	key   Key
+	value interface{}
+	where arcList
+}
+
+// goroutine safe ARC(Adaptive Replacement Cache) implementation.
+//
+// It balances between recency and frequency by tracking the keys recently
+// evicted from both sides, which makes it resistant to one-off scans.
+//
+// See https://www.usenix.org/legacy/events/fast03/tech/full_papers/megiddo/megiddo.pdf
+type ArcCache struct {
+	lock sync.Mutex
+
+	maxItems int
+	p        int // target size of t1
+
+	stats *lruCacheStat
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	lists [4]*list.List
+	items map[interface{}]*list.Element
+}
+
+// NewArcCache creates a new ArcCache, maxItems must be positive.
+func NewArcCache(maxItems int) *ArcCache {
+	if maxItems < 1 {
+		panic("cache: maxItems must be positive")
+	}
+
+	c := &ArcCache{
+		maxItems: maxItems,
+		stats:    &lruCacheStat{},
+	}
+	c.reset()
+	return c
+}
+
+func (c *ArcCache) reset() {
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	c.items = make(map[interface{}]*list.Element)
+	c.p = 0
+}
+
+func (c *ArcCache) Purge() {
+	c.lock.Lock()
+	c.reset()
+	c.lock.Unlock()
+}
+
+// Set adds a value to the cache.
+// If key already exists, its value gets overwritten.
+func (c *ArcCache) Set(key Key, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.set(key, value, true)
+}
+
+// Add will return true and set the key to cache if key not existent, else return false.
+func (c *ArcCache) Add(key Key, value interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.set(key, value, false)
+}
+
+// Get looks up a key's value from the cache.
+func (c *ArcCache) Get(key Key) (value interface{}, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if item, hit := c.items[key]; hit {
+		e := item.Value.(*arcEntry)
+		if e.where == arcT1 || e.where == arcT2 {
+			atomic.AddUint64(&c.stats.hits, 1)
+			c.move(item, arcT2)
+			return e.value, true
+		}
+	}
+
+	atomic.AddUint64(&c.stats.misses, 1)
+	return
+}
+
+func (c *ArcCache) Del(key Key) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	item, hit := c.items[key]
+	if !hit {
+		return
+	}
+
+	e := item.Value.(*arcEntry)
+	c.lists[e.where].Remove(item)
+	delete(c.items, key)
+	if e.where == arcT1 || e.where == arcT2 {
+		c.evicted(e)
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *ArcCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lists[arcT1].Len() + c.lists[arcT2].Len()
+}
+
+// HitRatio returns the ratio of Get hits since the cache was created.
+func (c *ArcCache) HitRatio() float64 {
+	return c.stats.HitRatio()
+}
+
+func (c *ArcCache) set(key Key, value interface{}, overwrite bool) bool {
+	t1, t2, b1, b2 := c.lists[arcT1], c.lists[arcT2], c.lists[arcB1], c.lists[arcB2]
+
+	item, hit := c.items[key]
+	if !hit {
+		// a brand new key
+		if t1.Len()+b1.Len() == c.maxItems {
+			if t1.Len() < c.maxItems {
+				c.drop(b1.Back())
+				c.replace(false)
+			} else {
+				c.drop(t1.Back())
+			}
+		} else if total := t1.Len() + t2.Len() + b1.Len() + b2.Len(); total >= c.maxItems {
+			if total == 2*c.maxItems {
+				c.drop(b2.Back())
+			}
+			c.replace(false)
+		}
+
+		c.items[key] = t1.PushFront(&arcEntry{key: key, value: value, where: arcT1})
+		return true
+	}
+
+	e := item.Value.(*arcEntry)
+	switch e.where {
+	case arcT1, arcT2:
+		if !overwrite {
+			return false
+		}
+		e.value = value
+		c.move(item, arcT2)
+		return true
+
+	case arcB1:
+		// recency side was evicted too early: grow t1
+		c.p += maxInt(b2.Len()/b1.Len(), 1)
+		if c.p > c.maxItems {
+			c.p = c.maxItems
+		}
+		c.replace(false)
+
+	case arcB2:
+		// frequency side was evicted too early: shrink t1
+		c.p -= maxInt(b1.Len()/b2.Len(), 1)
+		if c.p < 0 {
+			c.p = 0
+		}
+		c.replace(true)
+	}
+
+	e.value = value
+	c.move(item, arcT2)
+	return true
+}
+
+// replace evicts an entry from t1 or t2 into its ghost list.
+func (c *ArcCache) replace(inB2 bool) {
+	t1 := c.lists[arcT1]
+	if t1.Len() > 0 && (t1.Len() > c.p || (inB2 && t1.Len() == c.p)) {
+		c.evicted(c.move(t1.Back(), arcB1))
+	} else if t2 := c.lists[arcT2]; t2.Len() > 0 {
+		c.evicted(c.move(t2.Back(), arcB2))
+	}
+}
+
+// move puts the entry in front of list l.
+func (c *ArcCache) move(item *list.Element, l arcList) *arcEntry {
+	e := item.Value.(*arcEntry)
+	c.lists[e.where].Remove(item)
+	e.where = l
+	c.items[e.key] = c.lists[l].PushFront(e)
+	return e
+}
+
+// drop forgets a ghost entry.
+func (c *ArcCache) drop(item *list.Element) {
+	if item == nil {
+		return
+	}
+
+	e := item.Value.(*arcEntry)
+	if e.where == arcT1 || e.where == arcT2 {
+		c.evicted(e)
+	}
+	c.lists[e.where].Remove(item)
+	delete(c.items, e.key)
+}
+
+func (c *ArcCache) evicted(e *arcEntry) {
+	atomic.AddUint64(&c.stats.evicts, 1)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+	e.value = nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -67,3 +67,27 @@ func BenchmarkLruCacheGetWithSameKey(b *testing.B) {
 	}
 	b.SetBytes(int64(len(key)))
 }
+
+func benchmarkZipfHitRatio(b *testing.B, c Cacheable) {
+	b.ReportAllocs()
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, 1<<20)
+	for i := 0; i < b.N; i++ {
+		key := zipf.Uint64()
+		if _, ok := c.Get(key); !ok {
+			c.Set(key, i)
+		}
+	}
+	b.ReportMetric(c.HitRatio()*100, "hit%")
+}
+
+func BenchmarkLruCacheZipfHitRatio(b *testing.B) {
+	benchmarkZipfHitRatio(b, NewLruCache(1<<10))
+}
+
+func BenchmarkTinyLfuCacheZipfHitRatio(b *testing.B) {
+	benchmarkZipfHitRatio(b, NewTinyLfuCache(1<<10))
+}
+
+func BenchmarkArcCacheZipfHitRatio(b *testing.B) {
+	benchmarkZipfHitRatio(b, NewArcCache(1<<10))
+}
@@ -9,11 +9,16 @@ type entry struct {
 	value interface{}
 }
 
+// Cacheable is implemented by all the eviction policies: LruCache,
+// TinyLfuCache and ArcCache, so that callers can swap them freely.
 type Cacheable interface {
 	Set(key Key, value interface{})
 	Get(key Key) (value interface{}, ok bool)
 	Del(key Key)
-	Add(key Key) bool
+	Add(key Key, value interface{}) bool
+	Len() int
+	Purge()
+	HitRatio() float64
 }
 
 type HasLength interface {
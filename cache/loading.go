@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/cjysmat/golib/singleflight"
+)
+
+// ErrLoaderPanic is wrapped by the error returned for a loader that
+// panicked.
+var ErrLoaderPanic = errors.New("cache: loader panicked")
+
+// LoadStats is the statistics of a LoadingCache.
+type LoadStats struct {
+	Hits          uint64
+	Misses        uint64
+	Loads         uint64
+	LoadErrors    uint64
+	Refreshes     uint64
+	TotalLoadTime time.Duration
+}
+
+// AverageLoadPenalty returns the average time spent loading an entry.
+func (s LoadStats) AverageLoadPenalty() time.Duration {
+	if s.Loads == 0 {
+		return 0
+	}
+	return s.TotalLoadTime / time.Duration(s.Loads)
+}
+
+type loadedEntry[V any] struct {
+	value      V
+	err        error
+	loadedAt   time.Time
+	refreshing int32
+}
+
+// LoadingCache is a read-through cache: on a miss it calls the loader,
+// coalescing concurrent misses of the same key into a single call.
+//
+// Entries live for ttl and, with refresh ahead enabled, are reloaded in
+// background when accessed during their last refreshAhead period, so that
+// hot keys never block on the loader.
+type LoadingCache[V any] struct {
+	lru    *LRU[string, *loadedEntry[V]]
+	group  singleflight.Group
+	loader func(key string) (V, error)
+
+	ttl          time.Duration
+	refreshAhead time.Duration
+	negativeTTL  time.Duration
+
+	loads      uint64
+	loadErrors uint64
+	loadNanos  int64
+	refreshes  uint64
+
+	now func() time.Time
+}
+
+// NewLoadingCache creates a LoadingCache of at most maxItems entries that
+// live for ttl. Zero ttl means never expire.
+func NewLoadingCache[V any](maxItems int, ttl time.Duration,
+	loader func(key string) (V, error)) *LoadingCache[V] {
+	c := &LoadingCache[V]{
+		lru:    NewLRU[string, *loadedEntry[V]](maxItems),
+		loader: loader,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+	c.lru.now = func() time.Time { return c.now() }
+	return c
+}
+
+// WithRefreshAhead enables refreshing an entry in background when it's
+// accessed less than d before expiration. It requires a non-zero ttl.
+func (c *LoadingCache[V]) WithRefreshAhead(d time.Duration) *LoadingCache[V] {
+	c.refreshAhead = d
+	return c
+}
+
+// WithNegativeTTL caches loader errors for d, so that a failing backend
+// isn't hammered. Zero means errors are not cached.
+func (c *LoadingCache[V]) WithNegativeTTL(d time.Duration) *LoadingCache[V] {
+	c.negativeTTL = d
+	return c
+}
+
+// Get returns the value of key, loading it on a miss.
+func (c *LoadingCache[V]) Get(key string) (value V, err error) {
+	if e, ok := c.lru.Get(key); ok {
+		if e.err == nil && c.shouldRefresh(e) {
+			go c.refresh(key, e)
+		}
+		return e.value, e.err
+	}
+
+	v, err := c.group.Do(key, func() (interface{}, error) {
+		return c.load(key, false)
+	})
+	if err != nil {
+		return
+	}
+	// a nil interface when V is an interface and the loader returned nil
+	value, _ = v.(V)
+	return value, nil
+}
+
+// GetIfPresent returns the value of key without loading it.
+func (c *LoadingCache[V]) GetIfPresent(key string) (value V, ok bool) {
+	e, ok := c.lru.Peek(key)
+	if !ok || e.err != nil {
+		return value, false
+	}
+	return e.value, true
+}
+
+// Set puts a value in the cache bypassing the loader.
+func (c *LoadingCache[V]) Set(key string, value V) {
+	c.lru.SetWithTTL(key, &loadedEntry[V]{value: value, loadedAt: c.now()}, c.ttl)
+}
+
+// Invalidate discards the entry of key, so the next Get loads it again.
+func (c *LoadingCache[V]) Invalidate(key string) {
+	c.lru.Del(key)
+}
+
+func (c *LoadingCache[V]) Purge() {
+	c.lru.Purge()
+}
+
+func (c *LoadingCache[V]) Len() int {
+	return c.lru.Len()
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *LoadingCache[V]) Stats() LoadStats {
+	return LoadStats{
+		Hits:          atomic.LoadUint64(&c.lru.stats.hits),
+		Misses:        atomic.LoadUint64(&c.lru.stats.misses),
+		Loads:         atomic.LoadUint64(&c.loads),
+		LoadErrors:    atomic.LoadUint64(&c.loadErrors),
+		Refreshes:     atomic.LoadUint64(&c.refreshes),
+		TotalLoadTime: time.Duration(atomic.LoadInt64(&c.loadNanos)),
+	}
+}
+
+func (c *LoadingCache[V]) shouldRefresh(e *loadedEntry[V]) bool {
+	if c.refreshAhead <= 0 || c.ttl <= 0 {
+		return false
+	}
+
+	if c.now().Before(e.loadedAt.Add(c.ttl - c.refreshAhead)) {
+		return false
+	}
+
+	return atomic.CompareAndSwapInt32(&e.refreshing, 0, 1)
+}
+
+func (c *LoadingCache[V]) refresh(key string, e *loadedEntry[V]) {
+	atomic.AddUint64(&c.refreshes, 1)
+	if _, err := c.group.Do(key, func() (interface{}, error) {
+		return c.load(key, true)
+	}); err != nil {
+		// keep serving the stale value till it expires, and let a later
+		// access retry the refresh
+		atomic.StoreInt32(&e.refreshing, 0)
+	}
+}
+
+func (c *LoadingCache[V]) load(key string, refresh bool) (interface{}, error) {
+	t0 := c.now()
+	value, err := c.callLoader(key)
+	atomic.AddInt64(&c.loadNanos, int64(c.now().Sub(t0)))
+	atomic.AddUint64(&c.loads, 1)
+
+	if err != nil {
+		atomic.AddUint64(&c.loadErrors, 1)
+		if !refresh && c.negativeTTL > 0 {
+			c.lru.SetWithTTL(key, &loadedEntry[V]{err: err, loadedAt: c.now()}, c.negativeTTL)
+		}
+		return nil, err
+	}
+
+	c.lru.SetWithTTL(key, &loadedEntry[V]{value: value, loadedAt: c.now()}, c.ttl)
+	return value, nil
+}
+
+// callLoader turns a panic of the loader into an error, otherwise the
+// waiters of the key would block forever and a refresh would crash the
+// process.
+func (c *LoadingCache[V]) callLoader(key string) (value V, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrLoaderPanic, r)
+		}
+	}()
+	return c.loader(key)
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+)
+
+func TestLoadingCacheCoalesce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	c := NewLoadingCache[int](10, time.Minute, func(key string) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return len(key), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Get("foo")
+			assert.Equal(t, nil, err)
+			assert.Equal(t, 3, v)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	v, ok := c.GetIfPresent("foo")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, uint64(1), c.Stats().Loads)
+}
+
+func TestLoadingCacheNilInterface(t *testing.T) {
+	c := NewLoadingCache[error](10, time.Minute, func(key string) (error, error) {
+		return nil, nil
+	})
+	v, err := c.Get("foo")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, v)
+}
+
+func TestLoadingCachePanic(t *testing.T) {
+	var calls int32
+	c := NewLoadingCache[int](10, time.Minute, func(key string) (int, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		return len(key), nil
+	})
+
+	_, err := c.Get("foo")
+	assert.Equal(t, true, errors.Is(err, ErrLoaderPanic))
+	// the key isn't stuck
+	v, err := c.Get("foo")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, uint64(1), c.Stats().LoadErrors)
+}
+
+func TestLoadingCacheRefreshPanic(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var calls int32
+	c := NewLoadingCache[int](10, time.Minute, func(key string) (int, error) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			panic("boom")
+		}
+		return 1, nil
+	}).WithRefreshAhead(10 * time.Second)
+	c.now = func() time.Time { return now }
+
+	c.Get("foo")
+	now = now.Add(55 * time.Second)
+	v, _ := c.Get("foo")
+	assert.Equal(t, 1, v)
+	for i := 0; i < 100 && atomic.LoadInt32(&calls) < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	// the stale value is still served
+	v, ok := c.GetIfPresent("foo")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestLoadingCacheNegative(t *testing.T) {
+	now := time.Unix(1000, 0)
+	errBackend := errors.New("backend down")
+	var calls int32
+	c := NewLoadingCache[string](10, time.Minute, func(key string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "", errBackend
+	}).WithNegativeTTL(time.Second)
+	c.now = func() time.Time { return now }
+
+	_, err := c.Get("foo")
+	assert.Equal(t, errBackend, err)
+	_, err = c.Get("foo")
+	assert.Equal(t, errBackend, err)
+	assert.Equal(t, int32(1), calls)
+
+	now = now.Add(2 * time.Second)
+	_, err = c.Get("foo")
+	assert.Equal(t, errBackend, err)
+	assert.Equal(t, int32(2), calls)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Loads)
+	assert.Equal(t, uint64(2), stats.LoadErrors)
+	assert.Equal(t, uint64(1), stats.Hits)
+}
+
+func TestLoadingCacheRefreshAhead(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(1000, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	var version int32
+	c := NewLoadingCache[int32](10, time.Minute, func(key string) (int32, error) {
+		return atomic.AddInt32(&version, 1), nil
+	}).WithRefreshAhead(10 * time.Second)
+	c.now = clock
+
+	v, _ := c.Get("foo")
+	assert.Equal(t, int32(1), v)
+
+	advance(30 * time.Second)
+	v, _ = c.Get("foo")
+	assert.Equal(t, int32(1), v)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&version))
+
+	// within the refresh ahead period: stale value, reload in background
+	advance(25 * time.Second)
+	v, _ = c.Get("foo")
+	assert.Equal(t, int32(1), v)
+
+	for i := 0; i < 100 && v == 1; i++ {
+		time.Sleep(time.Millisecond)
+		v, _ = c.GetIfPresent("foo")
+	}
+	assert.Equal(t, int32(2), v)
+	assert.Equal(t, uint64(1), c.Stats().Refreshes)
+}
@@ -12,11 +12,17 @@ type lruCacheStat struct {
 	evicts uint64
 }
 
+// HitRatio returns hits/(hits+misses), 0 if there is no lookup yet.
+func (s *lruCacheStat) HitRatio() float64 {
+	hits, misses := atomic.LoadUint64(&s.hits), atomic.LoadUint64(&s.misses)
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
 // goroutine safe LRU cache implementation.
 type LruCache struct {
-	Cacheable
-	HasLength
-
 	// not embedded because lock is transparent for caller
 	lock sync.RWMutex
 
@@ -177,6 +183,11 @@ func (c *LruCache) Len() int {
 	return c.ll.Len()
 }
 
+// HitRatio returns the ratio of Get hits since the cache was created.
+func (c *LruCache) HitRatio() float64 {
+	return c.stats.HitRatio()
+}
+
 // RemoveOldest removes the oldest item from the cache.
 func (c *LruCache) removeOldest() {
 	if c.items == nil {
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cjysmat/assert"
+)
+
+var policies = []struct {
+	name string
+	new  func(maxItems int) Cacheable
+}{
+	{"lru", func(n int) Cacheable { return NewLruCache(n) }},
+	{"tinylfu", func(n int) Cacheable { return NewTinyLfuCache(n) }},
+	{"arc", func(n int) Cacheable { return NewArcCache(n) }},
+}
+
+func TestCacheablePolicies(t *testing.T) {
+	for _, p := range policies {
+		c := p.new(100)
+		c.Set("a", 1)
+		v, ok := c.Get("a")
+		assert.Equal(t, true, ok, p.name)
+		assert.Equal(t, 1, v, p.name)
+
+		c.Set("a", 2)
+		v, _ = c.Get("a")
+		assert.Equal(t, 2, v, p.name)
+
+		assert.Equal(t, false, c.Add("a", 3), p.name)
+		assert.Equal(t, true, c.Add("b", 3), p.name)
+		assert.Equal(t, 2, c.Len(), p.name)
+
+		c.Del("a")
+		_, ok = c.Get("a")
+		assert.Equal(t, false, ok, p.name)
+		assert.Equal(t, 2.0/3, c.HitRatio(), p.name)
+
+		for i := 0; i < 1000; i++ {
+			c.Set(i, i)
+		}
+		assert.Equal(t, 100, c.Len(), p.name)
+
+		c.Purge()
+		assert.Equal(t, 0, c.Len(), p.name)
+	}
+}
+
+func TestPoliciesTinyCapacity(t *testing.T) {
+	for _, p := range policies {
+		for _, n := range []int{1, 2} {
+			c := p.new(n)
+			for i := 0; i < 10; i++ {
+				c.Set(i, i)
+				c.Get(i)
+				c.Get(i - 1)
+			}
+			assert.Equal(t, n, c.Len(), p.name)
+			v, ok := c.Get(9)
+			assert.Equal(t, true, ok, p.name)
+			assert.Equal(t, 9, v, p.name)
+		}
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	for _, p := range policies[1:] {
+		c := p.new(100)
+		for round := 0; round < 5; round++ {
+			for i := 0; i < 50; i++ {
+				key := fmt.Sprintf("hot:%d", i)
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, i)
+				}
+			}
+		}
+
+		// one-off scan
+		for i := 0; i < 1000; i++ {
+			c.Set(fmt.Sprintf("scan:%d", i), i)
+		}
+
+		hits := 0
+		for i := 0; i < 50; i++ {
+			if _, ok := c.Get(fmt.Sprintf("hot:%d", i)); ok {
+				hits++
+			}
+		}
+		if hits < 40 {
+			t.Fatalf("%s: expected hot keys to survive scan, got %d/50", p.name, hits)
+		}
+	}
+}
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch(100)
+	for i := 0; i < 5; i++ {
+		s.Increment(hashKey("foo"))
+	}
+	s.Increment(hashKey("bar"))
+
+	assert.Equal(t, uint8(5), s.Estimate(hashKey("foo")))
+	assert.Equal(t, uint8(1), s.Estimate(hashKey("bar")))
+
+	s.reset()
+	assert.Equal(t, uint8(2), s.Estimate(hashKey("foo")))
+	assert.Equal(t, uint8(0), s.Estimate(hashKey("bar")))
+}
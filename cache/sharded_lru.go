@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"time"
+
+	keyhash "github.com/cjysmat/golib/hash"
+)
+
+// ShardedLRU is a typed LRU split into shards to lower contention in high
+// load environment.
+type ShardedLRU[K comparable, V any] struct {
+	shards []*LRU[K, V]
+	hash   func(K) uint32
+}
+
+// NewShardedLRU creates a ShardedLRU of n shards whose limits are
+// maxItems and maxCost in total. Zero n means 32 shards, and there are
+// no more shards than the limits, so that each shard holds one at least.
+// If hash is nil, keys are hashed by hash.Key.
+func NewShardedLRU[K comparable, V any](n, maxItems int, maxCost int64,
+	hash func(K) uint32) *ShardedLRU[K, V] {
+	if n <= 0 {
+		n = shardN
+	}
+	if maxItems > 0 && n > maxItems {
+		n = maxItems
+	}
+	if maxCost > 0 && int64(n) > maxCost {
+		n = int(maxCost)
+	}
+	if hash == nil {
+		hash = keyhash.Key[K]
+	}
+
+	c := &ShardedLRU[K, V]{
+		shards: make([]*LRU[K, V], n),
+		hash:   hash,
+	}
+	for i := 0; i < n; i++ {
+		c.shards[i] = NewLRU[K, V](int(perShard(int64(maxItems), n, i))).
+			WithMaxCost(perShard(maxCost, n, i))
+	}
+	return c
+}
+
+// perShard returns the share of shard i of total, the shares adding up
+// to total exactly.
+func perShard(total int64, n, i int) int64 {
+	share := total / int64(n)
+	if int64(i) < total%int64(n) {
+		share++
+	}
+	return share
+}
+
+// WithTTL sets the default time to live of entries on all shards.
+func (c *ShardedLRU[K, V]) WithTTL(ttl time.Duration) *ShardedLRU[K, V] {
+	for _, lru := range c.shards {
+		lru.WithTTL(ttl)
+	}
+	return c
+}
+
+// OnEvict sets the eviction callback on all shards.
+func (c *ShardedLRU[K, V]) OnEvict(fn func(key K, value V, reason EvictReason)) {
+	for _, lru := range c.shards {
+		lru.OnEvict = fn
+	}
+}
+
+// GetShard returns the shard LRU under given key.
+func (c *ShardedLRU[K, V]) GetShard(key K) *LRU[K, V] {
+	return c.shards[uint(c.hash(key))%uint(len(c.shards))]
+}
+
+func (c *ShardedLRU[K, V]) Set(key K, value V) {
+	c.GetShard(key).Set(key, value)
+}
+
+func (c *ShardedLRU[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.GetShard(key).SetWithTTL(key, value, ttl)
+}
+
+func (c *ShardedLRU[K, V]) Add(key K, value V) bool {
+	return c.GetShard(key).Add(key, value)
+}
+
+func (c *ShardedLRU[K, V]) Get(key K) (value V, ok bool) {
+	return c.GetShard(key).Get(key)
+}
+
+func (c *ShardedLRU[K, V]) Del(key K) {
+	c.GetShard(key).Del(key)
+}
+
+func (c *ShardedLRU[K, V]) Purge() {
+	for _, lru := range c.shards {
+		lru.Purge()
+	}
+}
+
+func (c *ShardedLRU[K, V]) RemoveExpired() (n int) {
+	for _, lru := range c.shards {
+		n += lru.RemoveExpired()
+	}
+	return
+}
+
+// Keys return active keys in the cache.
+// Order is not garranteed.
+func (c *ShardedLRU[K, V]) Keys() []K {
+	keys := make([]K, 0, c.Len())
+	for _, lru := range c.shards {
+		keys = append(keys, lru.Keys()...)
+	}
+	return keys
+}
+
+func (c *ShardedLRU[K, V]) Len() (n int) {
+	for _, lru := range c.shards {
+		n += lru.Len()
+	}
+	return
+}
+
+func (c *ShardedLRU[K, V]) Cost() (n int64) {
+	for _, lru := range c.shards {
+		n += lru.Cost()
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package cache
+
+const (
+	sketchDepth    = 4
+	sketchMaxCount = 15 // 4-bit counters
+)
+
+// countMinSketch estimates the access frequency of keys in bounded space.
+//
+// Counters are halved once the number of increments reaches the sample
+// size so that the history of old popular keys fades away.
+type countMinSketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint32
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(maxItems int) *countMinSketch {
+	width := 16
+	for width < maxItems {
+		width <<= 1
+	}
+
+	s := &countMinSketch{
+		mask:       uint32(width - 1),
+		sampleSize: 10 * maxItems,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index returns the counter index of row i using double hashing.
+func (s *countMinSketch) index(h uint32, i int) uint32 {
+	h2 := h>>16 | h<<16
+	return (h + uint32(i)*h2) & s.mask
+}
+
+func (s *countMinSketch) Increment(h uint32) {
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) Estimate(h uint32) uint8 {
+	min := uint8(sketchMaxCount)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+func (s *countMinSketch) Clear() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
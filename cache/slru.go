@@ -10,6 +10,8 @@ const (
 )
 
 // Sharded LruCache to lower contention in high load environment.
+//
+// Deprecated: use ShardedLRU, which is typed and shards any comparable key.
 type SLruCache []*LruCache
 
 func NewSLruCache(maxItems int) SLruCache {
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	keyhash "github.com/cjysmat/golib/hash"
+)
+
+type segment int
+
+const (
+	windowSegment segment = iota
+	probationSegment
+	protectedSegment
+)
+
+type tinyLfuEntry struct {
+	key     Key
+	value   interface{}
+	hash    uint32
+	segment segment
+}
+
+// goroutine safe W-TinyLFU cache implementation.
+//
+// New entries land in a small LRU window; entries leaving the window are
+// admitted into the main segmented LRU only if their estimated access
+// frequency beats that of the main victim, so one-off scans can't flush
+// the popular entries out.
+//
+// See https://arxiv.org/abs/1512.00727
+type TinyLfuCache struct {
+	lock sync.Mutex
+
+	maxItems     int
+	windowCap    int
+	protectedCap int
+
+	stats  *lruCacheStat
+	sketch *countMinSketch
+
+	// OnEvicted optionally specificies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	items     map[interface{}]*list.Element
+}
+
+// NewTinyLfuCache creates a new TinyLfuCache, maxItems must be positive.
+func NewTinyLfuCache(maxItems int) *TinyLfuCache {
+	if maxItems < 1 {
+		panic("cache: maxItems must be positive")
+	}
+
+	windowCap := maxItems / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+
+	c := &TinyLfuCache{
+		maxItems:     maxItems,
+		windowCap:    windowCap,
+		protectedCap: (maxItems - windowCap) * 80 / 100,
+		stats:        &lruCacheStat{},
+		sketch:       newCountMinSketch(maxItems),
+	}
+	c.reset()
+	return c
+}
+
+func (c *TinyLfuCache) reset() {
+	c.window = list.New()
+	c.probation = list.New()
+	c.protected = list.New()
+	c.items = make(map[interface{}]*list.Element)
+}
+
+func (c *TinyLfuCache) Purge() {
+	c.lock.Lock()
+	c.reset()
+	c.sketch.Clear()
+	c.lock.Unlock()
+}
+
+// Set adds a value to the cache.
+// If key already exists, its value gets overwritten.
+func (c *TinyLfuCache) Set(key Key, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if item, ok := c.items[key]; ok {
+		item.Value.(*tinyLfuEntry).value = value
+		c.touch(item)
+		return
+	}
+
+	c.setElement(key, value)
+}
+
+// Add will return true and set the key to cache if key not existent, else return false.
+func (c *TinyLfuCache) Add(key Key, value interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.items[key]; ok {
+		return false
+	}
+
+	c.setElement(key, value)
+	return true
+}
+
+// Get looks up a key's value from the cache.
+func (c *TinyLfuCache) Get(key Key) (value interface{}, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	item, hit := c.items[key]
+	if !hit {
+		c.sketch.Increment(hashKey(key))
+		atomic.AddUint64(&c.stats.misses, 1)
+		return
+	}
+
+	atomic.AddUint64(&c.stats.hits, 1)
+	c.touch(item)
+	return item.Value.(*tinyLfuEntry).value, true
+}
+
+func (c *TinyLfuCache) Del(key Key) {
+	c.lock.Lock()
+	if item, hit := c.items[key]; hit {
+		c.removeElement(item)
+	}
+	c.lock.Unlock()
+}
+
+// Len returns the number of items in the cache.
+func (c *TinyLfuCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.items)
+}
+
+// HitRatio returns the ratio of Get hits since the cache was created.
+func (c *TinyLfuCache) HitRatio() float64 {
+	return c.stats.HitRatio()
+}
+
+func (c *TinyLfuCache) list(s segment) *list.List {
+	switch s {
+	case probationSegment:
+		return c.probation
+	case protectedSegment:
+		return c.protected
+	default:
+		return c.window
+	}
+}
+
+// touch records an access to an existing entry.
+func (c *TinyLfuCache) touch(item *list.Element) {
+	e := item.Value.(*tinyLfuEntry)
+	c.sketch.Increment(e.hash)
+
+	switch e.segment {
+	case windowSegment:
+		c.window.MoveToFront(item)
+
+	case protectedSegment:
+		c.protected.MoveToFront(item)
+
+	case probationSegment:
+		// promote, and demote the protected tail if it overflows
+		c.move(item, protectedSegment)
+		if c.protected.Len() > c.protectedCap {
+			c.move(c.protected.Back(), probationSegment)
+		}
+	}
+}
+
+// move puts the entry in front of segment s.
+func (c *TinyLfuCache) move(item *list.Element, s segment) {
+	e := item.Value.(*tinyLfuEntry)
+	c.list(e.segment).Remove(item)
+	e.segment = s
+	c.items[e.key] = c.list(s).PushFront(e)
+}
+
+func (c *TinyLfuCache) setElement(key Key, value interface{}) {
+	e := &tinyLfuEntry{key: key, value: value, hash: hashKey(key), segment: windowSegment}
+	c.sketch.Increment(e.hash)
+	c.items[key] = c.window.PushFront(e)
+
+	if c.window.Len() <= c.windowCap {
+		return
+	}
+
+	// the window overflows: its tail competes against the main victim
+	candidate := c.window.Back()
+	if c.probation.Len()+c.protected.Len() < c.maxItems-c.windowCap {
+		c.move(candidate, probationSegment)
+		return
+	}
+
+	victim := c.probation.Back()
+	if victim == nil {
+		victim = c.protected.Back()
+	}
+	if victim == nil {
+		// no main segment at all, with maxItems 1
+		c.removeElement(candidate)
+		return
+	}
+
+	if c.sketch.Estimate(candidate.Value.(*tinyLfuEntry).hash) > c.sketch.Estimate(victim.Value.(*tinyLfuEntry).hash) {
+		c.removeElement(victim)
+		c.move(candidate, probationSegment)
+	} else {
+		c.removeElement(candidate)
+	}
+}
+
+func (c *TinyLfuCache) removeElement(item *list.Element) {
+	e := item.Value.(*tinyLfuEntry)
+	c.list(e.segment).Remove(item)
+	delete(c.items, e.key)
+	atomic.AddUint64(&c.stats.evicts, 1)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+func hashKey(key Key) uint32 {
+	return keyhash.Key(key)
+}
@@ -0,0 +1,301 @@
+package cache
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EvictReason tells why an entry left the LRU.
+type EvictReason int
+
+const (
+	// EvictCapacity means the entry was evicted to make room.
+	EvictCapacity EvictReason = iota
+
+	// EvictExpired means the entry outlived its TTL.
+	EvictExpired
+
+	// EvictDeleted means the entry was removed by Del or Purge.
+	EvictDeleted
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+type lruEntry[K comparable, V any] struct {
+	key    K
+	value  V
+	cost   int64
+	expire int64 // unix nano, 0 means never
+}
+
+// LRU is a goroutine safe, typed LRU cache with per-entry TTL, bounded
+// by item count and by the total cost of its entries.
+//
+// The cost of a value is its Len() if it implements HasLength, 1 otherwise.
+type LRU[K comparable, V any] struct {
+	lock sync.Mutex
+
+	// maxItems is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	maxItems int
+
+	// maxCost is the maximum total cost of cache entries before
+	// an item is evicted. Zero means no limit.
+	maxCost int64
+	cost    int64
+
+	// ttl is the default time to live of entries. Zero means never expire.
+	ttl time.Duration
+
+	stats *lruCacheStat
+
+	// OnEvict optionally specificies a callback function to be
+	// executed when an entry leaves the cache.
+	// It is called with the cache lock held, so it must not call back
+	// into the cache.
+	OnEvict func(key K, value V, reason EvictReason)
+
+	ll    *list.List
+	items map[K]*list.Element
+
+	now func() time.Time
+}
+
+// NewLRU creates a new LRU.
+// If maxItems is zero, the cache has no item count limit.
+func NewLRU[K comparable, V any](maxItems int) *LRU[K, V] {
+	const M = 1 << 20
+	var sz = maxItems
+	if maxItems > M {
+		sz = M
+	}
+	return &LRU[K, V]{
+		maxItems: maxItems,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element, sz),
+		stats:    &lruCacheStat{},
+		now:      time.Now,
+	}
+}
+
+// WithMaxCost bounds the total cost of entries. Zero means no limit.
+func (c *LRU[K, V]) WithMaxCost(maxCost int64) *LRU[K, V] {
+	c.maxCost = maxCost
+	return c
+}
+
+// WithTTL sets the default time to live of entries added by Set and Add.
+// Zero means never expire.
+func (c *LRU[K, V]) WithTTL(ttl time.Duration) *LRU[K, V] {
+	c.ttl = ttl
+	return c
+}
+
+// Set adds a value to the cache with the default TTL.
+// If key already exists, its value gets overwritten.
+func (c *LRU[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL adds a value to the cache that expires after ttl.
+// Zero ttl means never expire.
+func (c *LRU[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if item, ok := c.items[key]; ok {
+		e := item.Value.(*lruEntry[K, V])
+		c.cost -= e.cost
+		e.value, e.cost, e.expire = value, costOf(value), c.expireAt(ttl)
+		c.cost += e.cost
+		c.ll.MoveToFront(item)
+		c.evict()
+		return
+	}
+
+	c.setElement(key, value, ttl)
+}
+
+// Add will return true and set the key to cache if key not existent or
+// expired, else return false.
+func (c *LRU[K, V]) Add(key K, value V) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if item, ok := c.items[key]; ok {
+		if !c.expired(item) {
+			return false
+		}
+		c.removeElement(item, EvictExpired)
+	}
+
+	c.setElement(key, value, c.ttl)
+	return true
+}
+
+// Get looks up a key's value from the cache.
+func (c *LRU[K, V]) Get(key K) (value V, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if item, hit := c.items[key]; hit {
+		if !c.expired(item) {
+			atomic.AddUint64(&c.stats.hits, 1)
+			c.ll.MoveToFront(item)
+			return item.Value.(*lruEntry[K, V]).value, true
+		}
+
+		c.removeElement(item, EvictExpired)
+	}
+
+	atomic.AddUint64(&c.stats.misses, 1)
+	return
+}
+
+// Peek looks up a key's value without updating its recentness.
+func (c *LRU[K, V]) Peek(key K) (value V, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if item, hit := c.items[key]; hit && !c.expired(item) {
+		return item.Value.(*lruEntry[K, V]).value, true
+	}
+	return
+}
+
+func (c *LRU[K, V]) Del(key K) {
+	c.lock.Lock()
+	if item, hit := c.items[key]; hit {
+		c.removeElement(item, EvictDeleted)
+	}
+	c.lock.Unlock()
+}
+
+// Purge removes all entries from the cache.
+func (c *LRU[K, V]) Purge() {
+	c.lock.Lock()
+	for item := c.ll.Back(); item != nil; item = c.ll.Back() {
+		c.removeElement(item, EvictDeleted)
+	}
+	c.lock.Unlock()
+}
+
+// RemoveExpired removes all the expired entries and returns how many.
+func (c *LRU[K, V]) RemoveExpired() (n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for item := c.ll.Back(); item != nil; {
+		prev := item.Prev()
+		if c.expired(item) {
+			c.removeElement(item, EvictExpired)
+			n++
+		}
+		item = prev
+	}
+	return
+}
+
+// Keys return active keys in the cache from the most to the least
+// recently used.
+func (c *LRU[K, V]) Keys() []K {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	keys := make([]K, 0, len(c.items))
+	for item := c.ll.Front(); item != nil; item = item.Next() {
+		if !c.expired(item) {
+			keys = append(keys, item.Value.(*lruEntry[K, V]).key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of items in the cache, including the expired
+// ones not yet removed.
+func (c *LRU[K, V]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.ll.Len()
+}
+
+// Cost returns the total cost of items in the cache.
+func (c *LRU[K, V]) Cost() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cost
+}
+
+// HitRatio returns the ratio of Get hits since the cache was created.
+func (c *LRU[K, V]) HitRatio() float64 {
+	return c.stats.HitRatio()
+}
+
+func (c *LRU[K, V]) expireAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return c.now().Add(ttl).UnixNano()
+}
+
+func (c *LRU[K, V]) expired(item *list.Element) bool {
+	expire := item.Value.(*lruEntry[K, V]).expire
+	return expire != 0 && c.now().UnixNano() >= expire
+}
+
+func (c *LRU[K, V]) setElement(key K, value V, ttl time.Duration) {
+	e := &lruEntry[K, V]{key: key, value: value, cost: costOf(value), expire: c.expireAt(ttl)}
+	c.items[key] = c.ll.PushFront(e)
+	c.cost += e.cost
+	c.evict()
+}
+
+// evict removes the least recently used entries until the cache fits in
+// its limits. The most recent entry is always kept, even if its own cost
+// exceeds maxCost.
+func (c *LRU[K, V]) evict() {
+	for c.ll.Len() > 1 &&
+		((c.maxItems != 0 && c.ll.Len() > c.maxItems) || (c.maxCost != 0 && c.cost > c.maxCost)) {
+		c.removeElement(c.ll.Back(), EvictCapacity)
+	}
+}
+
+func (c *LRU[K, V]) removeElement(item *list.Element, reason EvictReason) {
+	c.ll.Remove(item)
+	e := item.Value.(*lruEntry[K, V])
+	delete(c.items, e.key)
+	c.cost -= e.cost
+	if reason != EvictDeleted {
+		atomic.AddUint64(&c.stats.evicts, 1)
+	}
+	if c.OnEvict != nil {
+		c.OnEvict(e.key, e.value, reason)
+	}
+}
+
+func costOf(value interface{}) int64 {
+	if l, ok := value.(HasLength); ok {
+		// Len of a nil pointer would panic
+		if v := reflect.ValueOf(l); v.Kind() == reflect.Ptr && v.IsNil() {
+			return 1
+		}
+		return int64(l.Len())
+	}
+	return 1
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+)
+
+type evicted struct {
+	key    string
+	value  int
+	reason EvictReason
+}
+
+type blob []byte
+
+func (b blob) Len() int {
+	return len(b)
+}
+
+func TestLRUGetSet(t *testing.T) {
+	lru := NewLRU[string, int](2)
+	var evicts []evicted
+	lru.OnEvict = func(key string, value int, reason EvictReason) {
+		evicts = append(evicts, evicted{key, value, reason})
+	}
+
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	v, ok := lru.Get("a")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 1, v)
+
+	lru.Set("c", 3) // evicts b
+	_, ok = lru.Get("b")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, []string{"c", "a"}, lru.Keys())
+
+	assert.Equal(t, false, lru.Add("a", 10))
+	lru.Del("a")
+	assert.Equal(t, 1, lru.Len())
+
+	assert.Equal(t, []evicted{{"b", 2, EvictCapacity}, {"a", 1, EvictDeleted}}, evicts)
+}
+
+func TestLRUTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lru := NewLRU[string, int](0).WithTTL(time.Minute)
+	lru.now = func() time.Time { return now }
+	var reasons []EvictReason
+	lru.OnEvict = func(key string, value int, reason EvictReason) {
+		reasons = append(reasons, reason)
+	}
+
+	lru.Set("a", 1)
+	lru.SetWithTTL("b", 2, time.Hour)
+	lru.SetWithTTL("c", 3, 0)
+
+	now = now.Add(2 * time.Minute)
+	_, ok := lru.Get("a")
+	assert.Equal(t, false, ok)
+	_, ok = lru.Get("b")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, lru.Add("a", 1))
+
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, 2, lru.RemoveExpired())
+	assert.Equal(t, []string{"c"}, lru.Keys())
+	assert.Equal(t, []EvictReason{EvictExpired, EvictExpired, EvictExpired}, reasons)
+}
+
+func TestLRUCost(t *testing.T) {
+	lru := NewLRU[string, blob](0).WithMaxCost(10)
+	lru.Set("a", make(blob, 4))
+	lru.Set("b", make(blob, 4))
+	assert.Equal(t, int64(8), lru.Cost())
+
+	lru.Set("c", make(blob, 4)) // evicts a
+	assert.Equal(t, int64(8), lru.Cost())
+	_, ok := lru.Peek("a")
+	assert.Equal(t, false, ok)
+
+	// overwriting b with a bigger value evicts c
+	lru.Get("c")
+	lru.Set("b", make(blob, 8))
+	assert.Equal(t, []string{"b"}, lru.Keys())
+	assert.Equal(t, int64(8), lru.Cost())
+
+	lru.Purge()
+	assert.Equal(t, int64(0), lru.Cost())
+	assert.Equal(t, 0, lru.Len())
+
+	// a nil pointer costs 1
+	ptrs := NewLRU[string, *blob](0).WithMaxCost(10)
+	ptrs.Set("a", nil)
+	ptrs.Set("a", nil)
+	assert.Equal(t, int64(1), ptrs.Cost())
+}
+
+func TestShardedLRU(t *testing.T) {
+	slru := NewShardedLRU[int, string](4, 400, 0, nil)
+	for i := 0; i < 100; i++ {
+		slru.Set(i, "x")
+	}
+	assert.Equal(t, 100, slru.Len())
+	assert.Equal(t, int64(100), slru.Cost())
+
+	v, ok := slru.Get(42)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "x", v)
+
+	slru.Del(42)
+	_, ok = slru.Get(42)
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 99, len(slru.Keys()))
+}
+
+func TestShardedLRULimits(t *testing.T) {
+	slru := NewShardedLRU[int, string](0, 10, 0, nil)
+	for i := 0; i < 1000; i++ {
+		slru.Set(i, "x")
+	}
+	assert.Equal(t, 10, slru.Len())
+
+	slru = NewShardedLRU[int, string](8, 100, 20, nil)
+	for i := 0; i < 1000; i++ {
+		slru.Set(i, "x")
+	}
+	if slru.Len() > 20 || slru.Cost() > 20 {
+		t.Errorf("len %d cost %d over the limits", slru.Len(), slru.Cost())
+	}
+}
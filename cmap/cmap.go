@@ -66,6 +66,8 @@ func (m *ConcurrentMap) Remove(key string) {
 }
 
 // Returns an iterator which could be used in a for range loop.
+// The channel must be drained, otherwise the goroutine feeding it leaks:
+// use Map.Range to stop early.
 func (m ConcurrentMap) Iter() <-chan Tuple {
 	ch := make(chan Tuple)
 	go func() {
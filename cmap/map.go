@@ -0,0 +1,186 @@
+package cmap
+
+import (
+	"sync"
+
+	keyhash "github.com/cjysmat/golib/hash"
+)
+
+// Map is a typed thread safe map.
+// To avoid lock bottlenecks this map is dived to several map shards.
+type Map[K comparable, V any] struct {
+	shards []*mapShard[K, V]
+	hash   func(K) uint32
+}
+
+type mapShard[K comparable, V any] struct {
+	items map[K]V
+	sync.RWMutex
+}
+
+// NewMap creates a Map of shardCount shards, SHARD_COUNT if zero.
+// If hash is nil, keys are hashed by hash.Key.
+func NewMap[K comparable, V any](shardCount int, hash func(K) uint32) *Map[K, V] {
+	if shardCount <= 0 {
+		shardCount = SHARD_COUNT
+	}
+	if hash == nil {
+		hash = keyhash.Key[K]
+	}
+
+	m := &Map[K, V]{
+		shards: make([]*mapShard[K, V], shardCount),
+		hash:   hash,
+	}
+	for i := range m.shards {
+		m.shards[i] = &mapShard[K, V]{items: make(map[K]V)}
+	}
+	return m
+}
+
+func (m *Map[K, V]) shard(key K) *mapShard[K, V] {
+	return m.shards[uint(m.hash(key))%uint(len(m.shards))]
+}
+
+func (m *Map[K, V]) Set(key K, value V) {
+	shard := m.shard(key)
+	shard.Lock()
+	shard.items[key] = value
+	shard.Unlock()
+}
+
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	shard := m.shard(key)
+	shard.RLock()
+	val, ok := shard.items[key]
+	shard.RUnlock()
+	return val, ok
+}
+
+func (m *Map[K, V]) Has(key K) bool {
+	_, ok := m.Get(key)
+	return ok
+}
+
+func (m *Map[K, V]) Remove(key K) {
+	shard := m.shard(key)
+	shard.Lock()
+	delete(shard.items, key)
+	shard.Unlock()
+}
+
+func (m *Map[K, V]) Count() int {
+	count := 0
+	for _, shard := range m.shards {
+		shard.RLock()
+		count += len(shard.items)
+		shard.RUnlock()
+	}
+	return count
+}
+
+// Upsert atomically sets key to the value returned by fn, which receives
+// the current value if any. It returns the new value.
+//
+// fn is called with the shard locked, so it must not access the map.
+func (m *Map[K, V]) Upsert(key K, fn func(old V, exists bool) V) V {
+	shard := m.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	old, ok := shard.items[key]
+	val := fn(old, ok)
+	shard.items[key] = val
+	return val
+}
+
+// GetOrSet returns the existing value of key if present, otherwise it
+// sets and returns the given value. loaded is true if the value existed.
+func (m *Map[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	shard := m.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if actual, loaded = shard.items[key]; loaded {
+		return
+	}
+
+	shard.items[key] = value
+	return value, false
+}
+
+// RemoveIf atomically removes key if fn returns true for its current value
+// and reports whether it was removed.
+//
+// fn is called with the shard locked, so it must not access the map.
+func (m *Map[K, V]) RemoveIf(key K, fn func(value V) bool) bool {
+	shard := m.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if val, ok := shard.items[key]; ok && fn(val) {
+		delete(shard.items, key)
+		return true
+	}
+	return false
+}
+
+// Range calls fn for each key and value till fn returns false.
+//
+// Each shard is copied before fn is called, so fn may access the map;
+// consistency is per shard, not for the whole map.
+func (m *Map[K, V]) Range(fn func(key K, value V) bool) {
+	for _, shard := range m.shards {
+		shard.RLock()
+		items := make([]mapItem[K, V], 0, len(shard.items))
+		for key, val := range shard.items {
+			items = append(items, mapItem[K, V]{key, val})
+		}
+		shard.RUnlock()
+
+		for _, item := range items {
+			if !fn(item.key, item.val) {
+				return
+			}
+		}
+	}
+}
+
+type mapItem[K comparable, V any] struct {
+	key K
+	val V
+}
+
+// Keys returns a snapshot of all keys.
+func (m *Map[K, V]) Keys() []K {
+	keys := make([]K, 0, m.Count())
+	for _, shard := range m.shards {
+		shard.RLock()
+		for key := range shard.items {
+			keys = append(keys, key)
+		}
+		shard.RUnlock()
+	}
+	return keys
+}
+
+// Items returns a snapshot of all items.
+func (m *Map[K, V]) Items() map[K]V {
+	items := make(map[K]V, m.Count())
+	for _, shard := range m.shards {
+		shard.RLock()
+		for key, val := range shard.items {
+			items[key] = val
+		}
+		shard.RUnlock()
+	}
+	return items
+}
+
+// Clear removes all items.
+func (m *Map[K, V]) Clear() {
+	for _, shard := range m.shards {
+		shard.Lock()
+		shard.items = make(map[K]V)
+		shard.Unlock()
+	}
+}
@@ -0,0 +1,112 @@
+package cmap
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMapSetGetRemove(t *testing.T) {
+	m := NewMap[int, string](0, nil)
+	m.Set(1, "one")
+	m.Set(2, "two")
+
+	if v, ok := m.Get(1); !ok || v != "one" {
+		t.Errorf("expected one, got %v %v", v, ok)
+	}
+	if m.Count() != 2 {
+		t.Errorf("expected 2 elements, got %d", m.Count())
+	}
+
+	m.Remove(1)
+	if m.Has(1) {
+		t.Error("expected 1 to be removed")
+	}
+
+	m.Clear()
+	if m.Count() != 0 {
+		t.Error("expected empty map after clear")
+	}
+}
+
+func TestMapUpsert(t *testing.T) {
+	m := NewMap[string, int](4, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Upsert("counter", func(old int, exists bool) int {
+				return old + 1
+			})
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := m.Get("counter"); v != 100 {
+		t.Errorf("expected 100, got %d", v)
+	}
+
+	// a panicking fn leaves the shard unlocked
+	func() {
+		defer func() { recover() }()
+		m.Upsert("counter", func(old int, exists bool) int {
+			panic("boom")
+		})
+	}()
+	if v := m.Upsert("counter", func(old int, exists bool) int { return old + 1 }); v != 101 {
+		t.Errorf("expected 101, got %d", v)
+	}
+}
+
+func TestMapGetOrSetRemoveIf(t *testing.T) {
+	m := NewMap[string, int](0, nil)
+
+	if v, loaded := m.GetOrSet("a", 1); loaded || v != 1 {
+		t.Errorf("expected 1 set, got %d %v", v, loaded)
+	}
+	if v, loaded := m.GetOrSet("a", 2); !loaded || v != 1 {
+		t.Errorf("expected 1 loaded, got %d %v", v, loaded)
+	}
+
+	if m.RemoveIf("a", func(v int) bool { return v > 1 }) {
+		t.Error("expected a not removed")
+	}
+	if !m.RemoveIf("a", func(v int) bool { return v == 1 }) {
+		t.Error("expected a removed")
+	}
+	if m.RemoveIf("missing", func(v int) bool { return true }) {
+		t.Error("expected missing not removed")
+	}
+}
+
+func TestMapRangeKeysItems(t *testing.T) {
+	m := NewMap[string, int](0, nil)
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+
+	n := 0
+	m.Range(func(key string, value int) bool {
+		// callback may access the map
+		m.Set(key, value)
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Errorf("expected range to stop at 10, got %d", n)
+	}
+
+	keys := m.Keys()
+	sort.Strings(keys)
+	if len(keys) != 100 || keys[0] != "0" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	items := m.Items()
+	if len(items) != 100 || items["42"] != 42 {
+		t.Errorf("unexpected items %v", items)
+	}
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	capi "github.com/hashicorp/consul/api"
+)
+
+// kvBackend is the consul KV API used by ConsulSource.
+type kvBackend interface {
+	// List returns all the pairs under prefix, with prefix trimmed from
+	// the keys, and the index of the data.
+	// If waitIndex is not zero, it blocks till the index moves past
+	// waitIndex or ctx is done.
+	List(ctx context.Context, prefix string, waitIndex uint64) (map[string][]byte, uint64, error)
+
+	// Get returns the pairs of keys and those under folders, along with
+	// the index of the data.
+	Get(ctx context.Context, keys, folders []string) (map[string][]byte, uint64, error)
+
+	// Wait blocks till the index of the data under prefix moves past
+	// waitIndex, or the wait times out, and returns the index.
+	Wait(ctx context.Context, prefix string, waitIndex uint64) (uint64, error)
+}
+
+type consulKV struct {
+	kv *capi.KV
+}
+
+func (c *consulKV) List(ctx context.Context, prefix string, waitIndex uint64) (map[string][]byte, uint64, error) {
+	opts := &capi.QueryOptions{WaitIndex: waitIndex}
+	pairs, meta, err := c.kv.List(prefix, opts.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	values := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		values[strings.TrimPrefix(pair.Key, prefix)] = pair.Value
+	}
+	return values, meta.LastIndex, nil
+}
+
+// maxTxnOps is the most operations a consul transaction accepts.
+const maxTxnOps = 64
+
+func (c *consulKV) Get(ctx context.Context, keys, folders []string) (map[string][]byte, uint64, error) {
+	// a get-tree of a missing key is empty, where a get fails the whole
+	// transaction
+	var ops capi.KVTxnOps
+	for _, key := range append(append([]string(nil), keys...), folders...) {
+		ops = append(ops, &capi.KVTxnOp{Verb: capi.KVGetTree, Key: key})
+	}
+
+	var index uint64
+	values := make(map[string][]byte)
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > maxTxnOps {
+			n = maxTxnOps
+		}
+
+		ok, resp, meta, err := c.kv.Txn(ops[:n], (&capi.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return nil, 0, err
+		}
+		if !ok {
+			var what []string
+			for _, e := range resp.Errors {
+				what = append(what, e.What)
+			}
+			return nil, 0, errors.New(strings.Join(what, "\n"))
+		}
+
+		for _, pair := range resp.Results {
+			values[pair.Key] = pair.Value
+		}
+		index = meta.LastIndex
+		ops = ops[n:]
+	}
+
+	// the tree of a key holds those it prefixes too, e.g. "names" for
+	// "name"
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+	for key := range values {
+		if !wanted[key] && !hasAnyPrefix(key, folders) {
+			delete(values, key)
+		}
+	}
+	return values, index, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait lists the keys one level under prefix only, to keep the response
+// small: the index is that of the whole data under prefix anyway.
+func (c *consulKV) Wait(ctx context.Context, prefix string, waitIndex uint64) (uint64, error) {
+	opts := &capi.QueryOptions{WaitIndex: waitIndex}
+	_, meta, err := c.kv.Keys(prefix, "/", opts.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	return meta.LastIndex, nil
+}
+
+// ConsulSource reads the consul KV folder Config.Prefix and watches it
+// with blocking queries.
+//
+// Without prefix, the KV root is never read whole: it is a KeyedSource
+// which only reads the keys declared by the structs unmarshaled.
+type ConsulSource struct {
+	kv     kvBackend
+	prefix string
+
+	mu        sync.Mutex
+	lastIndex uint64
+
+	// the keys read by the last LoadKeys from the KV root, and their
+	// values
+	keys, folders []string
+	values        Values
+}
+
+// ErrNoPrefix is returned by Load on a ConsulSource without prefix.
+var ErrNoPrefix = errors.New("config: consul source without prefix only loads declared keys")
+
+func NewConsulSource(c *Config) (*ConsulSource, error) {
+	config := capi.DefaultConfig()
+	config.Address = c.Address
+	consul, err := capi.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ConsulSource{kv: &consulKV{kv: consul.KV()}}
+	s.prefix = c.Prefix
+	if s.prefix != "" && !strings.HasSuffix(s.prefix, "/") {
+		s.prefix += "/"
+	}
+	return s, nil
+}
+
+func (s *ConsulSource) Load(ctx context.Context) (Snapshot, error) {
+	if s.prefix == "" {
+		return nil, ErrNoPrefix
+	}
+
+	values, index, err := s.kv.List(ctx, s.prefix, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.lastIndex = index
+	s.mu.Unlock()
+	return Values(values), nil
+}
+
+// LoadKeys reads the folder Config.Prefix whole, or keys and folders from
+// the KV root without prefix.
+func (s *ConsulSource) LoadKeys(ctx context.Context, keys, folders []string) (Snapshot, error) {
+	if s.prefix != "" {
+		return s.Load(ctx)
+	}
+
+	values, index, err := s.kv.Get(ctx, keys, folders)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.lastIndex = index
+	s.keys, s.folders, s.values = keys, folders, values
+	s.mu.Unlock()
+	return Values(values), nil
+}
+
+func (s *ConsulSource) Changed(ctx context.Context) error {
+	s.mu.Lock()
+	index := s.lastIndex
+	s.mu.Unlock()
+
+	for {
+		newIndex, err := s.kv.Wait(ctx, s.prefix, index)
+		if err != nil {
+			return err
+		}
+		if newIndex == index {
+			// wait timeout without change
+			continue
+		}
+		index = newIndex
+
+		if s.prefix == "" {
+			// any key of the KV changed, maybe none of those read
+			s.mu.Lock()
+			keys, folders, last := s.keys, s.folders, s.values
+			s.mu.Unlock()
+
+			values, _, err := s.kv.Get(ctx, keys, folders)
+			if err != nil {
+				return err
+			}
+			if reflect.DeepEqual(Values(values), last) {
+				continue
+			}
+		}
+
+		// index going backwards, e.g. on consul snapshot restore, is a
+		// change as well
+		s.mu.Lock()
+		s.lastIndex = newIndex
+		s.mu.Unlock()
+		return nil
+	}
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ErrKeyNotFound is returned for a key missing from all the sources and
+// without default.
+var ErrKeyNotFound = errors.New("config: key not found")
+
+// decoder fills struct fields from layered snapshots: a key is looked up
+// in each snapshot in order till found.
+type decoder struct {
+	snapshots []Snapshot
+}
+
+func (d *decoder) lookup(key string) ([]byte, bool) {
+	for _, s := range d.snapshots {
+		if v, ok := s.Lookup(key); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (d *decoder) hasPrefix(prefix string) bool {
+	for _, s := range d.snapshots {
+		if s.HasPrefix(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldKey returns the key in the `config` tag, or the `consul` one.
+func fieldKey(field reflect.StructField) string {
+	if key := field.Tag.Get("config"); key != "" {
+		return key
+	}
+	return field.Tag.Get("consul")
+}
+
+func (d *decoder) decodeStruct(rv reflect.Value, prefix string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		key := fieldKey(field)
+		if key == "" || key == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if prefix != "" {
+			key = prefix + "/" + key
+		}
+		def, hasDef := field.Tag.Lookup("default")
+		if err := d.decodeField(rv.Field(i), key, def, hasDef); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeField(f reflect.Value, key string, def string, hasDef bool) error {
+	t := f.Type()
+	switch {
+	case isFolder(t):
+		return d.decodeStruct(f, key)
+
+	case t.Kind() == reflect.Ptr && isFolder(t.Elem()):
+		if f.IsNil() {
+			if !d.hasPrefix(key + "/") {
+				return nil
+			}
+			f.Set(reflect.New(t.Elem()))
+		}
+		return d.decodeStruct(f.Elem(), key)
+
+	case t.Kind() == reflect.Slice && isFolder(t.Elem()):
+		n := 0
+		for d.hasPrefix(fmt.Sprintf("%s/%d/", key, n)) {
+			n++
+		}
+		if n == 0 {
+			return nil
+		}
+
+		s := reflect.MakeSlice(t, n, n)
+		for i := 0; i < n; i++ {
+			if err := d.decodeStruct(s.Index(i), fmt.Sprintf("%s/%d", key, i)); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+		return nil
+	}
+
+	raw, ok := d.lookup(key)
+	if !ok {
+		if !hasDef {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		if def == "" {
+			// optional
+			return nil
+		}
+		raw = []byte(def)
+	}
+
+	if err := setValue(f, raw); err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	return nil
+}
+
+// declaredKeys returns the keys of the fields of the struct type rt, and
+// the folders of its pointer and slice folder fields, whose keys are only
+// known once loaded.
+func declaredKeys(rt reflect.Type, prefix string) (keys, folders []string) {
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		key := fieldKey(field)
+		if key == "" || key == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if prefix != "" {
+			key = prefix + "/" + key
+		}
+		switch t := field.Type; {
+		case isFolder(t):
+			k, f := declaredKeys(t, key)
+			keys = append(keys, k...)
+			folders = append(folders, f...)
+		case t.Kind() == reflect.Ptr && isFolder(t.Elem()),
+			t.Kind() == reflect.Slice && isFolder(t.Elem()):
+			folders = append(folders, key+"/")
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys, folders
+}
+
+// isFolder tells whether t is a struct with tagged fields.
+func isFolder(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if fieldKey(t.Field(i)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func setValue(f reflect.Value, raw []byte) error {
+	s := string(raw)
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+
+	case
+		reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		if f.OverflowInt(n) {
+			return fmt.Errorf("%d overflows %v", n, f.Type())
+		}
+		f.SetInt(n)
+
+	case
+		reflect.Uint,
+		reflect.Uint8,
+		reflect.Uint16,
+		reflect.Uint32,
+		reflect.Uint64,
+		reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		if f.OverflowUint(n) {
+			return fmt.Errorf("%d overflows %v", n, f.Type())
+		}
+		f.SetUint(n)
+
+	case
+		reflect.Float32,
+		reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		if f.OverflowFloat(n) {
+			return fmt.Errorf("%v overflows %v", n, f.Type())
+		}
+		f.SetFloat(n)
+
+	case reflect.Slice:
+		if f.Type().Elem().Kind() == reflect.Uint8 {
+			f.SetBytes(append([]byte(nil), raw...))
+			return nil
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			return setJSON(f, raw)
+		}
+
+		// comma separated list
+		parts := strings.Split(s, ",")
+		sl := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(sl.Index(i), []byte(strings.TrimSpace(part))); err != nil {
+				return err
+			}
+		}
+		f.Set(sl)
+
+	case
+		reflect.Interface,
+		reflect.Map,
+		reflect.Array,
+		reflect.Ptr,
+		reflect.Struct:
+		return setJSON(f, raw)
+
+	default:
+		return fmt.Errorf("not support %v", f.Type())
+	}
+
+	return nil
+}
+
+// setJSON decodes into a fresh value so that f is never partially updated.
+func setJSON(f reflect.Value, raw []byte) error {
+	x := reflect.New(f.Type())
+	if err := json.Unmarshal(raw, x.Interface()); err != nil {
+		return err
+	}
+	f.Set(x.Elem())
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+var envReplacer = strings.NewReplacer("/", "_", "-", "_", ".", "_")
+
+// EnvSource looks keys up in the environment variables: key "db/host" is
+// the variable prefix+"DB_HOST".
+type EnvSource string
+
+func NewEnvSource(prefix string) EnvSource {
+	return EnvSource(prefix)
+}
+
+func (e EnvSource) Load(ctx context.Context) (Snapshot, error) {
+	return e, nil
+}
+
+func (e EnvSource) name(key string) string {
+	return string(e) + strings.ToUpper(envReplacer.Replace(key))
+}
+
+func (e EnvSource) Lookup(key string) ([]byte, bool) {
+	v, ok := os.LookupEnv(e.name(key))
+	return []byte(v), ok
+}
+
+func (e EnvSource) HasPrefix(prefix string) bool {
+	name := e.name(prefix)
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// EtcdSource reads the keys under an etcd directory and watches it.
+type EtcdSource struct {
+	client *etcd.Client
+	prefix string
+
+	mu        sync.Mutex
+	lastIndex uint64
+}
+
+// NewEtcdSource reads the directory prefix, e.g. "/myapp", of the etcd
+// cluster at machines, e.g. "http://127.0.0.1:2379".
+func NewEtcdSource(machines []string, prefix string) *EtcdSource {
+	return &EtcdSource{
+		client: etcd.NewClient(machines),
+		prefix: "/" + strings.Trim(prefix, "/") + "/",
+	}
+}
+
+func (s *EtcdSource) Load(ctx context.Context) (Snapshot, error) {
+	values := make(Values)
+	resp, err := s.client.Get(s.prefix, false, true)
+	if err != nil {
+		if etcdError, ok := err.(*etcd.EtcdError); ok && etcdError.ErrorCode == 100 {
+			// key not found
+			return values, nil
+		}
+		return nil, err
+	}
+
+	s.flatten(values, resp.Node)
+	s.mu.Lock()
+	s.lastIndex = resp.EtcdIndex
+	s.mu.Unlock()
+	return values, nil
+}
+
+func (s *EtcdSource) flatten(values Values, node *etcd.Node) {
+	if !node.Dir {
+		values[strings.TrimPrefix(node.Key, s.prefix)] = []byte(node.Value)
+		return
+	}
+
+	for _, child := range node.Nodes {
+		s.flatten(values, child)
+	}
+}
+
+func (s *EtcdSource) Changed(ctx context.Context) error {
+	s.mu.Lock()
+	index := s.lastIndex
+	s.mu.Unlock()
+
+	stop := make(chan bool)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(stop)
+		case <-done:
+		}
+	}()
+
+	resp, err := s.client.Watch(s.prefix, index+1, true, nil, stop)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.lastIndex = resp.Node.ModifiedIndex
+	s.mu.Unlock()
+	return nil
+}
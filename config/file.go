@@ -0,0 +1,155 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// PollInterval is how often a FileSource checks its file for changes.
+var PollInterval = 5 * time.Second
+
+// FileSource reads a JSON, YAML or TOML file, chosen by its extension.
+//
+// Nested objects and arrays are addressed by slash separated paths, e.g.
+// {"db": {"host": "x"}} provides the key "db/host" and {"servers":
+// [{"addr": "y"}]} the key "servers/0/addr".
+type FileSource struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (f *FileSource) Load(ctx context.Context) (Snapshot, error) {
+	st, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var x interface{}
+	switch ext := filepath.Ext(f.path); ext {
+	case ".json":
+		err = json.Unmarshal(b, &x)
+
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &x)
+		x = normalizeYaml(x)
+
+	case ".toml":
+		var m map[string]interface{}
+		err = toml.Unmarshal(b, &m)
+		x = m
+
+	default:
+		return nil, fmt.Errorf("config: unknown file type %s", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %v", f.path, err)
+	}
+
+	f.mu.Lock()
+	f.modTime = st.ModTime()
+	f.mu.Unlock()
+
+	values := make(Values)
+	flatten(values, "", x)
+	return values, nil
+}
+
+// Changed polls the modification time of the file.
+func (f *FileSource) Changed(ctx context.Context) error {
+	f.mu.Lock()
+	modTime := f.modTime
+	f.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(PollInterval):
+		}
+
+		if st, err := os.Stat(f.path); err == nil && !st.ModTime().Equal(modTime) {
+			f.mu.Lock()
+			f.modTime = st.ModTime()
+			f.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// normalizeYaml converts the map[interface{}]interface{} produced by yaml
+// into map[string]interface{}.
+func normalizeYaml(x interface{}) interface{} {
+	switch v := x.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprint(k)] = normalizeYaml(child)
+		}
+		return m
+
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeYaml(child)
+		}
+	}
+	return x
+}
+
+// flatten stores every node of a document by its slash separated path:
+// strings as is and the other nodes as JSON, so that both folder and JSON
+// valued fields can be decoded from it.
+func flatten(values Values, key string, x interface{}) {
+	join := func(k string) string {
+		if key == "" {
+			return k
+		}
+		return key + "/" + k
+	}
+
+	switch v := x.(type) {
+	case string:
+		values[key] = []byte(v)
+		return
+
+	case map[string]interface{}:
+		for k, child := range v {
+			flatten(values, join(k), child)
+		}
+
+	case []interface{}:
+		for i, child := range v {
+			flatten(values, join(strconv.Itoa(i)), child)
+		}
+
+	case []map[string]interface{}:
+		// toml array of tables
+		for i, child := range v {
+			flatten(values, join(strconv.Itoa(i)), child)
+		}
+	}
+
+	if key != "" {
+		values[key], _ = json.Marshal(x)
+	}
+}
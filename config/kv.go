@@ -1,18 +1,23 @@
 package config
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
+	"sync"
 
-	capi "github.com/hashicorp/consul/api"
+	"github.com/cjysmat/golib/validator"
 )
 
 // Config consul 地址配置
 type Config struct {
 	Address string
+
+	// Prefix is the consul KV folder under which keys in `consul` tags
+	// are resolved, e.g. "myapp/". Empty means the KV root, of which only
+	// the keys declared by the structs are read.
+	Prefix string
 }
 
 // DefaultConfig ...
@@ -22,139 +27,165 @@ func DefaultConfig() *Config {
 	return c
 }
 
-// Gosh ...
+// Gosh unmarshals structs from layered sources.
 type Gosh struct {
-	client *capi.Client
+	sources []Source
+
+	mu     sync.RWMutex
+	loaded []Snapshot // by Load
+}
+
+// New creates a Gosh reading from sources in order of precedence: a key
+// is looked up in each source in turn till found.
+func New(sources ...Source) *Gosh {
+	return &Gosh{sources: sources}
 }
 
-// NewClient ...
+// NewClient creates a Gosh backed by consul.
 func NewClient(c *Config) (*Gosh, error) {
-	config := capi.DefaultConfig()
-	config.Address = c.Address
-	consul, err := capi.NewClient(config)
+	s, err := NewConsulSource(c)
 	if err != nil {
 		return nil, err
 	}
 
-	g := &Gosh{}
-	g.client = consul
-	return g, nil
+	return New(s), nil
 }
 
-// Unmarshal ...
-func (g *Gosh) Unmarshal(v interface{}) error {
-	var ops capi.KVTxnOps
+// WithSource adds a source with lower precedence than the existing ones.
+func (g *Gosh) WithSource(s Source) *Gosh {
+	g.sources = append(g.sources, s)
+	return g
+}
 
-	rv := reflect.ValueOf(v).Elem()
-	if !rv.IsValid() {
-		return errors.New("参数未初始化")
-	}
+// WithFile adds a file as fallback for the keys missing in the existing
+// sources. See FileSource.
+func (g *Gosh) WithFile(path string) *Gosh {
+	return g.WithSource(NewFileSource(path))
+}
 
-	rt := reflect.TypeOf(v).Elem()
-
-	ndx := 0
-	dt := make(map[int]string)
-
-	for i := 0; i < rt.NumField(); i++ {
-		field := rt.Field(i)
-		key := field.Tag.Get("consul")
-		if key != "" {
-			op := capi.KVTxnOp{
-				Verb: capi.KVGet,
-				Key:  key,
-			}
-			ops = append(ops, &op)
-			dt[ndx] = field.Name
-			ndx++
-		}
+// WithEnv adds the environment as fallback for the keys missing in the
+// existing sources. See EnvSource.
+func (g *Gosh) WithEnv(prefix string) *Gosh {
+	return g.WithSource(NewEnvSource(prefix))
+}
+
+// Unmarshal reads the keys in `config` or `consul` tags of the struct
+// pointed by v.
+//
+// A tagged field of struct type whose fields are tagged too is decoded
+// as a folder: its fields' keys are relative to its own key. A slice of
+// such structs is decoded from the folders key/0, key/1 and so on.
+// Keys missing from all the sources take the value of their `default`
+// tag, and are an error, ErrKeyNotFound, without one. An empty default,
+// `default:""`, makes the key optional: the field is left untouched.
+// Pointer and slice folders are optional too.
+//
+// Once decoded, v is validated by its `validate` tags. v is only modified
+// if both decoding and validation succeed.
+func (g *Gosh) Unmarshal(v interface{}) error {
+	snapshots, err := g.load(context.Background(), v)
+	if err != nil {
+		return err
 	}
 
-	ok, res, _, err := g.client.KV().Txn(ops, nil)
+	return apply(v, snapshots, nil)
+}
+
+// Load loads the sources whole, for Lookup and Get. Unmarshal and Watch
+// don't need it, as they load the sources themselves.
+func (g *Gosh) Load(ctx context.Context) error {
+	snapshots, err := g.load(ctx, nil)
 	if err != nil {
 		return err
 	}
 
+	g.mu.Lock()
+	g.loaded = snapshots
+	g.mu.Unlock()
+	return nil
+}
+
+// Lookup returns the value of key in the sources loaded by Load.
+func (g *Gosh) Lookup(key string) ([]byte, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	d := &decoder{snapshots: g.loaded}
+	return d.lookup(key)
+}
+
+// Get decodes the value of key in the sources loaded by Load into the
+// value pointed by v, the way Unmarshal decodes a field. It tells whether
+// key was found, v being left untouched otherwise or on error.
+func (g *Gosh) Get(key string, v interface{}) (bool, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return false, errors.New("参数未初始化")
+	}
+
+	raw, ok := g.Lookup(key)
 	if !ok {
-		str := ""
-		for i := 0; i < len(res.Errors); i++ {
-			str += fmt.Sprintf("%v\n", res.Errors[i].What)
-		}
-		return errors.New(str)
+		return false, nil
+	}
+
+	tmp := reflect.New(rv.Elem().Type())
+	if err := setValue(tmp.Elem(), raw); err != nil {
+		return true, fmt.Errorf("%s: %v", key, err)
+	}
+	rv.Elem().Set(tmp.Elem())
+	return true, nil
+}
+
+// load loads the sources for v: the KeyedSource ones only load the keys
+// declared by v. A nil v loads them whole.
+func (g *Gosh) load(ctx context.Context, v interface{}) ([]Snapshot, error) {
+	var keys, folders []string
+	if rt := reflect.TypeOf(v); rt != nil && rt.Kind() == reflect.Ptr && rt.Elem().Kind() == reflect.Struct {
+		keys, folders = declaredKeys(rt.Elem(), "")
 	}
 
-	obj := make(map[string]interface{})
-
-	for i, each := range res.Results {
-		key := dt[i]
-		switch f := rv.FieldByName(key); f.Kind() {
-		case reflect.String:
-			obj[key] = string(each.Value)
-
-		case
-			reflect.Interface,
-			reflect.Map,
-			reflect.Slice,
-			reflect.Ptr,
-			reflect.Struct,
-			reflect.Bool:
-			var x interface{}
-			err := json.Unmarshal(each.Value, &x)
-			if err != nil {
-				return err
-			}
-			obj[key] = x
-
-		case
-			reflect.Int,
-			reflect.Int8,
-			reflect.Int16,
-			reflect.Int32,
-			reflect.Int64:
-			n, err := strconv.ParseInt(string(each.Value), 10, 64)
-			if err != nil || f.OverflowInt(n) {
-				return err
-			}
-			obj[key] = n
-
-		case
-			reflect.Uint,
-			reflect.Uint8,
-			reflect.Uint16,
-			reflect.Uint32,
-			reflect.Uint64,
-			reflect.Uintptr:
-			n, err := strconv.ParseUint(string(each.Value), 10, 64)
-			if err != nil || f.OverflowUint(n) {
-				return err
-			}
-
-			obj[key] = n
-
-		case
-			reflect.Float32,
-			reflect.Float64:
-			n, err := strconv.ParseFloat(string(each.Value), f.Type().Bits())
-			if err != nil || f.OverflowFloat(n) {
-				return err
-			}
-
-			obj[key] = n
-
-		default:
-			return fmt.Errorf("not support %v", f.Type())
+	snapshots := make([]Snapshot, 0, len(g.sources))
+	for _, s := range g.sources {
+		var snapshot Snapshot
+		var err error
+		if ks, ok := s.(KeyedSource); ok && v != nil {
+			snapshot, err = ks.LoadKeys(ctx, keys, folders)
+		} else {
+			snapshot, err = s.Load(ctx)
 		}
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
 
+	return snapshots, nil
+}
+
+// apply decodes snapshots into a copy of *v, validates it and then stores
+// it into v while holding lock if not nil.
+func apply(v interface{}, snapshots []Snapshot, lock sync.Locker) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("参数未初始化")
 	}
 
-	b, err := json.Marshal(obj)
-	if err != nil {
-		return nil
+	tmp := reflect.New(rv.Elem().Type())
+	tmp.Elem().Set(rv.Elem())
+
+	d := &decoder{snapshots: snapshots}
+	if err := d.decodeStruct(tmp.Elem(), ""); err != nil {
+		return err
 	}
 
-	err = json.Unmarshal(b, &v)
-	if err != nil {
+	if err := validator.Validate(tmp.Interface()); err != nil {
 		return err
 	}
 
+	if lock != nil {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	rv.Elem().Set(tmp.Elem())
 	return nil
 }
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+)
+
+// fakeKV is an in-process consul KV supporting blocking queries.
+type fakeKV struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	index uint64
+	data  map[string][]byte
+	lists int // List calls
+}
+
+func newFakeKV(pairs map[string]string) *fakeKV {
+	kv := &fakeKV{index: 1, data: make(map[string][]byte)}
+	kv.cond = sync.NewCond(&kv.mu)
+	for k, v := range pairs {
+		kv.data[k] = []byte(v)
+	}
+	return kv
+}
+
+func (kv *fakeKV) Put(key, value string) {
+	kv.mu.Lock()
+	kv.data[key] = []byte(value)
+	kv.index++
+	kv.mu.Unlock()
+	kv.cond.Broadcast()
+}
+
+func (kv *fakeKV) List(ctx context.Context, prefix string, waitIndex uint64) (map[string][]byte, uint64, error) {
+	stop := context.AfterFunc(ctx, func() {
+		kv.mu.Lock()
+		kv.cond.Broadcast()
+		kv.mu.Unlock()
+	})
+	defer stop()
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	for waitIndex != 0 && kv.index <= waitIndex && ctx.Err() == nil {
+		kv.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	kv.lists++
+	values := make(map[string][]byte)
+	for k, v := range kv.data {
+		if strings.HasPrefix(k, prefix) {
+			values[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	return values, kv.index, nil
+}
+
+func (kv *fakeKV) Get(ctx context.Context, keys, folders []string) (map[string][]byte, uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	values := make(map[string][]byte)
+	for k, v := range kv.data {
+		if hasAnyPrefix(k, folders) {
+			values[k] = v
+		}
+	}
+	for _, k := range keys {
+		if v, ok := kv.data[k]; ok {
+			values[k] = v
+		}
+	}
+	return values, kv.index, nil
+}
+
+func (kv *fakeKV) Wait(ctx context.Context, prefix string, waitIndex uint64) (uint64, error) {
+	stop := context.AfterFunc(ctx, func() {
+		kv.mu.Lock()
+		kv.cond.Broadcast()
+		kv.mu.Unlock()
+	})
+	defer stop()
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	for waitIndex != 0 && kv.index <= waitIndex && ctx.Err() == nil {
+		kv.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return kv.index, nil
+}
+
+type dbConfig struct {
+	Host    string        `consul:"host" validate:"nonzero"`
+	Port    int           `consul:"port" default:"3306"`
+	Timeout time.Duration `consul:"timeout" default:"1s"`
+}
+
+type server struct {
+	Addr   string `consul:"addr"`
+	Weight int    `consul:"weight" default:"1"`
+}
+
+type appConfig struct {
+	Name    string            `consul:"name"`
+	Debug   bool              `consul:"debug" default:"false"`
+	Tags    []string          `consul:"tags" default:""`
+	Labels  map[string]string `consul:"labels" default:""`
+	DB      dbConfig          `consul:"db"`
+	Cache   *dbConfig         `consul:"cache"`
+	Servers []server          `consul:"servers"`
+	Ignored string
+}
+
+func TestUnmarshal(t *testing.T) {
+	kv := newFakeKV(map[string]string{
+		"app/name":             "demo",
+		"app/debug":            "true",
+		"app/tags":             "a, b",
+		"app/labels":           `{"zone":"bj"}`,
+		"app/db/host":          "10.0.0.1",
+		"app/servers/0/addr":   "s0:80",
+		"app/servers/1/addr":   "s1:80",
+		"app/servers/1/weight": "5",
+		"other/name":           "ignored",
+	})
+	g := New(&ConsulSource{kv: kv, prefix: "app/"})
+
+	var c appConfig
+	assert.Equal(t, nil, g.Unmarshal(&c))
+	assert.Equal(t, "demo", c.Name)
+	assert.Equal(t, true, c.Debug)
+	assert.Equal(t, []string{"a", "b"}, c.Tags)
+	assert.Equal(t, map[string]string{"zone": "bj"}, c.Labels)
+	assert.Equal(t, dbConfig{Host: "10.0.0.1", Port: 3306, Timeout: time.Second}, c.DB)
+	assert.Equal(t, (*dbConfig)(nil), c.Cache)
+	assert.Equal(t, []server{{"s0:80", 1}, {"s1:80", 5}}, c.Servers)
+}
+
+func TestUnmarshalRoot(t *testing.T) {
+	kv := newFakeKV(map[string]string{
+		"name":           "demo",
+		"db/host":        "h",
+		"servers/0/addr": "s0:80",
+		"other/name":     "ignored",
+	})
+	s := &ConsulSource{kv: kv}
+
+	var c appConfig
+	assert.Equal(t, nil, New(s).Unmarshal(&c))
+	assert.Equal(t, "demo", c.Name)
+	assert.Equal(t, []server{{"s0:80", 1}}, c.Servers)
+	assert.Equal(t, 0, kv.lists)
+	// only the declared keys are read
+	_, ok := s.values["other/name"]
+	assert.Equal(t, false, ok)
+
+	_, err := s.Load(context.Background())
+	assert.Equal(t, ErrNoPrefix, err)
+}
+
+func TestUnmarshalMissingKey(t *testing.T) {
+	kv := newFakeKV(map[string]string{"db/host": "h"})
+	g := New(&ConsulSource{kv: kv})
+
+	var c appConfig
+	err := g.Unmarshal(&c)
+	assert.Equal(t, true, errors.Is(err, ErrKeyNotFound))
+	assert.Equal(t, true, strings.HasSuffix(err.Error(), ": name"))
+
+	kv.Put("name", "demo")
+	assert.Equal(t, nil, g.Unmarshal(&c))
+	assert.Equal(t, map[string]string(nil), c.Labels)
+
+	// a folder with a missing required key
+	kv.Put("servers/0/weight", "2")
+	err = g.Unmarshal(&c)
+	assert.Equal(t, true, errors.Is(err, ErrKeyNotFound))
+	assert.Equal(t, true, strings.HasSuffix(err.Error(), ": servers/0/addr"))
+}
+
+func TestUnmarshalValidation(t *testing.T) {
+	kv := newFakeKV(map[string]string{"name": "demo", "db/port": "1"})
+	g := New(&ConsulSource{kv: kv})
+
+	c := appConfig{Name: "old"}
+	err := g.Unmarshal(&c)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, "old", c.Name) // untouched on error
+
+	kv.Put("db/port", "x")
+	kv.Put("db/host", "h")
+	assert.NotEqual(t, nil, g.Unmarshal(&c))
+}
+
+func TestUnmarshalFallbacks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "app.json")
+	assert.Equal(t, nil, ioutil.WriteFile(fn, []byte(`{
+		"name": "from-file",
+		"db": {"host": "file-host", "port": 3307},
+		"servers": [{"addr": "f0:80"}],
+		"labels": {"zone": "sh"}
+	}`), 0644))
+
+	os.Setenv("TESTAPP_DB_PORT", "3308")
+	os.Setenv("TESTAPP_DEBUG", "true")
+	defer os.Unsetenv("TESTAPP_DB_PORT")
+	defer os.Unsetenv("TESTAPP_DEBUG")
+
+	kv := newFakeKV(map[string]string{"name": "from-consul"})
+	g := New(&ConsulSource{kv: kv}).WithFile(fn).WithEnv("TESTAPP_")
+
+	var c appConfig
+	assert.Equal(t, nil, g.Unmarshal(&c))
+	assert.Equal(t, "from-consul", c.Name)
+	assert.Equal(t, true, c.Debug)
+	assert.Equal(t, "file-host", c.DB.Host)
+	assert.Equal(t, 3307, c.DB.Port)
+	assert.Equal(t, []server{{"f0:80", 1}}, c.Servers)
+	assert.Equal(t, map[string]string{"zone": "sh"}, c.Labels)
+}
+
+func TestWatch(t *testing.T) {
+	kv := newFakeKV(map[string]string{"name": "v1", "db/host": "h"})
+	g := New(&ConsulSource{kv: kv})
+
+	var c appConfig
+	changed := make(chan struct{}, 10)
+	w, err := g.Watch(&c, func() { changed <- struct{}{} })
+	assert.Equal(t, nil, err)
+	defer w.Stop()
+	assert.Equal(t, "v1", c.Name)
+
+	kv.Put("name", "v2")
+	<-changed
+	w.RLock()
+	assert.Equal(t, "v2", c.Name)
+	w.RUnlock()
+
+	// keys not read are no change
+	kv.Put("other/name", "x")
+	select {
+	case <-changed:
+		t.Fatal("unexpected change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// invalid update is not applied
+	kv.Put("db/port", "not a number")
+	kv.Put("name", "v3")
+	select {
+	case <-changed:
+		t.Fatal("unexpected change")
+	case <-time.After(50 * time.Millisecond):
+	}
+	w.RLock()
+	assert.Equal(t, "v2", c.Name)
+	w.RUnlock()
+}
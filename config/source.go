@@ -0,0 +1,59 @@
+package config
+
+import (
+	"context"
+	"strings"
+)
+
+// Source provides configuration as key value pairs whose keys are slash
+// separated paths, e.g. "db/host".
+type Source interface {
+	// Load fetches the current content of the source.
+	Load(ctx context.Context) (Snapshot, error)
+}
+
+// Watchable is a Source that can tell when its content changes.
+type Watchable interface {
+	Source
+
+	// Changed blocks till the content changes after the last Load,
+	// or ctx is done.
+	Changed(ctx context.Context) error
+}
+
+// KeyedSource is a Source able to load only some keys, for those too large
+// to be loaded whole, e.g. the root of a consul KV.
+type KeyedSource interface {
+	Source
+
+	// LoadKeys fetches keys and everything under folders, e.g. "db/".
+	LoadKeys(ctx context.Context, keys, folders []string) (Snapshot, error)
+}
+
+// Snapshot is the content of a Source at some point.
+type Snapshot interface {
+	Lookup(key string) ([]byte, bool)
+	HasPrefix(prefix string) bool
+}
+
+// Values is a Snapshot held in memory.
+type Values map[string][]byte
+
+func (m Values) Lookup(key string) ([]byte, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+func (m Values) HasPrefix(prefix string) bool {
+	for k := range m {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load makes Values a static Source.
+func (m Values) Load(ctx context.Context) (Snapshot, error) {
+	return m, nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+)
+
+type fileConfig struct {
+	Name    string   `config:"name"`
+	Port    int      `config:"db/port"`
+	Tags    []string `config:"tags" default:""`
+	Servers []server `config:"servers"`
+}
+
+var fileContents = map[string]string{
+	"app.json": `{"name": "demo", "db": {"port": 3306}, "tags": ["a", "b"],
+		"servers": [{"addr": "s0:80"}, {"addr": "s1:80", "weight": 5}]}`,
+	"app.yaml": `
+name: demo
+db:
+  port: 3306
+tags: [a, b]
+servers:
+  - addr: s0:80
+  - addr: s1:80
+    weight: 5
+`,
+	"app.toml": `
+name = "demo"
+tags = ["a", "b"]
+
+[db]
+port = 3306
+
+[[servers]]
+addr = "s0:80"
+
+[[servers]]
+addr = "s1:80"
+weight = 5
+`,
+}
+
+func TestFileSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	for name, content := range fileContents {
+		fn := filepath.Join(dir, name)
+		assert.Equal(t, nil, ioutil.WriteFile(fn, []byte(content), 0644))
+
+		var c fileConfig
+		assert.Equal(t, nil, New(NewFileSource(fn)).Unmarshal(&c), name)
+		assert.Equal(t, fileConfig{
+			Name:    "demo",
+			Port:    3306,
+			Tags:    []string{"a", "b"},
+			Servers: []server{{"s0:80", 1}, {"s1:80", 5}},
+		}, c, name)
+	}
+}
+
+func TestSourcePrecedence(t *testing.T) {
+	os.Setenv("PRECEDENCE_NAME", "from-env")
+	os.Setenv("PRECEDENCE_DB_PORT", "1")
+	defer os.Unsetenv("PRECEDENCE_NAME")
+	defer os.Unsetenv("PRECEDENCE_DB_PORT")
+
+	g := New(
+		Values{"name": []byte("from-values")},
+		NewEnvSource("PRECEDENCE_"),
+		Values{"db/port": []byte("2"), "tags": []byte("x")},
+	)
+
+	var c fileConfig
+	assert.Equal(t, nil, g.Unmarshal(&c))
+	assert.Equal(t, "from-values", c.Name)
+	assert.Equal(t, 1, c.Port)
+	assert.Equal(t, []string{"x"}, c.Tags)
+}
+
+func TestLoad(t *testing.T) {
+	g := New(
+		Values{"name": []byte("demo")},
+		Values{"name": []byte("x"), "db/port": []byte("3306"), "tags": []byte("a, b")},
+	)
+
+	var port int
+	ok, err := g.Get("db/port", &port)
+	assert.Equal(t, false, ok) // not loaded yet
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, nil, g.Load(context.Background()))
+	name, ok := g.Lookup("name")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "demo", string(name))
+
+	ok, err = g.Get("db/port", &port)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3306, port)
+
+	var tags []string
+	ok, err = g.Get("tags", &tags)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	ok, err = g.Get("name", &port)
+	assert.Equal(t, true, ok)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 3306, port) // untouched on error
+
+	ok, err = g.Get("db/host", &name)
+	assert.Equal(t, false, ok)
+	assert.Equal(t, nil, err)
+}
+
+func TestWatchFile(t *testing.T) {
+	PollInterval = 10 * time.Millisecond
+	defer func() { PollInterval = 5 * time.Second }()
+
+	dir, err := ioutil.TempDir("", "config")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "app.json")
+	assert.Equal(t, nil, ioutil.WriteFile(fn, []byte(`{"name": "v1", "db": {"port": 1}}`), 0644))
+
+	var c fileConfig
+	changed := make(chan struct{}, 10)
+	w, err := New(NewFileSource(fn)).Watch(&c, func() { changed <- struct{}{} })
+	assert.Equal(t, nil, err)
+	defer w.Stop()
+
+	assert.Equal(t, nil, ioutil.WriteFile(fn, []byte(`{"name": "v2", "db": {"port": 1}}`), 0644))
+	os.Chtimes(fn, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	<-changed
+
+	w.RLock()
+	assert.Equal(t, "v2", c.Name)
+	w.RUnlock()
+}
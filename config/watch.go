@@ -0,0 +1,115 @@
+package config
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// RetryInterval is how long a Watcher waits after a source fails.
+var RetryInterval = 5 * time.Second
+
+// Watcher keeps a struct in sync with the Watchable sources of a Gosh.
+//
+// Updates are stored while holding the write lock of the Watcher, so
+// readers that need a consistent view while an update may happen should
+// hold its read lock.
+type Watcher struct {
+	sync.RWMutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Watch unmarshals v and then keeps it up to date, calling onChange after
+// each update. Changes are detected on the sources implementing Watchable,
+// e.g. with blocking queries on consul.
+//
+// An update is applied only if the whole struct decodes and validates,
+// otherwise it's logged and v keeps its previous value.
+func (g *Gosh) Watch(v interface{}, onChange func()) (*Watcher, error) {
+	snapshots, err := g.load(context.Background(), v)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{}
+	if err = apply(v, snapshots, w); err != nil {
+		return nil, err
+	}
+
+	var ctx context.Context
+	ctx, w.cancel = context.WithCancel(context.Background())
+	changed := make(chan struct{}, 1)
+	for _, s := range g.sources {
+		if ws, ok := s.(Watchable); ok {
+			w.wg.Add(1)
+			go w.watch(ctx, ws, changed)
+		}
+	}
+
+	w.wg.Add(1)
+	go w.run(ctx, g, v, changed, onChange)
+	return w, nil
+}
+
+// Stop stops watching and waits for the background goroutines to exit.
+func (w *Watcher) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+func (w *Watcher) watch(ctx context.Context, s Watchable, changed chan<- struct{}) {
+	defer w.wg.Done()
+
+	for {
+		err := s.Changed(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.Printf("config watch: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(RetryInterval):
+			}
+			continue
+		}
+
+		select {
+		case changed <- struct{}{}:
+		default:
+			// a reload is already pending
+		}
+	}
+}
+
+func (w *Watcher) run(ctx context.Context, g *Gosh, v interface{}, changed <-chan struct{}, onChange func()) {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+
+		snapshots, err := g.load(ctx, v)
+		if err == nil {
+			err = apply(v, snapshots, w)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("config watch: %v", err)
+			}
+			continue
+		}
+
+		if onChange != nil {
+			onChange()
+		}
+	}
+}
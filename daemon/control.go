@@ -0,0 +1,126 @@
+// +build linux darwin
+
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cjysmat/golib/locking"
+	"github.com/cjysmat/golib/signal"
+)
+
+// Status returns the pid of the running daemon, or ErrNotRunning if no
+// process holds the pid file lock.
+func Status(pidFile string) (int, error) {
+	f, err := os.Open(pidFile)
+	if os.IsNotExist(err) {
+		return 0, ErrNotRunning
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if err = locking.Flock(f, time.Nanosecond); err == nil {
+		locking.Funlock(f)
+		return 0, ErrNotRunning
+	} else if err != locking.ErrTimeout {
+		return 0, err
+	}
+
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(body)))
+}
+
+// Stop sends SIGTERM to the daemon and waits for it to exit.
+func Stop(opts Options) error {
+	if _, err := Status(opts.PidFile); err != nil {
+		return err
+	}
+
+	if err := signal.SignalProcessByPidFile(opts.PidFile, syscall.SIGTERM); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(stopTimeout(opts))
+	for time.Now().Before(deadline) {
+		if _, err := Status(opts.PidFile); err == ErrNotRunning {
+			os.Remove(opts.PidFile)
+			return nil
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return ErrStopTimeout
+}
+
+// Reload sends SIGHUP to the daemon.
+func Reload(opts Options) error {
+	if _, err := Status(opts.PidFile); err != nil {
+		return err
+	}
+
+	return signal.SignalProcessByPidFile(opts.PidFile, syscall.SIGHUP)
+}
+
+// Control runs one of the start, stop, restart, status and reload actions,
+// typically taken from the command line. It returns nil in the daemon
+// process only, exiting once stop, status or reload succeeded:
+//
+//	if err := daemon.Control(os.Args[1], opts); err != nil {
+//		fmt.Fprintln(os.Stderr, err)
+//		os.Exit(1)
+//	}
+//	// daemon work goes here
+//
+// The daemon is run with opts.Args, os.Args[1:] by default.
+func Control(action string, opts Options) error {
+	if os.Getenv(envDaemonized) != "" {
+		// the daemon is run with the same action as its parent
+		return Daemonize(opts)
+	}
+
+	var err error
+	switch action {
+	case "start":
+		return Daemonize(opts)
+
+	case "restart":
+		if err = Stop(opts); err != nil && err != ErrNotRunning {
+			return err
+		}
+		return Daemonize(opts)
+
+	case "stop":
+		err = Stop(opts)
+
+	case "reload":
+		err = Reload(opts)
+
+	case "status":
+		var pid int
+		if pid, err = Status(opts.PidFile); err == nil {
+			fmt.Printf("running, pid %d\n", pid)
+		}
+
+	default:
+		err = fmt.Errorf("daemon: unknown action %q", action)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	os.Exit(0)
+	return nil
+}
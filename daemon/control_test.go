@@ -0,0 +1,62 @@
+// +build linux darwin
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+	"github.com/cjysmat/golib/locking"
+)
+
+func TestStatus(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "test.pid")
+	_, err := Status(pidFile)
+	assert.Equal(t, ErrNotRunning, err)
+
+	f, err := os.OpenFile(pidFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString(strconv.Itoa(os.Getpid()))
+
+	// stale pid file
+	_, err = Status(pidFile)
+	assert.Equal(t, ErrNotRunning, err)
+
+	assert.Equal(t, nil, locking.Flock(f, time.Second))
+	pid, err := Status(pidFile)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, os.Getpid(), pid)
+
+	locking.Funlock(f)
+	_, err = Status(pidFile)
+	assert.Equal(t, ErrNotRunning, err)
+}
+
+func TestControl(t *testing.T) {
+	opts := Options{PidFile: filepath.Join(t.TempDir(), "test.pid")}
+	assert.Equal(t, ErrNotRunning, Control("stop", opts))
+	assert.Equal(t, ErrNotRunning, Control("reload", opts))
+	assert.Equal(t, ErrNotRunning, Control("status", opts))
+	assert.NotEqual(t, nil, Control("bogus", opts))
+}
+
+func TestCredential(t *testing.T) {
+	cred, err := credential("", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, cred == nil)
+
+	cred, err = credential("0", "0")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(0), cred.Uid)
+	assert.Equal(t, uint32(0), cred.Gid)
+
+	_, err = credential("no-such-user-really", "")
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,210 @@
+// +build linux darwin
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/cjysmat/golib/locking"
+)
+
+const envDaemonized = "GOLIB_DAEMONIZED"
+
+var (
+	ErrAlreadyRunning = errors.New("daemon: already running")
+	ErrNotRunning     = errors.New("daemon: not running")
+	ErrStopTimeout    = errors.New("daemon: stop timeout")
+)
+
+// Options describes how to detach a process into a daemon.
+type Options struct {
+	// PidFile holds the daemon pid, locked as long as the daemon runs.
+	PidFile string
+
+	// LogFile receives stdout, and stderr too if ErrFile is empty.
+	// Empty means /dev/null.
+	LogFile string
+	ErrFile string
+
+	// WorkDir defaults to "/".
+	WorkDir string
+
+	// User and Group, names or numeric ids, the daemon runs as.
+	// Empty means unchanged.
+	User  string
+	Group string
+
+	// Args passed to the daemon instead of os.Args[1:].
+	Args []string
+
+	// StopTimeout is how long Stop waits for the daemon to exit, 10s by
+	// default.
+	StopTimeout time.Duration
+}
+
+// pidFile is kept open, thus locked, for the whole daemon life.
+var pidFile *os.File
+
+// Daemonize detaches the current program into a background daemon.
+//
+// The program is re-executed in a new session, with stdio redirected and
+// privileges dropped, and the calling process exits. In the daemon process
+// Daemonize changes the work dir, writes the pid file and returns nil, so
+// the program just goes on with its work after the call.
+//
+// It returns ErrAlreadyRunning if another daemon holds the pid file.
+func Daemonize(opts Options) error {
+	if os.Getenv(envDaemonized) != "" {
+		return setupDaemon(opts)
+	}
+
+	cmd, err := daemonCommand(opts)
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	os.Exit(0)
+	return nil
+}
+
+func daemonCommand(opts Options) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	args := opts.Args
+	if args == nil {
+		args = os.Args[1:]
+	}
+
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), envDaemonized+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if cmd.SysProcAttr.Credential, err = credential(opts.User, opts.Group); err != nil {
+		return nil, err
+	}
+
+	// the files are opened here with the privileges of the caller, and
+	// inherited by the daemon
+	if cmd.Stdout, err = openLog(opts.LogFile); err != nil {
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+	if opts.ErrFile != "" {
+		if cmd.Stderr, err = openLog(opts.ErrFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.PidFile != "" {
+		f, err := os.OpenFile(opts.PidFile, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		// the lock is shared with the daemon through the inherited
+		// descriptor and outlives this process
+		if err = locking.Flock(f, time.Nanosecond); err == locking.ErrTimeout {
+			return nil, ErrAlreadyRunning
+		} else if err != nil {
+			return nil, err
+		}
+
+		if cred := cmd.SysProcAttr.Credential; cred != nil {
+			f.Chown(int(cred.Uid), int(cred.Gid))
+		}
+		cmd.ExtraFiles = []*os.File{f}
+	}
+
+	return cmd, nil
+}
+
+func setupDaemon(opts Options) error {
+	os.Unsetenv(envDaemonized)
+
+	workDir := opts.WorkDir
+	if workDir == "" {
+		workDir = "/"
+	}
+	if err := os.Chdir(workDir); err != nil {
+		return err
+	}
+
+	if opts.PidFile == "" {
+		return nil
+	}
+
+	// fd 3 is the first of cmd.ExtraFiles, inherited without
+	// close-on-exec: set it, or the processes the daemon runs would
+	// hold the lock after it died
+	syscall.CloseOnExec(3)
+	pidFile = os.NewFile(3, opts.PidFile)
+	if err := pidFile.Truncate(0); err != nil {
+		return err
+	}
+	_, err := pidFile.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	return err
+}
+
+func openLog(fn string) (*os.File, error) {
+	if fn == "" {
+		return os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	}
+
+	return os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func credential(username, group string) (*syscall.Credential, error) {
+	if username == "" && group == "" {
+		return nil, nil
+	}
+
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			if u, err = user.LookupId(username); err != nil {
+				return nil, err
+			}
+		}
+
+		uid, _ := strconv.Atoi(u.Uid)
+		gid, _ := strconv.Atoi(u.Gid)
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return nil, err
+			}
+		}
+
+		gid, _ := strconv.Atoi(g.Gid)
+		cred.Gid = uint32(gid)
+	}
+
+	return cred, nil
+}
+
+func stopTimeout(opts Options) time.Duration {
+	if opts.StopTimeout > 0 {
+		return opts.StopTimeout
+	}
+	return 10 * time.Second
+}
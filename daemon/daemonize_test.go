@@ -0,0 +1,102 @@
+// +build linux darwin
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	ossignal "os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+)
+
+// TestDaemonHelper is the program daemonized by TestDaemonize.
+func TestDaemonHelper(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	dir := os.Getenv("DAEMON_TEST_DIR")
+	err := Daemonize(Options{
+		PidFile: filepath.Join(dir, "test.pid"),
+		Args:    []string{"-test.run=^TestDaemonHelper$"},
+	})
+	if err == ErrAlreadyRunning {
+		os.Exit(2)
+	} else if err != nil {
+		os.Exit(1)
+	}
+
+	// in the daemon: run a child outliving it
+	child := exec.Command("sleep", "60")
+	if err = child.Start(); err != nil {
+		os.Exit(1)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "child.pid"), []byte(strconv.Itoa(child.Process.Pid)), 0644)
+
+	c := make(chan os.Signal, 1)
+	ossignal.Notify(c, syscall.SIGTERM)
+	<-c
+	os.Exit(0)
+}
+
+func startHelper(dir string) error {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDaemonHelper$")
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1", "DAEMON_TEST_DIR="+dir)
+	return cmd.Run()
+}
+
+func TestDaemonize(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "test.pid")
+	childFile := filepath.Join(dir, "child.pid")
+	defer func() {
+		if b, err := ioutil.ReadFile(childFile); err == nil {
+			if pid, err := strconv.Atoi(string(b)); err == nil {
+				syscall.Kill(pid, syscall.SIGKILL)
+			}
+		}
+	}()
+
+	if err := startHelper(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		pid int
+		err error
+	)
+	for i := 0; i < 100; i++ {
+		_, errChild := os.Stat(childFile)
+		if pid, err = Status(pidFile); err == nil && errChild == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal("daemon not running: ", err)
+	}
+	b, _ := ioutil.ReadFile(pidFile)
+	assert.Equal(t, strconv.Itoa(pid), strings.TrimSpace(string(b)))
+	assert.Equal(t, nil, syscall.Kill(pid, 0))
+
+	// the pid file is locked
+	err = startHelper(dir)
+	if e, ok := err.(*exec.ExitError); !ok || e.ExitCode() != 2 {
+		t.Fatal("second start should fail as already running: ", err)
+	}
+
+	// the lock goes with the daemon, not with the child it left running
+	assert.Equal(t, nil, Stop(Options{PidFile: pidFile, StopTimeout: 5 * time.Second}))
+	_, err = Status(pidFile)
+	assert.Equal(t, ErrNotRunning, err)
+	_, err = os.Stat(pidFile)
+	assert.Equal(t, true, os.IsNotExist(err))
+}
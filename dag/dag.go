@@ -2,9 +2,16 @@
 package dag
 
 import (
+	"errors"
 	"fmt"
 	"github.com/cjysmat/golib/str"
 	"os"
+	"sort"
+)
+
+var (
+	ErrVertexNotFound = errors.New("dag: vertex not found")
+	ErrCycle          = errors.New("dag: edge would create a cycle")
 )
 
 type Dag struct {
@@ -17,6 +24,7 @@ type Node struct {
 
 	indegree int
 	children []*Node
+	parents  []*Node
 }
 
 func New() *Dag {
@@ -31,11 +39,75 @@ func (this *Dag) AddVertex(name string, val interface{}) *Node {
 	return node
 }
 
-func (this *Dag) AddEdge(from, to string) {
-	fromNode := this.nodes[from]
-	toNode := this.nodes[to]
+// Vertex returns the node of the given name, nil if not found.
+func (this *Dag) Vertex(name string) *Node {
+	return this.nodes[name]
+}
+
+// RemoveVertex removes the node along with all its edges.
+func (this *Dag) RemoveVertex(name string) error {
+	node, present := this.nodes[name]
+	if !present {
+		return ErrVertexNotFound
+	}
+
+	for _, parent := range node.parents {
+		parent.children = removeNode(parent.children, node)
+	}
+	for _, child := range node.children {
+		child.parents = removeNode(child.parents, node)
+		child.indegree--
+	}
+	delete(this.nodes, name)
+	return nil
+}
+
+// AddEdge adds an edge from -> to, refusing the ones that would create a
+// cycle. Adding an existing edge is a no-op.
+func (this *Dag) AddEdge(from, to string) error {
+	fromNode, present := this.nodes[from]
+	if !present {
+		return ErrVertexNotFound
+	}
+	toNode, present := this.nodes[to]
+	if !present {
+		return ErrVertexNotFound
+	}
+
+	if from == to || this.HasPathTo(to, from) {
+		return ErrCycle
+	}
+
+	for _, child := range fromNode.children {
+		if child == toNode {
+			return nil
+		}
+	}
+
 	fromNode.children = append(fromNode.children, toNode)
+	toNode.parents = append(toNode.parents, fromNode)
 	toNode.indegree++
+	return nil
+}
+
+// RemoveEdge removes the edge from -> to if present.
+func (this *Dag) RemoveEdge(from, to string) error {
+	fromNode, present := this.nodes[from]
+	if !present {
+		return ErrVertexNotFound
+	}
+	toNode, present := this.nodes[to]
+	if !present {
+		return ErrVertexNotFound
+	}
+
+	n := len(fromNode.children)
+	fromNode.children = removeNode(fromNode.children, toNode)
+	if len(fromNode.children) < n {
+		toNode.parents = removeNode(toNode.parents, fromNode)
+		toNode.indegree--
+	}
+	return nil
 }
 
 func (this *Dag) MakeDotGraph(fn string) string {
@@ -55,8 +127,100 @@ func (this *Dag) MakeDotGraph(fn string) string {
 	return sb.String()
 }
 
-func (this *Dag) HasPathTo(that string) bool {
-	return false
+// HasPathTo tells whether to is reachable from the vertex from.
+func (this *Dag) HasPathTo(from, to string) bool {
+	fromNode, present := this.nodes[from]
+	if !present {
+		return false
+	}
+	toNode, present := this.nodes[to]
+	if !present {
+		return false
+	}
+
+	found := false
+	fromNode.walk(func(n *Node) []*Node { return n.children }, func(n *Node) bool {
+		found = n == toNode
+		return !found
+	})
+	return found
+}
+
+// TopologicalSort returns all the nodes such that each node comes before
+// its children. Nodes whose order is free are sorted by name.
+func (this *Dag) TopologicalSort() []*Node {
+	indegree := make(map[*Node]int, len(this.nodes))
+	ready := make(nodesByName, 0)
+	for _, node := range this.nodes {
+		indegree[node] = node.indegree
+		if node.indegree == 0 {
+			ready = append(ready, node)
+		}
+	}
+
+	sorted := make([]*Node, 0, len(this.nodes))
+	for len(ready) > 0 {
+		sort.Sort(ready)
+		node := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, node)
+
+		for _, child := range node.children {
+			indegree[child]--
+			if indegree[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+
+	return sorted
+}
+
+// Ancestors returns the nodes that have a path to the named vertex, sorted
+// by name.
+func (this *Dag) Ancestors(name string) []*Node {
+	return this.reachable(name, func(n *Node) []*Node { return n.parents })
+}
+
+// Descendants returns the nodes reachable from the named vertex, sorted
+// by name.
+func (this *Dag) Descendants(name string) []*Node {
+	return this.reachable(name, func(n *Node) []*Node { return n.children })
+}
+
+func (this *Dag) reachable(name string, next func(*Node) []*Node) []*Node {
+	node, present := this.nodes[name]
+	if !present {
+		return nil
+	}
+
+	nodes := make(nodesByName, 0)
+	node.walk(next, func(n *Node) bool {
+		nodes = append(nodes, n)
+		return true
+	})
+	sort.Sort(nodes)
+	return nodes
+}
+
+// TransitiveReduction removes the edges implied by other paths: if a -> b,
+// b -> c and a -> c, the edge a -> c is removed.
+func (this *Dag) TransitiveReduction() {
+	for _, node := range this.nodes {
+		for _, child := range append([]*Node(nil), node.children...) {
+			redundant := false
+			for _, other := range node.children {
+				if other != child && this.HasPathTo(other.name, child.name) {
+					redundant = true
+					break
+				}
+			}
+
+			if redundant {
+				this.RemoveEdge(node.name, child.name)
+			}
+		}
+	}
 }
 
 func (this *Node) dotGraph(sb *str.StringBuilder) {
@@ -71,6 +235,53 @@ func (this *Node) dotGraph(sb *str.StringBuilder) {
 	}
 }
 
+func (this *Node) Name() string {
+	return this.name
+}
+
+func (this *Node) Val() interface{} {
+	return this.val
+}
+
 func (this *Node) Children() []*Node {
 	return this.children
 }
+
+func (this *Node) Parents() []*Node {
+	return this.parents
+}
+
+// walk visits depth first the nodes reachable through next, excluding
+// this node itself, till visit returns false.
+func (this *Node) walk(next func(*Node) []*Node, visit func(*Node) bool) {
+	seen := map[*Node]bool{this: true}
+	stack := append([]*Node(nil), next(this)...)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[n] {
+			continue
+		}
+
+		seen[n] = true
+		if !visit(n) {
+			return
+		}
+		stack = append(stack, next(n)...)
+	}
+}
+
+func removeNode(nodes []*Node, node *Node) []*Node {
+	for i, n := range nodes {
+		if n == node {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+type nodesByName []*Node
+
+func (s nodesByName) Len() int           { return len(s) }
+func (s nodesByName) Less(i, j int) bool { return s[i].name < s[j].name }
+func (s nodesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -2,6 +2,8 @@ package dag
 
 import (
 	"testing"
+
+	"github.com/cjysmat/assert"
 )
 
 func TestMakeDotFile(t *testing.T) {
@@ -16,3 +18,70 @@ func TestMakeDotFile(t *testing.T) {
 	d.MakeDotGraph("test.dot")
 	t.Logf("dot -o test.png -T png test.dot")
 }
+
+// a -> b -> d -> e
+// a -> c -> d
+func buildDag() *Dag {
+	d := New()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		d.AddVertex(name, nil)
+	}
+	d.AddEdge("a", "b")
+	d.AddEdge("a", "c")
+	d.AddEdge("b", "d")
+	d.AddEdge("c", "d")
+	d.AddEdge("d", "e")
+	return d
+}
+
+func names(nodes []*Node) []string {
+	r := make([]string, len(nodes))
+	for i, n := range nodes {
+		r[i] = n.Name()
+	}
+	return r
+}
+
+func TestAddEdge(t *testing.T) {
+	d := buildDag()
+	assert.Equal(t, ErrCycle, d.AddEdge("e", "a"))
+	assert.Equal(t, ErrCycle, d.AddEdge("a", "a"))
+	assert.Equal(t, ErrVertexNotFound, d.AddEdge("a", "x"))
+	assert.Equal(t, nil, d.AddEdge("a", "b"))
+	assert.Equal(t, 1, len(d.Vertex("b").Parents()))
+	assert.Equal(t, true, d.HasPathTo("a", "e"))
+	assert.Equal(t, false, d.HasPathTo("e", "a"))
+	assert.Equal(t, false, d.HasPathTo("b", "c"))
+}
+
+func TestTopologicalSort(t *testing.T) {
+	d := buildDag()
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, names(d.TopologicalSort()))
+}
+
+func TestAncestorsDescendants(t *testing.T) {
+	d := buildDag()
+	assert.Equal(t, []string{"a", "b", "c"}, names(d.Ancestors("d")))
+	assert.Equal(t, []string{"b", "c", "d", "e"}, names(d.Descendants("a")))
+	assert.Equal(t, 0, len(d.Descendants("e")))
+	assert.Equal(t, 0, len(d.Ancestors("x")))
+}
+
+func TestTransitiveReduction(t *testing.T) {
+	d := buildDag()
+	d.AddEdge("a", "d")
+	d.AddEdge("a", "e")
+	d.TransitiveReduction()
+	assert.Equal(t, []string{"b", "c"}, names(d.Vertex("a").Children()))
+	assert.Equal(t, true, d.HasPathTo("a", "e"))
+}
+
+func TestRemoveVertex(t *testing.T) {
+	d := buildDag()
+	assert.Equal(t, nil, d.RemoveVertex("d"))
+	assert.Equal(t, ErrVertexNotFound, d.RemoveVertex("d"))
+	assert.Equal(t, 0, len(d.Vertex("b").Children()))
+	assert.Equal(t, 0, len(d.Vertex("e").Parents()))
+	assert.Equal(t, false, d.HasPathTo("a", "e"))
+	assert.Equal(t, []string{"a", "b", "c", "e"}, names(d.TopologicalSort()))
+}
@@ -0,0 +1,126 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrSkipped = errors.New("dag: skipped due to upstream failure")
+)
+
+// RunError maps the name of each vertex that didn't succeed to its error:
+// the error returned by the run func, ErrSkipped, or the context error for
+// the vertices not started once the context is done.
+type RunError map[string]error
+
+func (err RunError) Error() string {
+	names := make([]string, 0, len(err))
+	for name := range err {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, err[name])
+	}
+	return strings.Join(msgs, ", ")
+}
+
+type runResult struct {
+	node *Node
+	err  error
+}
+
+// Run calls fn on every vertex in dependency order, a vertex starting once
+// all its parents succeeded, with at most concurrency calls in parallel.
+// Zero concurrency means no limit.
+//
+// When fn fails on a vertex, its descendants are skipped while the other
+// vertices keep running. To stop everything on the first failure, cancel
+// ctx from fn: no more vertices are started once ctx is done.
+//
+// The dag must not be modified while running.
+func (this *Dag) Run(ctx context.Context, concurrency int, fn func(*Node) error) error {
+	if concurrency <= 0 {
+		concurrency = len(this.nodes)
+	}
+
+	var (
+		indegree = make(map[*Node]int, len(this.nodes))
+		failed   = make(map[*Node]bool)
+		done     = make(map[*Node]bool, len(this.nodes))
+		ready    = make(nodesByName, 0)
+		results  = make(chan runResult)
+		running  = 0
+		errs     = make(RunError)
+	)
+
+	for _, node := range this.nodes {
+		indegree[node] = node.indegree
+		if node.indegree == 0 {
+			ready = append(ready, node)
+		}
+	}
+
+	// complete marks node as finished and releases its children; children
+	// of a failed node are completed right away as skipped.
+	var complete func(node *Node, err error)
+	complete = func(node *Node, err error) {
+		done[node] = true
+		if err != nil {
+			errs[node.name] = err
+		}
+
+		for _, child := range node.children {
+			if err != nil {
+				failed[child] = true
+			}
+
+			indegree[child]--
+			if indegree[child] > 0 {
+				continue
+			}
+			if failed[child] {
+				complete(child, ErrSkipped)
+			} else {
+				ready = append(ready, child)
+			}
+		}
+	}
+
+	for {
+		sort.Sort(ready)
+		for running < concurrency && len(ready) > 0 && ctx.Err() == nil {
+			node := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				results <- runResult{node: node, err: fn(node)}
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		complete(r.node, r.err)
+	}
+
+	for _, node := range this.nodes {
+		if !done[node] {
+			errs[node.name] = ctx.Err()
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
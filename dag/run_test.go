@@ -0,0 +1,100 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cjysmat/assert"
+)
+
+func TestRun(t *testing.T) {
+	d := buildDag()
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	err := d.Run(context.Background(), 2, func(n *Node) error {
+		mu.Lock()
+		order = append(order, n.Name())
+		mu.Unlock()
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, len(order))
+
+	pos := make(map[string]int)
+	for i, name := range order {
+		pos[name] = i
+	}
+	for _, node := range d.TopologicalSort() {
+		for _, child := range node.Children() {
+			assert.Equal(t, true, pos[node.Name()] < pos[child.Name()])
+		}
+	}
+}
+
+func TestRunConcurrency(t *testing.T) {
+	d := New()
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		d.AddVertex(name, nil)
+	}
+
+	var current, peak int32
+	err := d.Run(context.Background(), 2, func(n *Node) error {
+		c := atomic.AddInt32(&current, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if c <= p || atomic.CompareAndSwapInt32(&peak, p, c) {
+				break
+			}
+		}
+		atomic.AddInt32(&current, -1)
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, atomic.LoadInt32(&peak) <= 2)
+}
+
+func TestRunSkipsDownstream(t *testing.T) {
+	d := buildDag()
+	boom := errors.New("boom")
+
+	var ran sync.Map
+	err := d.Run(context.Background(), 0, func(n *Node) error {
+		ran.Store(n.Name(), true)
+		if n.Name() == "b" {
+			return boom
+		}
+		return nil
+	})
+
+	errs, ok := err.(RunError)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 3, len(errs))
+	assert.Equal(t, boom, errs["b"])
+	assert.Equal(t, ErrSkipped, errs["d"])
+	assert.Equal(t, ErrSkipped, errs["e"])
+
+	_, ok = ran.Load("c")
+	assert.Equal(t, true, ok)
+	_, ok = ran.Load("d")
+	assert.Equal(t, false, ok)
+}
+
+func TestRunCancel(t *testing.T) {
+	d := buildDag()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := d.Run(ctx, 1, func(n *Node) error {
+		cancel()
+		return nil
+	})
+
+	errs := err.(RunError)
+	assert.Equal(t, 4, len(errs))
+	assert.Equal(t, context.Canceled, errs["e"])
+}
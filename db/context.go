@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cjysmat/golib/retrier"
+)
+
+// DefaultRetryBackoff is the backoff of the retries on deadlock and
+// serialization failures, see IsRetryable.
+var DefaultRetryBackoff = retrier.ExponentialBackoff(3, 20*time.Millisecond)
+
+// Open is like NewSqlDb but returns the error instead of panic.
+// A nil logger logs to stderr.
+func Open(driver, dsn string, logger *log.Logger) (*SqlDb, error) {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	this := new(SqlDb)
+	this.driver = driver
+	this.dsn = dsn
+	this.logger = logger
+	this.retrier = retrier.New(DefaultRetryBackoff, retryClassifier{})
+
+	var err error
+	if this.db, err = sql.Open(this.driver, this.dsn); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+// SetSlowThreshold makes the statements running at least d logged.
+// Zero disables the slow query log.
+func (this *SqlDb) SetSlowThreshold(d time.Duration) {
+	this.slowThreshold = d
+}
+
+// SetRetryBackoff sets how many times and how long after a retryable
+// failure a statement or a transaction is retried. Nil disables retries.
+func (this *SqlDb) SetRetryBackoff(backoff []time.Duration) {
+	this.retrier = retrier.New(backoff, retryClassifier{})
+}
+
+func (this *SqlDb) QueryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	err = this.retry(ctx, func(ctx context.Context) error {
+		defer this.logQuery(time.Now(), query, args)
+
+		rows, err = this.db.QueryContext(ctx, query, args...)
+		return err
+	})
+	return
+}
+
+// QueryRowContext is not retried as the error is deferred to Scan.
+func (this *SqlDb) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer this.logQuery(time.Now(), query, args)
+
+	return this.db.QueryRowContext(ctx, query, args...)
+}
+
+func (this *SqlDb) ExecContext(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	err = this.retry(ctx, func(ctx context.Context) error {
+		defer this.logQuery(time.Now(), query, args)
+
+		res, err = this.db.ExecContext(ctx, query, args...)
+		return err
+	})
+	return
+}
+
+func (this *SqlDb) retry(ctx context.Context, work func(ctx context.Context) error) error {
+	if this.retrier == nil {
+		return work(ctx)
+	}
+
+	return this.retrier.RunCtx(ctx, work)
+}
+
+func (this *SqlDb) logQuery(start time.Time, query string, args []interface{}) {
+	if this.debug {
+		this.logger.Printf("%s, args=%+v\n", query, args)
+	}
+
+	if elapsed := time.Since(start); this.slowThreshold > 0 && elapsed >= this.slowThreshold {
+		this.logger.Printf("slow query %s: %s, args=%+v\n", elapsed, query, args)
+	}
+}
@@ -6,9 +6,12 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/cjysmat/golib/retrier"
+	"github.com/go-sql-driver/mysql"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"strings"
+	"time"
 )
 
 const (
@@ -22,25 +25,47 @@ type SqlDb struct {
 	debug  bool
 	logger *log.Logger
 	db     *sql.DB
+
+	slowThreshold time.Duration
+	retrier       *retrier.Retrier
 }
 
+// NewSqlDb panics if the db can't be opened, see Open.
 func NewSqlDb(driver, dsn string, logger *log.Logger) *SqlDb {
-	this := new(SqlDb)
-	this.driver = driver
-	this.dsn = dsn
-	this.logger = logger
-	this.debug = false
-
-	// conn to db
-	var err error
-	this.db, err = sql.Open(this.driver, this.dsn)
-	this.checkError(err, dsn)
+	this, err := Open(driver, dsn, logger)
+	if err != nil {
+		panic(fmt.Sprintf("%s[%s]: %s", driver, redactDsn(driver, dsn), err.Error()))
+	}
 
 	return this
 }
 
+// String shows the dsn without its secrets, see redactDsn.
 func (this SqlDb) String() string {
-	return fmt.Sprintf("%s[%s]", this.driver, this.dsn)
+	return fmt.Sprintf("%s[%s]", this.driver, redactDsn(this.driver, this.dsn))
+}
+
+// redactDsn masks the password of a mysql dsn and drops the parameters of
+// a sqlite3 one, which may hold a key. The dsn of other drivers isn't
+// shown at all.
+func redactDsn(driver, dsn string) string {
+	switch driver {
+	case DRIVER_MYSQL:
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "?"
+		}
+		if cfg.Passwd != "" {
+			cfg.Passwd = "xxx"
+		}
+		return cfg.FormatDSN()
+	case DRIVER_SQLITE3:
+		if i := strings.IndexByte(dsn, '?'); i >= 0 {
+			return dsn[:i]
+		}
+		return dsn
+	}
+	return "?"
 }
 
 func (this *SqlDb) SetDebug(d bool) {
@@ -76,6 +101,7 @@ func (this *SqlDb) CreateDb(createTableSql string) {
 	}
 }
 
+// Query panics on error, see QueryContext.
 func (this *SqlDb) Query(query string, args ...interface{}) *sql.Rows {
 	if this.debug {
 		this.logger.Printf("%s, args=%+v\n", query, args)
@@ -95,6 +121,7 @@ func (this *SqlDb) QueryRow(query string, args ...interface{}) *sql.Row {
 	return this.db.QueryRow(query, args...)
 }
 
+// ExecSql panics on error, see ExecContext.
 func (this *SqlDb) ExecSql(query string, args ...interface{}) (afftectedRows int64) {
 	if this.debug {
 		this.logger.Printf("%s, args=%+v\n", query, args)
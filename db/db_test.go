@@ -0,0 +1,199 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+	"github.com/cjysmat/golib/retrier"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestExecContextRetry(t *testing.T) {
+	db, stub := newStub(nil)
+	db.SetRetryBackoff(retrier.ConstantBackoff(3, 0))
+
+	fails := 2
+	stub.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		if fails > 0 {
+			fails--
+			return nil, &mysql.MySQLError{Number: mysqlDeadlock}
+		}
+		return driver.RowsAffected(5), nil
+	}
+
+	res, err := db.ExecContext(context.Background(), "UPDATE t SET a=?", 1)
+	assert.Equal(t, nil, err)
+	n, _ := res.RowsAffected()
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, 3, stub.execs)
+
+	// not retryable
+	boom := errors.New("boom")
+	stub.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return nil, boom
+	}
+	_, err = db.ExecContext(context.Background(), "UPDATE t SET a=?", 1)
+	assert.Equal(t, boom, err)
+	assert.Equal(t, 4, stub.execs)
+}
+
+func TestRetryCanceled(t *testing.T) {
+	db, stub := newStub(nil)
+	db.SetRetryBackoff(retrier.ConstantBackoff(3, time.Hour))
+	stub.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return nil, stateError(sqlStateSerializationFailure)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := db.ExecContext(ctx, "DELETE FROM t")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, stub.execs)
+}
+
+func TestQueryContext(t *testing.T) {
+	db, stub := newStub(nil)
+	stub.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		assert.Equal(t, int64(7), args[0].Value)
+		return &stubRows{
+			cols: []string{"id", "name"},
+			data: [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}},
+		}, nil
+	}
+
+	rows, err := db.QueryContext(context.Background(), "SELECT id, name FROM t WHERE x=?", 7)
+	assert.Equal(t, nil, err)
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var (
+			id   int
+			name string
+		)
+		assert.Equal(t, nil, rows.Scan(&id, &name))
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	var name string
+	assert.Equal(t, nil, db.QueryRowContext(context.Background(), "SELECT", 7).Scan(new(int), &name))
+	assert.Equal(t, "a", name)
+}
+
+func TestWithTx(t *testing.T) {
+	db, stub := newStub(nil)
+	ctx := context.Background()
+
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO t VALUES(?)", 1)
+		return err
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, stub.commits)
+	assert.Equal(t, 0, stub.rollbacks)
+
+	boom := errors.New("boom")
+	err = db.WithTx(ctx, func(tx *Tx) error {
+		return boom
+	})
+	assert.Equal(t, boom, err)
+	assert.Equal(t, 1, stub.commits)
+	assert.Equal(t, 1, stub.rollbacks)
+
+	func() {
+		defer func() {
+			assert.Equal(t, "oops", recover())
+		}()
+
+		db.WithTx(ctx, func(tx *Tx) error {
+			panic("oops")
+		})
+	}()
+	assert.Equal(t, 1, stub.commits)
+	assert.Equal(t, 2, stub.rollbacks)
+}
+
+func TestWithTxRetry(t *testing.T) {
+	db, stub := newStub(nil)
+	db.SetRetryBackoff(retrier.ConstantBackoff(3, 0))
+	ctx := context.Background()
+
+	fails := 1
+	stub.commit = func() error {
+		if fails > 0 {
+			fails--
+			return stateError(sqlStateSerializationFailure)
+		}
+		return nil
+	}
+
+	runs := 0
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		runs++
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, 2, stub.begins)
+	assert.Equal(t, 2, stub.commits)
+
+	// retryable error from fn rolls back then retries
+	runs = 0
+	err = db.WithTx(ctx, func(tx *Tx) error {
+		runs++
+		if runs == 1 {
+			return &mysql.MySQLError{Number: mysqlLockWaitTimeout}
+		}
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, 1, stub.rollbacks)
+}
+
+func TestSlowQuery(t *testing.T) {
+	var buf bytes.Buffer
+	db, _ := newStub(&buf)
+	ctx := context.Background()
+
+	db.ExecContext(ctx, "UPDATE fast")
+	assert.Equal(t, "", buf.String())
+
+	db.SetSlowThreshold(time.Nanosecond)
+	db.ExecContext(ctx, "UPDATE slow")
+	db.WithTx(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE intx")
+		return err
+	})
+	assert.Equal(t, true, strings.Contains(buf.String(), "slow query"))
+	assert.Equal(t, true, strings.Contains(buf.String(), "UPDATE slow"))
+	assert.Equal(t, true, strings.Contains(buf.String(), "UPDATE intx"))
+}
+
+func TestString(t *testing.T) {
+	db := &SqlDb{driver: DRIVER_MYSQL, dsn: "user:secret@tcp(db:3306)/app?parseTime=true"}
+	assert.Equal(t, false, strings.Contains(db.String(), "secret"))
+	assert.Equal(t, true, strings.Contains(db.String(), "user:xxx@tcp(db:3306)/app"))
+
+	db = &SqlDb{driver: DRIVER_SQLITE3, dsn: "file:app.db?_auth_user=u&_auth_pass=secret"}
+	assert.Equal(t, "sqlite3[file:app.db]", db.String())
+
+	db = &SqlDb{driver: "stub", dsn: "secret"}
+	assert.Equal(t, "stub[?]", db.String())
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.Equal(t, false, IsRetryable(nil))
+	assert.Equal(t, false, IsRetryable(errors.New("x")))
+	assert.Equal(t, true, IsRetryable(&mysql.MySQLError{Number: mysqlDeadlock}))
+	assert.Equal(t, false, IsRetryable(&mysql.MySQLError{Number: 1062}))
+	assert.Equal(t, true, IsRetryable(stateError(sqlStateDeadlockDetected)))
+	assert.Equal(t, false, IsRetryable(stateError("23505")))
+}
@@ -0,0 +1,451 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjysmat/golib/locking"
+)
+
+var (
+	ErrNoDownMigration = errors.New("db: no down migration")
+	ErrNoMigrationLock = errors.New("db: no migration lock for the driver")
+)
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// advisoryLocks are the statements taking and releasing a named lock held
+// by the connection, per driver.
+var advisoryLocks = map[string]struct{ lock, unlock string }{
+	DRIVER_MYSQL: {"SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)"},
+}
+
+// memoryLocks lock the in-memory sqlite databases, shared within the
+// process only: dsn -> semaphore.
+var memoryLocks = struct {
+	sync.Mutex
+	m map[string]chan struct{}
+}{m: make(map[string]chan struct{})}
+
+// Migration is a schema change, loaded from the files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, the latter being
+// optional.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// DriftError reports an applied migration whose up file changed since.
+type DriftError struct {
+	Version  int64
+	Name     string
+	Applied  string
+	Checksum string
+}
+
+func (err *DriftError) Error() string {
+	return fmt.Sprintf("db: migration %d_%s changed since applied, checksum %s != %s",
+		err.Version, err.Name, err.Checksum, err.Applied)
+}
+
+// Migrator applies migrations to a SqlDb, recording the applied versions
+// in a bookkeeping table.
+//
+// Each migration is applied in its own transaction, with a lock held for
+// the whole run so that concurrent instances don't race: an advisory lock
+// on mysql, and a flock of the database file plus ".lock" on sqlite.
+// Other drivers fail with ErrNoMigrationLock. Note that mysql commits DDL
+// statements implicitly.
+type Migrator struct {
+	// Table is the bookkeeping table, "schema_migrations" by default.
+	Table string
+
+	db         *SqlDb
+	migrations []*Migration // sorted by version
+}
+
+// LoadMigrations loads the migrations of dir in fsys, which is typically
+// an embed.FS or os.DirFS.
+func LoadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := migrationFileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, present := byVersion[version]
+		if !present {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("db: migration %d named both %s and %s", version, m.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("db: migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// NewMigrator loads the migrations of dir in fsys, see LoadMigrations.
+func NewMigrator(db *SqlDb, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{Table: "schema_migrations", db: db, migrations: migrations}, nil
+}
+
+// Up applies all the pending migrations.
+func (this *Migrator) Up(ctx context.Context) error {
+	if len(this.migrations) == 0 {
+		return nil
+	}
+
+	return this.To(ctx, this.migrations[len(this.migrations)-1].Version)
+}
+
+// Down rolls back the last applied migration.
+func (this *Migrator) Down(ctx context.Context) error {
+	return this.locked(ctx, func(applied map[int64]string) error {
+		var last *Migration
+		for _, m := range this.migrations {
+			if _, present := applied[m.Version]; present {
+				last = m
+			}
+		}
+
+		if last == nil {
+			return nil
+		}
+		return this.rollback(ctx, last)
+	})
+}
+
+// To applies the pending migrations up to version included, and rolls
+// back the applied ones above it, the latest first.
+func (this *Migrator) To(ctx context.Context, version int64) error {
+	return this.locked(ctx, func(applied map[int64]string) error {
+		for _, m := range this.migrations {
+			if _, present := applied[m.Version]; !present && m.Version <= version {
+				if err := this.apply(ctx, m); err != nil {
+					return err
+				}
+			}
+		}
+
+		for i := len(this.migrations) - 1; i >= 0; i-- {
+			m := this.migrations[i]
+			if _, present := applied[m.Version]; present && m.Version > version {
+				if err := this.rollback(ctx, m); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Version returns the latest applied version, 0 if none.
+func (this *Migrator) Version(ctx context.Context) (int64, error) {
+	if err := this.createTable(ctx); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	err := this.db.QueryRowContext(ctx, "SELECT MAX(version) FROM "+this.Table).Scan(&version)
+	return version.Int64, err
+}
+
+// locked runs fn with the migration lock held, once the applied
+// migrations are checked for drift.
+func (this *Migrator) locked(ctx context.Context, fn func(applied map[int64]string) error) error {
+	if err := this.createTable(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := this.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	applied, err := this.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range this.migrations {
+		if checksum, present := applied[m.Version]; present && checksum != m.Checksum {
+			return &DriftError{Version: m.Version, Name: m.Name, Applied: checksum, Checksum: m.Checksum}
+		}
+	}
+
+	return fn(applied)
+}
+
+// lock takes the migration lock of the driver.
+func (this *Migrator) lock(ctx context.Context) (unlock func(), err error) {
+	if this.db.driver == DRIVER_SQLITE3 {
+		return this.lockSqlite(ctx)
+	}
+
+	advisory, present := advisoryLocks[this.db.driver]
+	if !present {
+		return nil, ErrNoMigrationLock
+	}
+
+	// the lock belongs to the session, hence a dedicated connection
+	conn, err := this.db.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := "migrate:" + this.Table
+	var ok sql.NullInt64
+	if err = conn.QueryRowContext(ctx, advisory.lock, name).Scan(&ok); err == nil && ok.Int64 != 1 {
+		err = fmt.Errorf("db: can't lock %s", name)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), advisory.unlock, name)
+		conn.Close()
+	}, nil
+}
+
+// lockSqlite flocks the file of the database plus ".lock", a sqlite
+// database being shared by the processes of one host at most. In-memory
+// databases are locked within the process.
+func (this *Migrator) lockSqlite(ctx context.Context) (unlock func(), err error) {
+	fn := strings.TrimPrefix(this.db.dsn, "file:")
+	if i := strings.IndexByte(fn, '?'); i >= 0 {
+		fn = fn[:i]
+	}
+
+	if fn == "" || fn == ":memory:" || strings.Contains(this.db.dsn, "mode=memory") {
+		memoryLocks.Lock()
+		sem, present := memoryLocks.m[this.db.dsn]
+		if !present {
+			sem = make(chan struct{}, 1)
+			memoryLocks.m[this.db.dsn] = sem
+		}
+		memoryLocks.Unlock()
+
+		select {
+		case sem <- struct{}{}:
+			return func() { <-sem }, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	f, err := os.OpenFile(fn+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		// polls every 50ms
+		if err = locking.Flock(f, time.Nanosecond); err == nil {
+			return func() {
+				locking.Funlock(f)
+				f.Close()
+			}, nil
+		} else if err != locking.ErrTimeout {
+			f.Close()
+			return nil, err
+		}
+
+		if err = ctx.Err(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+}
+
+func (this *Migrator) createTable(ctx context.Context) error {
+	_, err := this.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+this.Table+` (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	return err
+}
+
+// applied returns the checksums of the applied versions.
+func (this *Migrator) applied(ctx context.Context) (map[int64]string, error) {
+	var rows []struct {
+		Version  int64
+		Checksum string
+	}
+	if err := this.db.SelectInto(ctx, &rows, "SELECT version, checksum FROM "+this.Table); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.Checksum
+	}
+	return applied, nil
+}
+
+func (this *Migrator) apply(ctx context.Context, m *Migration) error {
+	// a single attempt, as DDL commits implicitly on some databases, e.g.
+	// mysql, and running it again would apply it twice
+	err := this.db.runTx(ctx, nil, func(tx *Tx) error {
+		if err := execScript(ctx, tx, m.Up); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO "+this.Table+" (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+			m.Version, m.Name, m.Checksum, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("db: migration %d_%s up: %w", m.Version, m.Name, err)
+	}
+
+	this.db.logger.Printf("%s: migrated up to %d_%s\n", this.db, m.Version, m.Name)
+	return nil
+}
+
+func (this *Migrator) rollback(ctx context.Context, m *Migration) error {
+	if strings.TrimSpace(m.Down) == "" {
+		return fmt.Errorf("db: migration %d_%s: %w", m.Version, m.Name, ErrNoDownMigration)
+	}
+
+	// a single attempt, see apply
+	err := this.db.runTx(ctx, nil, func(tx *Tx) error {
+		if err := execScript(ctx, tx, m.Down); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "DELETE FROM "+this.Table+" WHERE version = ?", m.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("db: migration %d_%s down: %w", m.Version, m.Name, err)
+	}
+
+	this.db.logger.Printf("%s: migrated down from %d_%s\n", this.db, m.Version, m.Name)
+	return nil
+}
+
+// execScript runs the statements of script one by one, as not all the
+// drivers accept several statements at once.
+func execScript(ctx context.Context, tx *Tx, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits script on the semicolons outside of quotes and
+// comments. Statements embedding semicolons, such as trigger bodies, are
+// not supported.
+func splitStatements(script string) []string {
+	var (
+		stmts []string
+		start int
+		quote byte
+		code  bool // whether the current statement has more than comments
+	)
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			code = true
+
+		case strings.HasPrefix(script[i:], "--"), c == '#':
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+
+		case strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(script)
+			}
+
+		case c == ';':
+			if code {
+				stmts = append(stmts, strings.TrimSpace(script[start:i]))
+			}
+			start, code = i+1, false
+
+		case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+			code = true
+		}
+	}
+
+	if code {
+		stmts = append(stmts, strings.TrimSpace(script[start:]))
+	}
+	return stmts
+}
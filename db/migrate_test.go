@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cjysmat/assert"
+	"github.com/cjysmat/golib/retrier"
+	"github.com/go-sql-driver/mysql"
+)
+
+func migrationsFS() fstest.MapFS {
+	return fstest.MapFS{
+		"migrations/0001_users.up.sql": {Data: []byte(`
+-- users; with a comment
+CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(32));
+INSERT INTO users (name) VALUES ('a;b');
+`)},
+		"migrations/0001_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/0002_email.up.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN email VARCHAR(64)")},
+		"migrations/0002_email.down.sql": {Data: []byte("/* no-op */")},
+		"migrations/0003_posts.up.sql":   {Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY)")},
+		"migrations/0003_posts.down.sql": {Data: []byte("DROP TABLE posts")},
+		"migrations/README":              {Data: []byte("ignored")},
+	}
+}
+
+func openSqlite(t *testing.T) *SqlDb {
+	db, err := Open(DRIVER_SQLITE3, filepath.Join(t.TempDir(), "test.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(db *SqlDb, table string) bool {
+	var n int
+	db.GetInto(context.Background(), &n, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", table)
+	return n == 1
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationsFS(), "migrations")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(migrations))
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "users", migrations[0].Name)
+	assert.Equal(t, 64, len(migrations[0].Checksum))
+	assert.Equal(t, "DROP TABLE users;", migrations[0].Down)
+
+	fsys := migrationsFS()
+	fsys["migrations/0004_x.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	_, err = LoadMigrations(fsys, "migrations")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestMigrator(t *testing.T) {
+	db := openSqlite(t)
+	ctx := context.Background()
+
+	m, err := NewMigrator(db, migrationsFS(), "migrations")
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, nil, m.To(ctx, 2))
+	version, err := m.Version(ctx)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, false, tableExists(db, "posts"))
+
+	var name string
+	assert.Equal(t, nil, db.GetInto(ctx, &name, "SELECT name FROM users"))
+	assert.Equal(t, "a;b", name)
+
+	assert.Equal(t, nil, m.Up(ctx))
+	assert.Equal(t, true, tableExists(db, "posts"))
+	// idempotent
+	assert.Equal(t, nil, m.Up(ctx))
+
+	assert.Equal(t, nil, m.Down(ctx))
+	version, _ = m.Version(ctx)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, false, tableExists(db, "posts"))
+
+	assert.Equal(t, nil, m.To(ctx, 0))
+	version, _ = m.Version(ctx)
+	assert.Equal(t, int64(0), version)
+	assert.Equal(t, false, tableExists(db, "users"))
+}
+
+func TestMigratorDrift(t *testing.T) {
+	db := openSqlite(t)
+	ctx := context.Background()
+
+	m, _ := NewMigrator(db, migrationsFS(), "migrations")
+	assert.Equal(t, nil, m.To(ctx, 1))
+
+	fsys := migrationsFS()
+	fsys["migrations/0001_users.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE users (id INTEGER)")}
+	m, _ = NewMigrator(db, fsys, "migrations")
+	err := m.Up(ctx)
+	drift, ok := err.(*DriftError)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, int64(1), drift.Version)
+	assert.Equal(t, false, tableExists(db, "posts"))
+}
+
+func TestMigratorFailure(t *testing.T) {
+	db := openSqlite(t)
+	ctx := context.Background()
+
+	fsys := migrationsFS()
+	fsys["migrations/0003_posts.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE posts (id INTEGER); BOGUS")}
+	m, _ := NewMigrator(db, fsys, "migrations")
+	assert.NotEqual(t, nil, m.Up(ctx))
+
+	// the failed migration is rolled back as a whole
+	version, _ := m.Version(ctx)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, false, tableExists(db, "posts"))
+
+	fsys["migrations/0002_email.down.sql"] = &fstest.MapFile{Data: []byte("")}
+	m, _ = NewMigrator(db, fsys, "migrations")
+	assert.NotEqual(t, nil, m.Down(ctx))
+}
+
+func TestMigratorConcurrent(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000"
+
+	// a slow first migration, for the other runner to read the versions
+	// meanwhile
+	fsys := migrationsFS()
+	fsys["migrations/0001_users.up.sql"].Data = append(fsys["migrations/0001_users.up.sql"].Data,
+		"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 300000) SELECT COUNT(*) FROM c;"...)
+
+	start := make(chan struct{})
+	errs := make(chan error)
+	for i := 0; i < 2; i++ {
+		db, err := Open(DRIVER_SQLITE3, dsn, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		m, _ := NewMigrator(db, fsys, "migrations")
+		go func() {
+			<-start
+			errs <- m.Up(ctx)
+		}()
+	}
+	close(start)
+	// without the lock the second one applies the versions again
+	assert.Equal(t, nil, <-errs)
+	assert.Equal(t, nil, <-errs)
+
+	db, _ := Open(DRIVER_SQLITE3, dsn, nil)
+	defer db.Close()
+	var n int
+	assert.Equal(t, nil, db.GetInto(ctx, &n, "SELECT COUNT(*) FROM schema_migrations"))
+	assert.Equal(t, 3, n)
+	assert.Equal(t, nil, db.GetInto(ctx, &n, "SELECT COUNT(*) FROM users"))
+	assert.Equal(t, 1, n)
+}
+
+func TestMigratorNoLock(t *testing.T) {
+	db, _ := newStub(nil)
+	m, _ := NewMigrator(db, migrationsFS(), "migrations")
+	m.Table = "t"
+	_, err := m.lock(context.Background())
+	assert.Equal(t, ErrNoMigrationLock, err)
+}
+
+func TestMigrationSingleAttempt(t *testing.T) {
+	db, stub := newStub(nil)
+	db.SetRetryBackoff(retrier.ConstantBackoff(3, 0))
+	stub.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return nil, &mysql.MySQLError{Number: mysqlDeadlock}
+	}
+
+	m, _ := NewMigrator(db, migrationsFS(), "migrations")
+	err := m.apply(context.Background(), &Migration{Version: 1, Name: "a", Up: "CREATE TABLE a (id INT)"})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 1, stub.begins)
+	assert.Equal(t, 1, stub.execs)
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts := splitStatements(`
+-- comment; here
+CREATE TABLE a (s VARCHAR(8) DEFAULT ';');
+# mysql comment;
+/* block; */ INSERT INTO a VALUES ("x;y");
+;
+DELETE FROM a`)
+	assert.Equal(t, []string{
+		"-- comment; here\nCREATE TABLE a (s VARCHAR(8) DEFAULT ';')",
+		"# mysql comment;\n/* block; */ INSERT INTO a VALUES (\"x;y\")",
+		"DELETE FROM a",
+	}, stmts)
+	assert.Equal(t, 0, len(splitStatements("/* only */ -- comments")))
+}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrEmptySlice = errors.New("db: empty slice argument")
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// Named binds the `:name` parameters of query to the values of arg, a map
+// with string keys or a struct whose fields are named as in SelectInto.
+// It returns the query with `?` placeholders and the matching args, the
+// slice values being expanded as by In:
+//
+//	query, args, err := db.Named("SELECT * FROM t WHERE a = :a AND id IN (:ids)", map[string]interface{}{
+//		"a":   1,
+//		"ids": []int{1, 2, 3},
+//	})
+//
+// `::` is kept as is, and so are the colons in quoted strings.
+func Named(query string, arg interface{}) (string, []interface{}, error) {
+	lookup, err := namedLookup(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		sb    strings.Builder
+		args  []interface{}
+		quote byte
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			sb.WriteString("::")
+			i++
+			continue
+
+		case c == ':' && i+1 < len(query) && isNameChar(query[i+1]):
+			j := i + 1
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+
+			name := query[i+1 : j]
+			val, present := lookup(name)
+			if !present {
+				return "", nil, fmt.Errorf("db: no value for parameter :%s", name)
+			}
+
+			if args, err = bindArg(&sb, args, val); err != nil {
+				return "", nil, err
+			}
+			i = j - 1
+			continue
+		}
+
+		sb.WriteByte(c)
+	}
+
+	return sb.String(), args, nil
+}
+
+// In expands the slice arguments of query into as many placeholders as
+// the slice has elements:
+//
+//	query, args, err := db.In("SELECT * FROM t WHERE id IN (?) AND a = ?", []int{1, 2, 3}, 4)
+//	// SELECT * FROM t WHERE id IN (?, ?, ?) AND a = ?  [1 2 3 4]
+//
+// []byte and driver.Valuer arguments are not expanded.
+func In(query string, args ...interface{}) (string, []interface{}, error) {
+	var (
+		sb      strings.Builder
+		newArgs = make([]interface{}, 0, len(args))
+		quote   byte
+		n       int
+		err     error
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+
+		case c == '?':
+			if n >= len(args) {
+				return "", nil, fmt.Errorf("db: more placeholders than the %d args", len(args))
+			}
+
+			if newArgs, err = bindArg(&sb, newArgs, args[n]); err != nil {
+				return "", nil, err
+			}
+			n++
+			continue
+		}
+
+		sb.WriteByte(c)
+	}
+
+	if n != len(args) {
+		return "", nil, fmt.Errorf("db: %d placeholders for %d args", n, len(args))
+	}
+
+	return sb.String(), newArgs, nil
+}
+
+// NamedExecContext is ExecContext with the parameters bound by Named.
+func (this *SqlDb) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	query, args, err := Named(query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return this.ExecContext(ctx, query, args...)
+}
+
+func (this *Tx) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	query, args, err := Named(query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return this.ExecContext(ctx, query, args...)
+}
+
+// bindArg writes the placeholders of val and appends it to args.
+func bindArg(sb *strings.Builder, args []interface{}, val interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(val)
+	if !isExpandable(v) {
+		sb.WriteByte('?')
+		return append(args, val), nil
+	}
+
+	if v.Len() == 0 {
+		return nil, ErrEmptySlice
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('?')
+		args = append(args, v.Index(i).Interface())
+	}
+	return args, nil
+}
+
+func isExpandable(v reflect.Value) bool {
+	if !v.IsValid() || v.Type().Implements(valuerType) {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Array:
+		return true
+	}
+	return false
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '.' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func namedLookup(arg interface{}) (func(string) (interface{}, bool), error) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		return func(name string) (interface{}, bool) {
+			val, present := m[name]
+			return val, present
+		}, nil
+	}
+
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("db: named arg must be a map[string]interface{} or a struct, got %T", arg)
+	}
+
+	fields := fieldMap(v.Type())
+	return func(name string) (interface{}, bool) {
+		index, present := fields[strings.ToLower(name)]
+		if !present {
+			return nil, false
+		}
+
+		fv := v
+		for i, x := range index {
+			if i > 0 && fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					return nil, true
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(x)
+		}
+		return fv.Interface(), true
+	}, nil
+}
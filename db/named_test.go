@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/cjysmat/assert"
+)
+
+func TestNamed(t *testing.T) {
+	q, args, err := Named("SELECT * FROM t WHERE a = :a AND id IN (:ids) AND b = ':x' AND c::int = :a", map[string]interface{}{
+		"a":   1,
+		"ids": []int{7, 8, 9},
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "SELECT * FROM t WHERE a = ? AND id IN (?, ?, ?) AND b = ':x' AND c::int = ?", q)
+	assert.Equal(t, []interface{}{1, 7, 8, 9, 1}, args)
+
+	nick := "n"
+	user := scanUser{Name: "a", Nick: &nick}
+	user.ID = 5
+	q, args, err = Named("UPDATE u SET name=:name, nick=:nick, editor=:editor WHERE id=:id", &user)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "UPDATE u SET name=?, nick=?, editor=? WHERE id=?", q)
+	assert.Equal(t, []interface{}{"a", &nick, nil, int64(5)}, args)
+
+	_, _, err = Named("SELECT :missing", map[string]interface{}{})
+	assert.NotEqual(t, nil, err)
+	_, _, err = Named("SELECT :ids", map[string]interface{}{"ids": []int{}})
+	assert.Equal(t, ErrEmptySlice, err)
+	_, _, err = Named("SELECT :a", 1)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestIn(t *testing.T) {
+	q, args, err := In("SELECT * FROM t WHERE id IN (?) AND a = ? AND b = '?' AND c = ?", []int64{1, 2}, "x", []byte("raw"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "SELECT * FROM t WHERE id IN (?, ?) AND a = ? AND b = '?' AND c = ?", q)
+	assert.Equal(t, []interface{}{int64(1), int64(2), "x", []byte("raw")}, args)
+
+	_, _, err = In("SELECT ?, ?", 1)
+	assert.NotEqual(t, nil, err)
+	_, _, err = In("SELECT ?", 1, 2)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestNamedExecContext(t *testing.T) {
+	db, stub := newStub(nil)
+
+	var gotQuery string
+	var gotArgs []interface{}
+	stub.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		gotQuery = query
+		for _, arg := range args {
+			gotArgs = append(gotArgs, arg.Value)
+		}
+		return driver.RowsAffected(2), nil
+	}
+
+	_, err := db.NamedExecContext(context.Background(), "DELETE FROM t WHERE id IN (:ids)", map[string]interface{}{"ids": []int64{1, 2}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "DELETE FROM t WHERE id IN (?, ?)", gotQuery)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, gotArgs)
+}
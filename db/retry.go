@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+
+	"github.com/cjysmat/golib/retrier"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	mysqlLockWaitTimeout = 1205
+	mysqlDeadlock        = 1213
+
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// IsRetryable tells whether err is a transient failure the statement or
+// transaction can be retried on: a deadlock, a lock wait timeout, a
+// serialization failure, or a busy sqlite3 database.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if err == driver.ErrBadConn {
+		// database/sql already retried on a fresh connection
+		return false
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlDeadlock || myErr.Number == mysqlLockWaitTimeout
+	}
+
+	var liteErr sqlite3.Error
+	if errors.As(err, &liteErr) {
+		return liteErr.Code == sqlite3.ErrBusy || liteErr.Code == sqlite3.ErrLocked
+	}
+
+	// postgres drivers
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		state := stateErr.SQLState()
+		return state == sqlStateSerializationFailure || state == sqlStateDeadlockDetected
+	}
+
+	return false
+}
+
+type retryClassifier struct{}
+
+func (retryClassifier) Classify(err error) retrier.Action {
+	if err == nil {
+		return retrier.Succeed
+	}
+
+	if IsRetryable(err) {
+		return retrier.Retry
+	}
+
+	return retrier.Fail
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBadDest = errors.New("db: dest must be a non-nil pointer")
+
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+
+	// struct type -> map[column][]int field index
+	fieldMaps sync.Map
+)
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// SelectInto runs the query and scans all the rows into dest, a pointer
+// to a slice of structs, of pointers to structs, or of scalars for single
+// column results.
+//
+// Columns are mapped to the struct fields by their `db:"col"` tag, or
+// else by their lower cased name, fields of the embedded structs included.
+// A `db:"-"` field is ignored. NULL columns need a nullable field such as
+// sql.NullString or *string.
+func (this *SqlDb) SelectInto(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return selectInto(ctx, this, dest, query, args)
+}
+
+// GetInto is like SelectInto for a single row scanned into dest, a
+// pointer to a struct or a scalar. It returns sql.ErrNoRows if the query
+// selected nothing.
+func (this *SqlDb) GetInto(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return getInto(ctx, this, dest, query, args)
+}
+
+func (this *Tx) SelectInto(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return selectInto(ctx, this, dest, query, args)
+}
+
+func (this *Tx) GetInto(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return getInto(ctx, this, dest, query, args)
+}
+
+func selectInto(ctx context.Context, q queryer, dest interface{}, query string, args []interface{}) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return ScanRows(rows, dest)
+}
+
+func getInto(ctx context.Context, q queryer, dest interface{}, query string, args []interface{}) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return ScanRow(rows, dest)
+}
+
+// ScanRows scans all the rows into dest, see SelectInto.
+func ScanRows(rows *sql.Rows, dest interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return ErrBadDest
+	}
+
+	slice := dv.Elem()
+	elemType := slice.Type().Elem()
+	baseType := elemType
+	if elemType.Kind() == reflect.Ptr {
+		baseType = elemType.Elem()
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		elem := reflect.New(baseType)
+		targets, err := scanTargets(elem.Elem(), cols)
+		if err != nil {
+			return err
+		}
+
+		if err = rows.Scan(targets...); err != nil {
+			return err
+		}
+
+		if elemType.Kind() == reflect.Ptr {
+			slice.Set(reflect.Append(slice, elem))
+		} else {
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+
+	return rows.Err()
+}
+
+// ScanRow scans the first row into dest, see GetInto.
+func ScanRow(rows *sql.Rows, dest interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return ErrBadDest
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	targets, err := scanTargets(dv.Elem(), cols)
+	if err != nil {
+		return err
+	}
+
+	return rows.Scan(targets...)
+}
+
+func scanTargets(v reflect.Value, cols []string) ([]interface{}, error) {
+	if !isStruct(v.Type()) {
+		if len(cols) != 1 {
+			return nil, fmt.Errorf("db: scanning %d columns into %s", len(cols), v.Type())
+		}
+		return []interface{}{v.Addr().Interface()}, nil
+	}
+
+	fields := fieldMap(v.Type())
+	targets := make([]interface{}, len(cols))
+	for i, col := range cols {
+		index, present := fields[strings.ToLower(col)]
+		if !present {
+			return nil, fmt.Errorf("db: no field for column %q in %s", col, v.Type())
+		}
+
+		targets[i] = fieldByIndex(v, index).Addr().Interface()
+	}
+
+	return targets, nil
+}
+
+// isStruct tells whether t is a struct to be scanned field by field.
+func isStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(scannerType)
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, allocating the nil
+// embedded struct pointers on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func fieldMap(t reflect.Type) map[string][]int {
+	if m, present := fieldMaps.Load(t); present {
+		return m.(map[string][]int)
+	}
+
+	m := make(map[string][]int)
+	mapFields(t, nil, m)
+	fieldMaps.Store(t, m)
+	return m
+}
+
+// mapFields maps the columns of struct t, the outer fields hiding the
+// embedded ones of the same name.
+func mapFields(t reflect.Type, prefix []int, m map[string][]int) {
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+	var embeds []embedded
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+
+		index := append(append([]int(nil), prefix...), i)
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				if f.PkgPath != "" {
+					// can't be allocated
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if isStruct(ft) {
+				embeds = append(embeds, embedded{ft, index})
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			// unexported embedded non struct
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		name = strings.ToLower(name)
+		if _, present := m[name]; !present {
+			m[name] = index
+		}
+	}
+
+	for _, e := range embeds {
+		mapFields(e.t, e.index, m)
+	}
+}
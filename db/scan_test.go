@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+)
+
+type scanBase struct {
+	ID      int64     `db:"id"`
+	Created time.Time `db:"created_at"`
+}
+
+type ScanAudit struct {
+	Editor string `db:"editor"`
+}
+
+type scanUser struct {
+	scanBase
+	*ScanAudit
+
+	Name     string
+	Email    sql.NullString `db:"email"`
+	Nick     *string        `db:"nick"`
+	Password string         `db:"-"`
+}
+
+func stubRowsOf(cols []string, data ...[]driver.Value) func(string, []driver.NamedValue) (driver.Rows, error) {
+	return func(string, []driver.NamedValue) (driver.Rows, error) {
+		return &stubRows{cols: cols, data: data}, nil
+	}
+}
+
+func TestSelectInto(t *testing.T) {
+	db, stub := newStub(nil)
+	ctx := context.Background()
+	now := time.Now()
+
+	stub.query = stubRowsOf([]string{"id", "NAME", "email", "nick", "created_at", "editor"},
+		[]driver.Value{int64(1), "a", "a@x.com", "aa", now, "root"},
+		[]driver.Value{int64(2), "b", nil, nil, now, ""},
+	)
+
+	var users []scanUser
+	assert.Equal(t, nil, db.SelectInto(ctx, &users, "SELECT"))
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, int64(1), users[0].ID)
+	assert.Equal(t, now, users[0].Created)
+	assert.Equal(t, "a", users[0].Name)
+	assert.Equal(t, sql.NullString{String: "a@x.com", Valid: true}, users[0].Email)
+	assert.Equal(t, "aa", *users[0].Nick)
+	assert.Equal(t, "root", users[0].Editor)
+	assert.Equal(t, false, users[1].Email.Valid)
+	assert.Equal(t, true, users[1].Nick == nil)
+
+	var ptrs []*scanUser
+	assert.Equal(t, nil, db.SelectInto(ctx, &ptrs, "SELECT"))
+	assert.Equal(t, "b", ptrs[1].Name)
+
+	stub.query = stubRowsOf([]string{"id"}, []driver.Value{int64(3)}, []driver.Value{int64(4)})
+	var ids []int
+	assert.Equal(t, nil, db.SelectInto(ctx, &ids, "SELECT"))
+	assert.Equal(t, []int{3, 4}, ids)
+
+	stub.query = stubRowsOf([]string{"id", "bogus"}, []driver.Value{int64(3), "x"})
+	assert.NotEqual(t, nil, db.SelectInto(ctx, &users, "SELECT"))
+	assert.Equal(t, ErrBadDest, db.SelectInto(ctx, users, "SELECT"))
+}
+
+func TestGetInto(t *testing.T) {
+	db, stub := newStub(nil)
+	ctx := context.Background()
+
+	stub.query = stubRowsOf([]string{"id", "name"}, []driver.Value{int64(1), "a"})
+	var user scanUser
+	assert.Equal(t, nil, db.GetInto(ctx, &user, "SELECT"))
+	assert.Equal(t, int64(1), user.ID)
+	assert.Equal(t, "a", user.Name)
+	assert.Equal(t, true, user.ScanAudit == nil)
+
+	stub.query = stubRowsOf([]string{"n"}, []driver.Value{int64(42)})
+	var n int
+	assert.Equal(t, nil, db.GetInto(ctx, &n, "SELECT"))
+	assert.Equal(t, 42, n)
+
+	stub.query = stubRowsOf([]string{"n"})
+	assert.Equal(t, sql.ErrNoRows, db.GetInto(ctx, &n, "SELECT"))
+
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		return tx.GetInto(ctx, &n, "SELECT")
+	})
+	assert.Equal(t, sql.ErrNoRows, err)
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// stubDriver is an in-process database/sql driver whose behavior is
+// scripted by each test through a stubDb.
+type stubDriver struct{}
+
+var (
+	stubDbs   sync.Map // dsn -> *stubDb
+	stubDbSeq int64
+)
+
+func init() {
+	sql.Register("stub", stubDriver{})
+}
+
+type stubDb struct {
+	mu sync.Mutex
+
+	exec   func(query string, args []driver.NamedValue) (driver.Result, error)
+	query  func(query string, args []driver.NamedValue) (driver.Rows, error)
+	commit func() error
+
+	execs, queries, begins, commits, rollbacks int
+}
+
+// newStub returns a SqlDb on a fresh stubDb.
+func newStub(logger interface{ Write([]byte) (int, error) }) (*SqlDb, *stubDb) {
+	stub := &stubDb{}
+	dsn := fmt.Sprintf("stub%d", atomic.AddInt64(&stubDbSeq, 1))
+	stubDbs.Store(dsn, stub)
+
+	db, err := Open("stub", dsn, nil)
+	if err != nil {
+		panic(err)
+	}
+	if logger != nil {
+		db.logger.SetOutput(logger)
+	}
+	return db, stub
+}
+
+func (stubDriver) Open(dsn string) (driver.Conn, error) {
+	stub, ok := stubDbs.Load(dsn)
+	if !ok {
+		return nil, errors.New("stub: unknown dsn " + dsn)
+	}
+	return &stubConn{stub.(*stubDb)}, nil
+}
+
+type stubConn struct {
+	db *stubDb
+}
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("stub: prepare not supported")
+}
+
+func (c *stubConn) Close() error { return nil }
+
+func (c *stubConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	c.db.begins++
+	c.db.mu.Unlock()
+	return &stubTx{c.db}, nil
+}
+
+func (c *stubConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	c.db.execs++
+	exec := c.db.exec
+	c.db.mu.Unlock()
+
+	if exec == nil {
+		return driver.RowsAffected(0), nil
+	}
+	return exec(query, args)
+}
+
+func (c *stubConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	c.db.queries++
+	q := c.db.query
+	c.db.mu.Unlock()
+
+	if q == nil {
+		return &stubRows{}, nil
+	}
+	return q(query, args)
+}
+
+type stubTx struct {
+	db *stubDb
+}
+
+func (tx *stubTx) Commit() error {
+	tx.db.mu.Lock()
+	tx.db.commits++
+	commit := tx.db.commit
+	tx.db.mu.Unlock()
+
+	if commit == nil {
+		return nil
+	}
+	return commit()
+}
+
+func (tx *stubTx) Rollback() error {
+	tx.db.mu.Lock()
+	tx.db.rollbacks++
+	tx.db.mu.Unlock()
+	return nil
+}
+
+type stubRows struct {
+	cols []string
+	data [][]driver.Value
+	i    int
+}
+
+func (r *stubRows) Columns() []string { return r.cols }
+
+func (r *stubRows) Close() error { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.i])
+	r.i++
+	return nil
+}
+
+// stateError is a retryable error as reported by the postgres drivers.
+type stateError string
+
+func (e stateError) Error() string    { return "sqlstate " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
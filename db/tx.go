@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Tx is a sql.Tx whose statements are logged like the SqlDb ones.
+type Tx struct {
+	*sql.Tx
+
+	db *SqlDb
+}
+
+func (this *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer this.db.logQuery(time.Now(), query, args)
+
+	return this.Tx.QueryContext(ctx, query, args...)
+}
+
+func (this *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer this.db.logQuery(time.Now(), query, args)
+
+	return this.Tx.QueryRowContext(ctx, query, args...)
+}
+
+func (this *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer this.db.logQuery(time.Now(), query, args)
+
+	return this.Tx.ExecContext(ctx, query, args...)
+}
+
+// WithTx runs fn in a transaction, committed if fn returns nil and rolled
+// back if it returns an error or panics.
+//
+// The whole transaction is run again on retryable failures, so fn must
+// not have side effects outside of tx.
+func (this *SqlDb) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	return this.WithTxOptions(ctx, nil, fn)
+}
+
+// WithTxOptions is like WithTx with the given isolation level and
+// read-only flag.
+func (this *SqlDb) WithTxOptions(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	return this.retry(ctx, func(ctx context.Context) error {
+		return this.runTx(ctx, opts, fn)
+	})
+}
+
+func (this *SqlDb) runTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) (err error) {
+	tx, err := this.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(&Tx{Tx: tx, db: this}); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			this.logger.Printf("%s: rollback: %s\n", this, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,245 @@
+// Package balancer implements client side load balancing over the entries
+// of a discovery.Discovery.
+//
+// It takes over the endpoint set the callers of Discovery.Watch otherwise
+// keep themselves. No package of this repository balances on its own, so
+// the balancers it replaces are the ones of those callers, which switch by
+// feeding a Balancer instead of their own set.
+package balancer
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cjysmat/golib/discovery"
+)
+
+var (
+	ErrNoEndpoint = errors.New("balancer: no endpoint available")
+)
+
+// Picker picks an endpoint among the healthy ones.
+type Picker interface {
+	// Update replaces the endpoints to pick from.
+	Update(endpoints []*Endpoint)
+
+	// Pick returns an endpoint, nil if none, along with an optional
+	// func to be called with the outcome of the request. The key is
+	// only used by the pickers routing by key.
+	Pick(key string) (*Endpoint, func(err error))
+}
+
+// Endpoint is a discovery entry as seen by a Balancer.
+type Endpoint struct {
+	*discovery.Entry
+
+	// Weight is taken from the "weight" metadata of the entry, 1 by default.
+	Weight int
+
+	outstanding int64
+
+	// outlier ejection state, guarded by the balancer
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+func newEndpoint(entry *discovery.Entry) *Endpoint {
+	ep := &Endpoint{Entry: entry, Weight: 1}
+	if w, err := strconv.Atoi(entry.Meta["weight"]); err == nil && w > 0 {
+		ep.Weight = w
+	}
+	return ep
+}
+
+// Outstanding returns the number of requests picked and not done yet.
+func (ep *Endpoint) Outstanding() int64 {
+	return atomic.LoadInt64(&ep.outstanding)
+}
+
+// Picked is an endpoint handed out by a Balancer, Done must be called once
+// the request completes.
+type Picked struct {
+	*Endpoint
+
+	b    *Balancer
+	mark func(err error)
+	once sync.Once
+}
+
+// Done reports the outcome of the request to the endpoint.
+func (p *Picked) Done(err error) {
+	p.once.Do(func() {
+		atomic.AddInt64(&p.outstanding, -1)
+		if p.mark != nil {
+			p.mark(err)
+		}
+		p.b.report(p.Endpoint, err)
+	})
+}
+
+// Balancer keeps a live set of endpoints and picks among them, ejecting
+// the endpoints failing in a row for a while.
+type Balancer struct {
+	// MaxFailures in a row ejects an endpoint, 5 by default.
+	MaxFailures int
+
+	// EjectDuration is the base ejection time, multiplied by the number of
+	// times the endpoint was ejected, up to 10. 30s by default.
+	EjectDuration time.Duration
+
+	// MaxEjectionPercent of the endpoints ejected at most, 50 by default.
+	MaxEjectionPercent int
+
+	picker Picker
+
+	mu          sync.Mutex
+	endpoints   map[string]*Endpoint // by entry key
+	ejected     int
+	nextReadmit time.Time
+
+	now func() time.Time
+}
+
+// New is exported
+func New(picker Picker) *Balancer {
+	return &Balancer{
+		MaxFailures:        5,
+		EjectDuration:      30 * time.Second,
+		MaxEjectionPercent: 50,
+		picker:             picker,
+		endpoints:          make(map[string]*Endpoint),
+		now:                time.Now,
+	}
+}
+
+// Watch fetches the entries of d then keeps the balancer updated in the
+// background.
+func (b *Balancer) Watch(d discovery.Discovery) error {
+	entries, err := d.Fetch()
+	if err != nil {
+		return err
+	}
+
+	b.Update(entries)
+	go d.Watch(b.Update)
+	return nil
+}
+
+// Update replaces the endpoint set, keeping the state of the endpoints
+// whose entry didn't change. It is a discovery.WatchCallback.
+func (b *Balancer) Update(entries []*discovery.Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	endpoints := make(map[string]*Endpoint, len(entries))
+	b.ejected = 0
+	for _, entry := range entries {
+		ep, present := b.endpoints[entry.Key()]
+		if !present || !reflect.DeepEqual(ep.Entry, entry) {
+			ep = newEndpoint(entry)
+		}
+		endpoints[entry.Key()] = ep
+		if !ep.ejectedUntil.IsZero() {
+			b.ejected++
+		}
+	}
+
+	b.endpoints = endpoints
+	b.updatePicker()
+}
+
+// Endpoints returns all the endpoints, ejected ones included.
+func (b *Balancer) Endpoints() []*Endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	endpoints := make([]*Endpoint, 0, len(b.endpoints))
+	for _, ep := range b.endpoints {
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints
+}
+
+// Pick returns a healthy endpoint, whose Done must be called once the
+// request completes.
+func (b *Balancer) Pick(key string) (*Picked, error) {
+	b.mu.Lock()
+	if b.ejected > 0 && !b.now().Before(b.nextReadmit) {
+		b.readmit()
+	}
+	b.mu.Unlock()
+
+	ep, mark := b.picker.Pick(key)
+	if ep == nil {
+		return nil, ErrNoEndpoint
+	}
+
+	atomic.AddInt64(&ep.outstanding, 1)
+	return &Picked{Endpoint: ep, b: b, mark: mark}, nil
+}
+
+func (b *Balancer) report(ep *Endpoint, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		ep.failures = 0
+		return
+	}
+
+	ep.failures++
+	if ep.failures < b.MaxFailures || !ep.ejectedUntil.IsZero() ||
+		b.endpoints[ep.Key()] != ep || (b.ejected+1)*100 > len(b.endpoints)*b.MaxEjectionPercent {
+		return
+	}
+
+	if ep.ejections < 10 {
+		ep.ejections++
+	}
+	ep.ejectedUntil = b.now().Add(b.EjectDuration * time.Duration(ep.ejections))
+	if b.ejected == 0 || ep.ejectedUntil.Before(b.nextReadmit) {
+		b.nextReadmit = ep.ejectedUntil
+	}
+	b.ejected++
+	b.updatePicker()
+}
+
+// readmit puts back the endpoints whose ejection is over.
+func (b *Balancer) readmit() {
+	now := b.now()
+	b.ejected = 0
+	for _, ep := range b.endpoints {
+		if ep.ejectedUntil.IsZero() {
+			continue
+		}
+
+		if !now.Before(ep.ejectedUntil) {
+			ep.ejectedUntil = time.Time{}
+			ep.failures = 0
+			continue
+		}
+
+		if b.ejected == 0 || ep.ejectedUntil.Before(b.nextReadmit) {
+			b.nextReadmit = ep.ejectedUntil
+		}
+		b.ejected++
+	}
+
+	b.updatePicker()
+}
+
+func (b *Balancer) updatePicker() {
+	healthy := make([]*Endpoint, 0, len(b.endpoints))
+	for _, ep := range b.endpoints {
+		if ep.ejectedUntil.IsZero() {
+			healthy = append(healthy, ep)
+		}
+	}
+	sortEndpoints(healthy)
+	b.picker.Update(healthy)
+}
@@ -0,0 +1,252 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/golib/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+var errBoom = errors.New("boom")
+
+func entries(n int) []*discovery.Entry {
+	var entries []*discovery.Entry
+	for i := 1; i <= n; i++ {
+		entries = append(entries, &discovery.Entry{Host: fmt.Sprintf("10.0.0.%d", i), Port: "80"})
+	}
+	return entries
+}
+
+func pickN(t *testing.T, b *Balancer, key string, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		p, err := b.Pick(key)
+		assert.NoError(t, err)
+		counts[p.Key()]++
+		p.Done(nil)
+	}
+	return counts
+}
+
+func TestRoundRobin(t *testing.T) {
+	b := New(RoundRobin())
+	_, err := b.Pick("")
+	assert.Equal(t, ErrNoEndpoint, err)
+
+	b.Update(entries(3))
+	counts := pickN(t, b, "", 30)
+	assert.Equal(t, 3, len(counts))
+	for _, n := range counts {
+		assert.Equal(t, 10, n)
+	}
+}
+
+func TestWeightedRandom(t *testing.T) {
+	es := entries(2)
+	es[1].Meta = map[string]string{"weight": "9"}
+	b := New(WeightedRandom())
+	b.Update(es)
+
+	counts := pickN(t, b, "", 1000)
+	assert.True(t, counts["10.0.0.2:80"] > 800, counts)
+	assert.True(t, counts["10.0.0.1:80"] > 0, counts)
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	b := New(LeastOutstanding())
+	b.Update(entries(3))
+
+	var picked []*Picked
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		p, err := b.Pick("")
+		assert.NoError(t, err)
+		seen[p.Key()] = true
+		picked = append(picked, p)
+	}
+	assert.Equal(t, 3, len(seen))
+
+	picked[1].Done(nil)
+	p, _ := b.Pick("")
+	assert.Equal(t, picked[1].Key(), p.Key())
+	assert.Equal(t, int64(1), p.Outstanding())
+}
+
+func TestConsistentHash(t *testing.T) {
+	b := New(ConsistentHash(50, nil))
+	b.Update(entries(5))
+
+	before := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		counts := pickN(t, b, key, 3)
+		assert.Equal(t, 1, len(counts))
+		for ep := range counts {
+			before[key] = ep
+		}
+	}
+
+	// removing an endpoint only moves its own keys
+	b.Update(entries(4))
+	moved := 0
+	for key, ep := range before {
+		p, _ := b.Pick(key)
+		if p.Key() != ep {
+			assert.Equal(t, "10.0.0.5:80", ep)
+			moved++
+		}
+		p.Done(nil)
+	}
+	assert.True(t, moved > 0 && moved < 50, moved)
+}
+
+func TestEpsilonGreedy(t *testing.T) {
+	b := New(EpsilonGreedy(0, nil))
+	_, err := b.Pick("")
+	assert.Equal(t, ErrNoEndpoint, err)
+
+	b.Update(entries(3))
+	counts := pickN(t, b, "", 30)
+	assert.True(t, len(counts) > 0)
+
+	b.Update(entries(1))
+	counts = pickN(t, b, "", 10)
+	assert.Equal(t, 10, counts["10.0.0.1:80"])
+}
+
+func TestEpsilonGreedyKeepsPool(t *testing.T) {
+	p := EpsilonGreedy(0, nil).(*epsilonGreedy)
+	b := New(p)
+	b.Update(entries(3))
+	pool := p.pool
+
+	b.Update(entries(2))
+	assert.True(t, pool == p.pool)
+	b.Update(nil)
+	_, err := b.Pick("")
+	assert.Equal(t, ErrNoEndpoint, err)
+
+	b.Update(entries(3))
+	assert.True(t, pool == p.pool)
+	pickN(t, b, "", 10)
+}
+
+func TestOutlierEjection(t *testing.T) {
+	now := time.Now()
+	b := New(RoundRobin())
+	b.now = func() time.Time { return now }
+	b.MaxFailures = 2
+	b.Update(entries(4))
+
+	fail := func(key string) {
+		for {
+			p, err := b.Pick("")
+			assert.NoError(t, err)
+			if p.Key() == key {
+				p.Done(errBoom)
+				return
+			}
+			p.Done(nil)
+		}
+	}
+
+	fail("10.0.0.1:80")
+	fail("10.0.0.1:80")
+	counts := pickN(t, b, "", 30)
+	assert.Equal(t, 3, len(counts))
+	assert.Equal(t, 0, counts["10.0.0.1:80"])
+
+	fail("10.0.0.2:80")
+	fail("10.0.0.2:80")
+	// at most half of the endpoints ejected
+	fail("10.0.0.3:80")
+	fail("10.0.0.3:80")
+	counts = pickN(t, b, "", 30)
+	assert.Equal(t, 2, len(counts))
+	assert.Equal(t, 15, counts["10.0.0.3:80"])
+
+	// readmitted after the ejection time
+	now = now.Add(b.EjectDuration)
+	counts = pickN(t, b, "", 40)
+	assert.Equal(t, 4, len(counts))
+
+	// ejected twice as long the second time
+	fail("10.0.0.1:80")
+	fail("10.0.0.1:80")
+	now = now.Add(b.EjectDuration)
+	assert.Equal(t, 0, pickN(t, b, "", 30)["10.0.0.1:80"])
+	now = now.Add(b.EjectDuration)
+	assert.Equal(t, 10, pickN(t, b, "", 40)["10.0.0.1:80"])
+}
+
+func TestUpdateKeepsState(t *testing.T) {
+	b := New(RoundRobin())
+	b.Update(entries(2))
+
+	p, _ := b.Pick("")
+	b.Update(entries(3))
+	for _, ep := range b.Endpoints() {
+		if ep.Key() == p.Key() {
+			assert.Equal(t, int64(1), ep.Outstanding())
+		}
+	}
+	p.Done(nil)
+	assert.Equal(t, int64(0), p.Outstanding())
+}
+
+type fakeDiscovery struct {
+	entries []*discovery.Entry
+	updates chan []*discovery.Entry
+}
+
+func (d *fakeDiscovery) Initialize(string, uint64) error    { return nil }
+func (d *fakeDiscovery) Fetch() ([]*discovery.Entry, error) { return d.entries, nil }
+func (d *fakeDiscovery) Register(string) error              { return nil }
+func (d *fakeDiscovery) Watch(callback discovery.WatchCallback) {
+	for entries := range d.updates {
+		callback(entries)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	d := &fakeDiscovery{entries: entries(1), updates: make(chan []*discovery.Entry)}
+	b := New(RoundRobin())
+	assert.NoError(t, b.Watch(d))
+	assert.Equal(t, 1, len(b.Endpoints()))
+
+	d.updates <- entries(3)
+	close(d.updates)
+	for i := 0; i < 100 && len(b.Endpoints()) != 3; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 3, len(b.Endpoints()))
+}
+
+func TestConcurrentPicks(t *testing.T) {
+	for _, picker := range []Picker{RoundRobin(), WeightedRandom(), LeastOutstanding(), ConsistentHash(10, nil), EpsilonGreedy(0, nil)} {
+		b := New(picker)
+		b.Update(entries(3))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					p, err := b.Pick(fmt.Sprint(j))
+					if err == nil {
+						p.Done(nil)
+					}
+					if j%50 == 0 {
+						b.Update(entries(2 + i%2))
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,61 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cjysmat/golib/epsilon"
+)
+
+type epsilonGreedy struct {
+	sync.RWMutex
+	decay     time.Duration
+	calc      epsilon.EpsilonValueCalculator
+	pool      epsilon.HostPool
+	endpoints map[string]*Endpoint
+}
+
+// EpsilonGreedy picks the endpoints with an epsilon.HostPool, favoring
+// the fastest ones. The response times learnt are kept across endpoint
+// changes for the endpoints staying. A nil calc defaults to the linear one.
+func EpsilonGreedy(decayDuration time.Duration, calc epsilon.EpsilonValueCalculator) Picker {
+	if calc == nil {
+		calc = &epsilon.LinearEpsilonValueCalculator{}
+	}
+	return &epsilonGreedy{decay: decayDuration, calc: calc}
+}
+
+func (p *epsilonGreedy) Update(endpoints []*Endpoint) {
+	hosts := make([]string, len(endpoints))
+	byKey := make(map[string]*Endpoint, len(endpoints))
+	for i, ep := range endpoints {
+		hosts[i] = ep.Key()
+		byKey[ep.Key()] = ep
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.endpoints = byKey
+	if len(hosts) == 0 {
+		// keep the pool, the endpoints may come back
+		return
+	}
+	if p.pool == nil {
+		p.pool = epsilon.NewEpsilonGreedy(hosts, p.decay, p.calc)
+	} else {
+		p.pool.SetHosts(hosts)
+	}
+}
+
+func (p *epsilonGreedy) Pick(string) (*Endpoint, func(error)) {
+	p.RLock()
+	defer p.RUnlock()
+
+	if len(p.endpoints) == 0 {
+		return nil, nil
+	}
+
+	resp := p.pool.Get()
+	return p.endpoints[resp.Host()], resp.Mark
+}
@@ -0,0 +1,45 @@
+package balancer
+
+import (
+	"sync"
+
+	"github.com/cjysmat/golib/hash"
+)
+
+type consistentHash struct {
+	sync.RWMutex
+	replicas  int
+	fn        hash.Hash
+	ring      *hash.Map
+	endpoints map[string]*Endpoint
+}
+
+// ConsistentHash routes the keys to the endpoints on a hash.Map ring, so
+// that a key keeps going to the same endpoint while the set changes
+// little. A nil fn defaults to crc32.
+func ConsistentHash(replicas int, fn hash.Hash) Picker {
+	return &consistentHash{replicas: replicas, fn: fn, ring: hash.New(replicas, fn)}
+}
+
+func (p *consistentHash) Update(endpoints []*Endpoint) {
+	ring := hash.New(p.replicas, p.fn)
+	byKey := make(map[string]*Endpoint, len(endpoints))
+	for _, ep := range endpoints {
+		ring.Add(ep.Key())
+		byKey[ep.Key()] = ep
+	}
+
+	p.Lock()
+	p.ring, p.endpoints = ring, byKey
+	p.Unlock()
+}
+
+func (p *consistentHash) Pick(key string) (*Endpoint, func(error)) {
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.ring.IsEmpty() {
+		return nil, nil
+	}
+	return p.endpoints[p.ring.Get(key)], nil
+}
@@ -0,0 +1,134 @@
+package balancer
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func sortEndpoints(endpoints []*Endpoint) {
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Key() < endpoints[j].Key()
+	})
+}
+
+// lockedRand is a rand.Rand safe for concurrent use.
+type lockedRand struct {
+	sync.Mutex
+	r *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (r *lockedRand) Intn(n int) int {
+	r.Lock()
+	defer r.Unlock()
+	return r.r.Intn(n)
+}
+
+type roundRobin struct {
+	endpoints atomic.Value // []*Endpoint
+	next      uint64
+}
+
+// RoundRobin picks the endpoints in turn.
+func RoundRobin() Picker {
+	p := &roundRobin{}
+	p.endpoints.Store([]*Endpoint(nil))
+	return p
+}
+
+func (p *roundRobin) Update(endpoints []*Endpoint) {
+	p.endpoints.Store(endpoints)
+}
+
+func (p *roundRobin) Pick(string) (*Endpoint, func(error)) {
+	endpoints := p.endpoints.Load().([]*Endpoint)
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+
+	n := atomic.AddUint64(&p.next, 1)
+	return endpoints[(n-1)%uint64(len(endpoints))], nil
+}
+
+type weightedRandom struct {
+	sync.RWMutex
+	endpoints []*Endpoint
+	cumulated []int
+	rand      *lockedRand
+}
+
+// WeightedRandom picks the endpoints randomly, in proportion to their
+// Weight.
+func WeightedRandom() Picker {
+	return &weightedRandom{rand: newLockedRand()}
+}
+
+func (p *weightedRandom) Update(endpoints []*Endpoint) {
+	cumulated := make([]int, len(endpoints))
+	total := 0
+	for i, ep := range endpoints {
+		total += ep.Weight
+		cumulated[i] = total
+	}
+
+	p.Lock()
+	p.endpoints, p.cumulated = endpoints, cumulated
+	p.Unlock()
+}
+
+func (p *weightedRandom) Pick(string) (*Endpoint, func(error)) {
+	p.RLock()
+	defer p.RUnlock()
+
+	if len(p.endpoints) == 0 {
+		return nil, nil
+	}
+
+	x := p.rand.Intn(p.cumulated[len(p.cumulated)-1])
+	i := sort.SearchInts(p.cumulated, x+1)
+	return p.endpoints[i], nil
+}
+
+type leastOutstanding struct {
+	sync.RWMutex
+	endpoints []*Endpoint
+	rand      *lockedRand
+}
+
+// LeastOutstanding picks the endpoint with the fewest requests in
+// flight, the ties being broken randomly.
+func LeastOutstanding() Picker {
+	return &leastOutstanding{rand: newLockedRand()}
+}
+
+func (p *leastOutstanding) Update(endpoints []*Endpoint) {
+	p.Lock()
+	p.endpoints = endpoints
+	p.Unlock()
+}
+
+func (p *leastOutstanding) Pick(string) (*Endpoint, func(error)) {
+	p.RLock()
+	defer p.RUnlock()
+
+	n := len(p.endpoints)
+	if n == 0 {
+		return nil, nil
+	}
+
+	var best *Endpoint
+	start := p.rand.Intn(n)
+	for i := 0; i < n; i++ {
+		ep := p.endpoints[(start+i)%n]
+		if best == nil || ep.Outstanding() < best.Outstanding() {
+			best = ep
+		}
+	}
+	return best, nil
+}
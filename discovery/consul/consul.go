@@ -1,13 +1,15 @@
 package consul
 
 import (
+	"errors"
 	"fmt"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/docker/swarm/discovery"
+	"github.com/cjysmat/golib/discovery"
 	consul "github.com/hashicorp/consul/api"
 )
 
@@ -17,8 +19,14 @@ type Discovery struct {
 	client    *consul.Client
 	prefix    string
 	lastIndex uint64
+
+	mu       sync.Mutex
+	sessions map[string]string // entry key -> session id
 }
 
+// minSessionTTL is the shortest session TTL accepted by consul.
+const minSessionTTL = 10 * time.Second
+
 func init() {
 	discovery.Register("consul", &Discovery{})
 }
@@ -63,15 +71,15 @@ func (s *Discovery) Fetch() ([]*discovery.Entry, error) {
 		return nil, err
 	}
 
-	addrs := []string{}
+	values := [][]byte{}
 	for _, pair := range pairs {
 		if pair.Key == s.prefix {
 			continue
 		}
-		addrs = append(addrs, string(pair.Value))
+		values = append(values, pair.Value)
 	}
 
-	return discovery.CreateEntries(addrs)
+	return discovery.ParseEntries(values)
 }
 
 // Watch is exported
@@ -93,6 +101,104 @@ func (s *Discovery) Register(addr string) error {
 	return err
 }
 
+// RegisterEntry stores the entry under a key held by a session with ttl,
+// at least 10s, so that consul deletes it once the session expires. It
+// fails while the session of another entry holds the key.
+func (s *Discovery) RegisterEntry(entry *discovery.Entry, ttl time.Duration) error {
+	s.Deregister(entry)
+	return s.acquire(entry, ttl)
+}
+
+// ClaimEntry is RegisterEntry failing if the key is held by the session
+// of another entry, or the lock delay of a lost one.
+func (s *Discovery) ClaimEntry(entry *discovery.Entry, ttl time.Duration) error {
+	s.mu.Lock()
+	id, present := s.sessions[entry.Key()]
+	delete(s.sessions, entry.Key())
+	s.mu.Unlock()
+	if present {
+		s.client.Session().Destroy(id, nil)
+	}
+
+	err := s.acquire(entry, ttl)
+	if err == errHeld {
+		return discovery.ErrClaimed
+	}
+	return err
+}
+
+var errHeld = errors.New("entry key held by another session")
+
+func (s *Discovery) acquire(entry *discovery.Entry, ttl time.Duration) error {
+	if ttl < minSessionTTL {
+		ttl = minSessionTTL
+	}
+
+	session := s.client.Session()
+	id, _, err := session.Create(&consul.SessionEntry{
+		Name:      "discovery:" + entry.Key(),
+		TTL:       ttl.String(),
+		Behavior:  consul.SessionBehaviorDelete,
+		LockDelay: time.Millisecond,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	kv := s.client.KV()
+	p := &consul.KVPair{Key: path.Join(s.prefix, entry.Key()), Value: entry.Marshal(), Session: id}
+	acquired, _, err := kv.Acquire(p, nil)
+	if err == nil && !acquired {
+		err = errHeld
+	}
+	if err != nil {
+		session.Destroy(id, nil)
+		return err
+	}
+
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]string)
+	}
+	s.sessions[entry.Key()] = id
+	s.mu.Unlock()
+	return nil
+}
+
+// Heartbeat renews the session of the entry.
+func (s *Discovery) Heartbeat(entry *discovery.Entry, ttl time.Duration) error {
+	s.mu.Lock()
+	id, present := s.sessions[entry.Key()]
+	s.mu.Unlock()
+	if !present {
+		return discovery.ErrNotRegistered
+	}
+
+	renewed, _, err := s.client.Session().Renew(id, nil)
+	if err != nil {
+		return err
+	} else if renewed == nil {
+		// session invalidated, along with the key
+		return discovery.ErrNotRegistered
+	}
+	return nil
+}
+
+// Deregister destroys the session of the entry, deleting its key only
+// while the session holds it.
+func (s *Discovery) Deregister(entry *discovery.Entry) error {
+	s.mu.Lock()
+	id, present := s.sessions[entry.Key()]
+	delete(s.sessions, entry.Key())
+	s.mu.Unlock()
+
+	if !present {
+		return nil
+	}
+	_, err := s.client.Session().Destroy(id, nil)
+	return err
+}
+
 func (s *Discovery) waitForChange() <-chan uint64 {
 	c := make(chan uint64)
 	go func() {
@@ -1,6 +1,8 @@
 package discovery
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -11,8 +13,13 @@ import (
 
 // Entry is exported
 type Entry struct {
-	Host string
-	Port string
+	Host string `json:"host"`
+	Port string `json:"port"`
+
+	// ID identifies the instance, see Key.
+	ID   string            `json:"id,omitempty"`
+	Tags []string          `json:"tags,omitempty"`
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 // NewEntry is exported
@@ -21,11 +28,54 @@ func NewEntry(url string) (*Entry, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Entry{host, port}, nil
+	return &Entry{Host: host, Port: port}, nil
+}
+
+// ParseEntry parses an entry as stored by the backends: either its JSON
+// encoding or a bare host:port address.
+func ParseEntry(data []byte) (*Entry, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return NewEntry(string(data))
+	}
+
+	entry := &Entry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	if entry.Host == "" || entry.Port == "" {
+		return nil, fmt.Errorf("missing host or port in entry %s", data)
+	}
+	return entry, nil
+}
+
+// Marshal returns the JSON encoding of the entry, as stored by the
+// backends.
+func (m Entry) Marshal() []byte {
+	data, _ := json.Marshal(m)
+	return data
+}
+
+// Key returns the ID of the entry, or its address if it has none.
+func (m Entry) Key() string {
+	if m.ID != "" {
+		return m.ID
+	}
+	return m.String()
+}
+
+// HasTag tells whether the entry is tagged with tag.
+func (m Entry) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 func (m Entry) String() string {
-	return fmt.Sprintf("%s:%s", m.Host, m.Port)
+	return net.JoinHostPort(m.Host, m.Port)
 }
 
 // WatchCallback is exported
@@ -104,3 +154,20 @@ func CreateEntries(addrs []string) ([]*Entry, error) {
 	}
 	return entries, nil
 }
+
+// ParseEntries parses the entries stored by the backends, see ParseEntry.
+// Empty values are skipped.
+func ParseEntries(values [][]byte) ([]*Entry, error) {
+	entries := []*Entry{}
+	for _, value := range values {
+		if len(bytes.TrimSpace(value)) == 0 {
+			continue
+		}
+		entry, err := ParseEntry(value)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,298 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cjysmat/golib/discovery"
+	dns "github.com/miekg/dns"
+)
+
+const (
+	defaultHeartbeat = 10 * time.Second
+	minTTL           = time.Second
+)
+
+// Discovery resolves the A/AAAA records of host:port patterns for the
+// dns:// scheme, or the SRV records of names for the srv:// scheme:
+//
+//	dns://web[01:03].example.com:80,10.0.0.1:80
+//	srv://_http._tcp.example.com,_http._tcp.example.org?server=10.0.0.53:53
+//
+// The DNS server defaults to the first one of /etc/resolv.conf. The
+// records are cached for their TTL.
+type Discovery struct {
+	srv       bool
+	heartbeat time.Duration
+	server    string
+	targets   []target
+	client    *dns.Client
+	tcpClient *dns.Client
+
+	mu    sync.Mutex
+	cache map[string]*cached // by qtype and name
+
+	now func() time.Time
+}
+
+type target struct {
+	name string
+	port string // dns:// only
+}
+
+type cached struct {
+	records []record
+	expires time.Time
+}
+
+// record is an address resolved from a name.
+type record struct {
+	ip       string
+	port     string // SRV only
+	priority uint16
+	weight   uint16
+	target   string
+}
+
+func init() {
+	discovery.Register("dns", &Discovery{})
+	discovery.Register("srv", &Discovery{srv: true})
+}
+
+// Initialize is exported
+func (s *Discovery) Initialize(uris string, heartbeat uint64) error {
+	names := uris
+	query := url.Values{}
+	if i := strings.Index(uris, "?"); i >= 0 {
+		var err error
+		if query, err = url.ParseQuery(uris[i+1:]); err != nil {
+			return err
+		}
+		names = uris[:i]
+	}
+
+	s.targets = nil
+	for _, part := range strings.Split(names, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		if s.srv {
+			s.targets = append(s.targets, target{name: dns.Fqdn(part)})
+			continue
+		}
+
+		for _, addr := range discovery.Generate(part) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return err
+			}
+			s.targets = append(s.targets, target{name: host, port: port})
+		}
+	}
+	if len(s.targets) == 0 {
+		return fmt.Errorf("invalid format %q, missing names", uris)
+	}
+
+	s.server = query.Get("server")
+	if s.server == "" {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil || len(conf.Servers) == 0 {
+			return fmt.Errorf("no dns server: %v", err)
+		}
+		s.server = net.JoinHostPort(conf.Servers[0], conf.Port)
+	}
+
+	s.heartbeat = time.Duration(heartbeat) * time.Second
+	if s.heartbeat <= 0 {
+		s.heartbeat = defaultHeartbeat
+	}
+	s.client = &dns.Client{Timeout: 5 * time.Second}
+	s.tcpClient = &dns.Client{Net: "tcp", Timeout: 5 * time.Second}
+	s.cache = make(map[string]*cached)
+	s.now = time.Now
+	return nil
+}
+
+// Fetch is exported
+func (s *Discovery) Fetch() ([]*discovery.Entry, error) {
+	entries := []*discovery.Entry{}
+	for _, t := range s.targets {
+		if s.srv {
+			records, err := s.resolveSRV(t.name)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, r := range records {
+				entries = append(entries, &discovery.Entry{Host: r.ip, Port: r.port, Meta: map[string]string{
+					"target":   r.target,
+					"priority": strconv.Itoa(int(r.priority)),
+					"weight":   strconv.Itoa(int(r.weight)),
+				}})
+			}
+			continue
+		}
+
+		if net.ParseIP(t.name) != nil {
+			entries = append(entries, &discovery.Entry{Host: t.name, Port: t.port})
+			continue
+		}
+
+		records, err := s.resolveHost(t.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			entries = append(entries, &discovery.Entry{Host: r.ip, Port: t.port, Meta: map[string]string{"target": t.name}})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].String() < entries[j].String()
+	})
+	return entries, nil
+}
+
+// Watch calls back on every heartbeat the entries changed.
+func (s *Discovery) Watch(callback discovery.WatchCallback) {
+	var last string
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		entries, err := s.Fetch()
+		if err != nil {
+			log.WithField("name", "dns").Errorf("Discovery error: %v", err)
+		} else if current := fingerprint(entries); current != last {
+			log.WithField("name", "dns").Debug("Discovery watch triggered")
+			last = current
+			callback(entries)
+		}
+
+		<-ticker.C
+	}
+}
+
+// Register is exported
+func (s *Discovery) Register(addr string) error {
+	return discovery.ErrNotImplemented
+}
+
+func fingerprint(entries []*discovery.Entry) string {
+	var sb strings.Builder
+	for _, entry := range entries {
+		sb.Write(entry.Marshal())
+	}
+	return sb.String()
+}
+
+// resolveHost returns the A and AAAA records of name.
+func (s *Discovery) resolveHost(name string) ([]record, error) {
+	var records []record
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		r, err := s.lookup(name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r...)
+	}
+	return records, nil
+}
+
+// resolveSRV returns the SRV records of name with the lowest priority,
+// resolved to addresses.
+func (s *Discovery) resolveSRV(name string) ([]record, error) {
+	srvs, err := s.lookup(name, dns.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []record
+	for _, srv := range srvs {
+		if len(records) > 0 && srv.priority > records[0].priority {
+			break
+		}
+
+		addrs, err := s.resolveHost(srv.target)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			srv.ip = addr.ip
+			records = append(records, srv)
+		}
+	}
+	return records, nil
+}
+
+// lookup queries the records of name and qtype, unless cached.
+func (s *Discovery) lookup(name string, qtype uint16) ([]record, error) {
+	name = dns.Fqdn(name)
+	key := dns.TypeToString[qtype] + " " + name
+
+	s.mu.Lock()
+	c, present := s.cache[key]
+	s.mu.Unlock()
+	if present && s.now().Before(c.expires) {
+		return c.records, nil
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.SetEdns0(4096, false)
+	resp, _, err := s.client.Exchange(msg, s.server)
+	if err == nil && resp.Truncated {
+		// a partial answer would drop endpoints till the ttl expires
+		resp, _, err = s.tcpClient.Exchange(msg, s.server)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("dns %s %s: %s", dns.TypeToString[qtype], name, dns.RcodeToString[resp.Rcode])
+	}
+
+	// names without records are cached for a heartbeat
+	ttl := s.heartbeat
+	var records []record
+	for _, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			records = append(records, record{ip: rr.A.String()})
+		case *dns.AAAA:
+			records = append(records, record{ip: rr.AAAA.String()})
+		case *dns.SRV:
+			records = append(records, record{port: strconv.Itoa(int(rr.Port)),
+				priority: rr.Priority, weight: rr.Weight, target: rr.Target})
+		default:
+			// CNAME chain
+			continue
+		}
+
+		if rrTTL := time.Duration(rr.Header().Ttl) * time.Second; len(records) == 1 || rrTTL < ttl {
+			ttl = rrTTL
+		}
+	}
+	if ttl < minTTL {
+		ttl = minTTL
+	}
+
+	if qtype == dns.TypeSRV {
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].priority < records[j].priority
+		})
+	}
+
+	s.mu.Lock()
+	s.cache[key] = &cached{records: records, expires: s.now().Add(ttl)}
+	s.mu.Unlock()
+	return records, nil
+}
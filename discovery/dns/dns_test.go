@@ -0,0 +1,220 @@
+package dns
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/golib/discovery"
+	dns "github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer is an in-process DNS server answering from a zone.
+type fakeServer struct {
+	sync.Mutex
+	zone    map[string][]dns.RR // by "TYPE name"
+	queries map[string]int
+	server  *dns.Server
+
+	// truncate answers only the first record over udp
+	truncate bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeServer{zone: make(map[string][]dns.RR), queries: make(map[string]int)}
+	started := make(chan struct{})
+	s.server = &dns.Server{PacketConn: pc, Handler: s, NotifyStartedFunc: func() { close(started) }}
+	go s.server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { s.server.Shutdown() })
+
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	started = make(chan struct{})
+	tcp := &dns.Server{Listener: l, Handler: s, NotifyStartedFunc: func() { close(started) }}
+	go tcp.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { tcp.Shutdown() })
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.server.PacketConn.LocalAddr().String()
+}
+
+func (s *fakeServer) set(records ...string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.zone = make(map[string][]dns.RR)
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			panic(err)
+		}
+		key := dns.TypeToString[rr.Header().Rrtype] + " " + rr.Header().Name
+		s.zone[key] = append(s.zone[key], rr)
+	}
+}
+
+func (s *fakeServer) count(key string) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.queries[key]
+}
+
+func (s *fakeServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	s.Lock()
+	defer s.Unlock()
+
+	q := req.Question[0]
+	key := dns.TypeToString[q.Qtype] + " " + q.Name
+	s.queries[key]++
+
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Answer = s.zone[key]
+	if s.truncate && w.LocalAddr().Network() == "udp" && len(resp.Answer) > 1 {
+		resp.Answer = resp.Answer[:1]
+		resp.Truncated = true
+	}
+	w.WriteMsg(resp)
+}
+
+func TestInitialize(t *testing.T) {
+	d := &Discovery{}
+	assert.Error(t, d.Initialize("?server=127.0.0.1:53", 0))
+	assert.Error(t, d.Initialize("nohost?server=127.0.0.1:53", 0))
+
+	assert.NoError(t, d.Initialize("web[1:2].example.com:80,10.0.0.1:81?server=127.0.0.1:53", 0))
+	assert.Equal(t, 3, len(d.targets))
+	assert.Equal(t, target{"web2.example.com", "80"}, d.targets[1])
+	assert.Equal(t, "127.0.0.1:53", d.server)
+	assert.Equal(t, defaultHeartbeat, d.heartbeat)
+
+	d = &Discovery{srv: true}
+	assert.NoError(t, d.Initialize("_http._tcp.example.com?server=127.0.0.1:53", 1))
+	assert.Equal(t, "_http._tcp.example.com.", d.targets[0].name)
+	assert.Equal(t, time.Second, d.heartbeat)
+}
+
+func TestFetch(t *testing.T) {
+	server := newFakeServer(t)
+	server.set(
+		"web1.example.com. 60 IN A 10.0.0.1",
+		"web1.example.com. 60 IN AAAA ::1",
+		"web2.example.com. 30 IN A 10.0.0.2",
+	)
+
+	now := time.Now()
+	d := &Discovery{}
+	assert.NoError(t, d.Initialize("web[1:3].example.com:80,192.168.0.1:81?server="+server.addr(), 0))
+	d.now = func() time.Time { return now }
+
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80", "192.168.0.1:81", "[::1]:80"}, addrs(entries))
+	assert.Equal(t, "web1.example.com", entries[0].Meta["target"])
+
+	// cached for the ttl
+	server.set("web2.example.com. 30 IN A 10.0.0.3")
+	entries, _ = d.Fetch()
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, 1, server.count("A web2.example.com."))
+
+	now = now.Add(31 * time.Second)
+	entries, _ = d.Fetch()
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.3:80", "192.168.0.1:81", "[::1]:80"}, addrs(entries))
+	assert.Equal(t, 2, server.count("A web2.example.com."))
+	assert.Equal(t, 1, server.count("A web1.example.com."))
+}
+
+func TestFetchTruncated(t *testing.T) {
+	server := newFakeServer(t)
+	server.truncate = true
+	server.set(
+		"web.example.com. 60 IN A 10.0.0.1",
+		"web.example.com. 60 IN A 10.0.0.2",
+		"web.example.com. 60 IN A 10.0.0.3",
+	)
+
+	d := &Discovery{}
+	assert.NoError(t, d.Initialize("web.example.com:80?server="+server.addr(), 0))
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	// asked again over tcp
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}, addrs(entries))
+	assert.Equal(t, 2, server.count("A web.example.com."))
+}
+
+func TestFetchSRV(t *testing.T) {
+	server := newFakeServer(t)
+	server.set(
+		"_http._tcp.example.com. 60 IN SRV 10 5 8080 web1.example.com.",
+		"_http._tcp.example.com. 60 IN SRV 10 1 8081 web2.example.com.",
+		"_http._tcp.example.com. 60 IN SRV 20 1 8082 backup.example.com.",
+		"web1.example.com. 60 IN A 10.0.0.1",
+		"web2.example.com. 60 IN A 10.0.0.2",
+		"backup.example.com. 60 IN A 10.0.0.3",
+	)
+
+	d := &Discovery{srv: true}
+	assert.NoError(t, d.Initialize("_http._tcp.example.com?server="+server.addr(), 0))
+
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.2:8081"}, addrs(entries))
+	assert.Equal(t, "5", entries[0].Meta["weight"])
+	assert.Equal(t, "web1.example.com.", entries[0].Meta["target"])
+}
+
+func TestWatch(t *testing.T) {
+	server := newFakeServer(t)
+	server.set("web.example.com. 1 IN A 10.0.0.1")
+
+	d := &Discovery{}
+	assert.NoError(t, d.Initialize("web.example.com:80?server="+server.addr(), 0))
+	d.heartbeat = 10 * time.Millisecond
+	now := time.Now()
+	var mu sync.Mutex
+	d.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		// every fetch is past the ttl
+		now = now.Add(2 * time.Second)
+		return now
+	}
+
+	calls := make(chan []*discovery.Entry, 10)
+	go d.Watch(func(entries []*discovery.Entry) { calls <- entries })
+
+	assert.Equal(t, []string{"10.0.0.1:80"}, addrs(<-calls))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, len(calls))
+	assert.True(t, server.count("A web.example.com.") > 2)
+
+	server.set("web.example.com. 1 IN A 10.0.0.2")
+	select {
+	case entries := <-calls:
+		assert.Equal(t, []string{"10.0.0.2:80"}, addrs(entries))
+	case <-time.After(time.Second):
+		t.Fatal("no callback on change")
+	}
+}
+
+func addrs(entries []*discovery.Entry) []string {
+	var r []string
+	for _, entry := range entries {
+		r = append(r, entry.String())
+	}
+	return r
+}
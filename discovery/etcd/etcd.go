@@ -4,10 +4,11 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/cjysmat/golib/discovery"
 	"github.com/coreos/go-etcd/etcd"
-	"github.com/docker/swarm/discovery"
 )
 
 // Discovery is exported
@@ -62,11 +63,11 @@ func (s *Discovery) Fetch() ([]*discovery.Entry, error) {
 		return nil, err
 	}
 
-	addrs := []string{}
+	values := [][]byte{}
 	for _, n := range resp.Node.Nodes {
-		addrs = append(addrs, n.Value)
+		values = append(values, []byte(n.Value))
 	}
-	return discovery.CreateEntries(addrs)
+	return discovery.ParseEntries(values)
 }
 
 // Watch is exported
@@ -87,3 +88,54 @@ func (s *Discovery) Register(addr string) error {
 	_, err := s.client.Set(path.Join(s.path, addr), addr, s.ttl)
 	return err
 }
+
+// etcd error codes
+const (
+	errKeyNotFound = 100
+	errTestFailed  = 101
+	errNodeExist   = 105
+)
+
+// RegisterEntry sets the entry key with ttl.
+func (s *Discovery) RegisterEntry(entry *discovery.Entry, ttl time.Duration) error {
+	_, err := s.client.Set(path.Join(s.path, entry.Key()), string(entry.Marshal()), ttlSeconds(ttl))
+	return err
+}
+
+// ClaimEntry creates the entry key with ttl, failing if it exists.
+func (s *Discovery) ClaimEntry(entry *discovery.Entry, ttl time.Duration) error {
+	_, err := s.client.Create(path.Join(s.path, entry.Key()), string(entry.Marshal()), ttlSeconds(ttl))
+	if etcdError, ok := err.(*etcd.EtcdError); ok && etcdError.ErrorCode == errNodeExist {
+		return discovery.ErrClaimed
+	}
+	return err
+}
+
+// Heartbeat refreshes the ttl of the entry key, failing if it expired or
+// was set to another entry.
+func (s *Discovery) Heartbeat(entry *discovery.Entry, ttl time.Duration) error {
+	value := string(entry.Marshal())
+	_, err := s.client.CompareAndSwap(path.Join(s.path, entry.Key()), value, ttlSeconds(ttl), value, 0)
+	if etcdError, ok := err.(*etcd.EtcdError); ok &&
+		(etcdError.ErrorCode == errKeyNotFound || etcdError.ErrorCode == errTestFailed) {
+		return discovery.ErrNotRegistered
+	}
+	return err
+}
+
+// Deregister deletes the entry key, unless it was set to another entry.
+func (s *Discovery) Deregister(entry *discovery.Entry) error {
+	_, err := s.client.CompareAndDelete(path.Join(s.path, entry.Key()), string(entry.Marshal()), 0)
+	if etcdError, ok := err.(*etcd.EtcdError); ok &&
+		(etcdError.ErrorCode == errKeyNotFound || etcdError.ErrorCode == errTestFailed) {
+		return nil
+	}
+	return err
+}
+
+func ttlSeconds(ttl time.Duration) uint64 {
+	if ttl < time.Second {
+		return 1
+	}
+	return uint64((ttl + time.Second - 1) / time.Second)
+}
@@ -1,17 +1,32 @@
 package file
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/docker/swarm/discovery"
+	"github.com/cjysmat/golib/discovery"
+	"github.com/cjysmat/golib/locking"
 )
 
 // Discovery is exported
 type Discovery struct {
 	heartbeat uint64
 	path      string
+
+	mu sync.Mutex // serializes the file updates
+}
+
+// record is an entry registered in the file, one JSON object per line.
+type record struct {
+	discovery.Entry
+
+	// Expires is the unix time in ms the entry expires at.
+	Expires int64 `json:"expires"`
 }
 
 func init() {
@@ -29,8 +44,8 @@ func parseFileContent(content []byte) []string {
 	var result []string
 	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
 		line = strings.TrimSpace(line)
-		// Ignoring line starts with #
-		if strings.HasPrefix(line, "#") {
+		// Ignoring line starts with #, and registered entries
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "{") {
 			continue
 		}
 		// Inlined # comment also ignored.
@@ -46,13 +61,40 @@ func parseFileContent(content []byte) []string {
 	return result
 }
 
+// parseRecord returns nil if line isn't a registered entry.
+func parseRecord(line string) *record {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return nil
+	}
+
+	r := &record{}
+	if err := json.Unmarshal([]byte(line), r); err != nil {
+		return nil
+	}
+	return r
+}
+
 // Fetch is exported
 func (s *Discovery) Fetch() ([]*discovery.Entry, error) {
 	fileContent, err := ioutil.ReadFile(s.path)
 	if err != nil {
 		return nil, err
 	}
-	return discovery.CreateEntries(parseFileContent(fileContent))
+
+	entries, err := discovery.CreateEntries(parseFileContent(fileContent))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, line := range strings.Split(string(fileContent), "\n") {
+		if r := parseRecord(line); r != nil && r.Expires > now {
+			entry := r.Entry
+			entries = append(entries, &entry)
+		}
+	}
+	return entries, nil
 }
 
 // Watch is exported
@@ -69,3 +111,133 @@ func (s *Discovery) Watch(callback discovery.WatchCallback) {
 func (s *Discovery) Register(addr string) error {
 	return discovery.ErrNotImplemented
 }
+
+// RegisterEntry adds the entry to the file as a JSON line, which Fetch
+// ignores once ttl elapsed. Being able to expire entries without any
+// server, the file backend is handy for tests.
+func (s *Discovery) RegisterEntry(entry *discovery.Entry, ttl time.Duration) error {
+	line, err := json.Marshal(record{Entry: *entry, Expires: expires(ttl)})
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(lines []string) ([]string, error) {
+		lines = removeRecord(lines, entry.Key())
+		return append(lines, string(line)), nil
+	})
+}
+
+// ClaimEntry adds the entry like RegisterEntry, unless an entry of the
+// same key is registered and not expired.
+func (s *Discovery) ClaimEntry(entry *discovery.Entry, ttl time.Duration) error {
+	line, err := json.Marshal(record{Entry: *entry, Expires: expires(ttl)})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	return s.update(func(lines []string) ([]string, error) {
+		for _, line := range lines {
+			if r := parseRecord(line); r != nil && r.Key() == entry.Key() && r.Expires > now {
+				return nil, discovery.ErrClaimed
+			}
+		}
+		lines = removeRecord(lines, entry.Key())
+		return append(lines, string(line)), nil
+	})
+}
+
+// Heartbeat is exported
+func (s *Discovery) Heartbeat(entry *discovery.Entry, ttl time.Duration) error {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	return s.update(func(lines []string) ([]string, error) {
+		for i, line := range lines {
+			r := parseRecord(line)
+			if r == nil || r.Key() != entry.Key() {
+				continue
+			}
+
+			if r.Expires <= now || !bytes.Equal(r.Entry.Marshal(), entry.Marshal()) {
+				return nil, discovery.ErrNotRegistered
+			}
+
+			r.Expires = expires(ttl)
+			data, err := json.Marshal(r)
+			if err != nil {
+				return nil, err
+			}
+			lines[i] = string(data)
+			return lines, nil
+		}
+
+		return nil, discovery.ErrNotRegistered
+	})
+}
+
+// Deregister removes the record of the entry, unless its key now holds
+// another entry.
+func (s *Discovery) Deregister(entry *discovery.Entry) error {
+	data := entry.Marshal()
+	return s.update(func(lines []string) ([]string, error) {
+		kept := lines[:0]
+		for _, line := range lines {
+			r := parseRecord(line)
+			if r == nil || r.Key() != entry.Key() || !bytes.Equal(r.Entry.Marshal(), data) {
+				kept = append(kept, line)
+			}
+		}
+		return kept, nil
+	})
+}
+
+func expires(ttl time.Duration) int64 {
+	return time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+}
+
+func removeRecord(lines []string, key string) []string {
+	kept := lines[:0]
+	for _, line := range lines {
+		if r := parseRecord(line); r == nil || r.Key() != key {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// update rewrites the file with the lines returned by fn, atomically.
+// The processes sharing the file are serialized by a flock of the file
+// plus ".lock".
+func (s *Discovery) update(fn func(lines []string) ([]string, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err = locking.Flock(lock, 0); err != nil {
+		return err
+	}
+	defer locking.Funlock(lock)
+
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	if trimmed := strings.TrimRight(string(content), "\n"); trimmed != "" {
+		lines = strings.Split(trimmed, "\n")
+	}
+
+	if lines, err = fn(lines); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -1,8 +1,18 @@
 package file
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/cjysmat/golib/discovery"
+	"github.com/cjysmat/golib/locking"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -44,3 +54,146 @@ func TestParsingContentsWithComments(t *testing.T) {
 	assert.Equal(t, "1.1.1.1:1111", ips[0])
 	assert.Equal(t, "3.3.3.3:3333", ips[1])
 }
+
+func TestRegisterEntry(t *testing.T) {
+	d := &Discovery{}
+	d.Initialize(filepath.Join(t.TempDir(), "cluster"), 0)
+	ioutil.WriteFile(d.path, []byte("# static\n1.1.1.1:1111\n"), 0644)
+
+	web1 := &discovery.Entry{Host: "10.0.0.1", Port: "80", ID: "web-1", Meta: map[string]string{"dc": "sh"}}
+	web2 := &discovery.Entry{Host: "10.0.0.2", Port: "80"}
+	assert.NoError(t, d.RegisterEntry(web1, time.Minute))
+	assert.NoError(t, d.RegisterEntry(web2, 20*time.Millisecond))
+	// replaces
+	assert.NoError(t, d.RegisterEntry(web1, time.Minute))
+
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "1.1.1.1:1111", entries[0].String())
+	assert.Equal(t, "10.0.0.2:80", entries[1].Key())
+	assert.Equal(t, web1, entries[2])
+
+	assert.NoError(t, d.Heartbeat(web1, time.Minute))
+	time.Sleep(30 * time.Millisecond)
+	entries, _ = d.Fetch()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, discovery.ErrNotRegistered, d.Heartbeat(web2, time.Minute))
+
+	assert.NoError(t, d.Deregister(web1))
+	assert.Equal(t, discovery.ErrNotRegistered, d.Heartbeat(web1, time.Minute))
+	entries, _ = d.Fetch()
+	assert.Equal(t, 1, len(entries))
+
+	content, _ := ioutil.ReadFile(d.path)
+	assert.True(t, strings.HasPrefix(string(content), "# static\n1.1.1.1:1111\n"))
+}
+
+func TestRegisterEntryShared(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "cluster")
+
+	// two processes sharing the file
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		d := &Discovery{}
+		d.Initialize(fn, 0)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				entry := &discovery.Entry{Host: "10.0.0.1", Port: "80", ID: fmt.Sprintf("web-%d-%d", i, j)}
+				assert.NoError(t, d.RegisterEntry(entry, time.Minute))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	d := &Discovery{}
+	d.Initialize(fn, 0)
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, 200, len(entries), "no update should be lost")
+}
+
+func TestRegistrar(t *testing.T) {
+	d := &Discovery{}
+	d.Initialize(filepath.Join(t.TempDir(), "cluster"), 0)
+
+	entry := &discovery.Entry{Host: "10.0.0.1", Port: "80", ID: "web-1"}
+	r := discovery.NewRegistrar(d, entry, 30*time.Millisecond)
+	assert.NoError(t, r.Start())
+
+	// outlives its ttl thanks to the heartbeats
+	time.Sleep(60 * time.Millisecond)
+	entries, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// lost, then registered again
+	assert.NoError(t, d.Deregister(entry))
+	time.Sleep(30 * time.Millisecond)
+	entries, _ = d.Fetch()
+	assert.Equal(t, 1, len(entries))
+
+	assert.NoError(t, r.Stop())
+	entries, _ = d.Fetch()
+	assert.Equal(t, 0, len(entries))
+}
+
+func TestClaimEntry(t *testing.T) {
+	d := &Discovery{}
+	d.Initialize(filepath.Join(t.TempDir(), "cluster"), 0)
+
+	web1 := &discovery.Entry{Host: "10.0.0.1", Port: "80", ID: "web"}
+	web2 := &discovery.Entry{Host: "10.0.0.2", Port: "80", ID: "web"}
+	assert.NoError(t, d.ClaimEntry(web1, 20*time.Millisecond))
+	assert.Equal(t, discovery.ErrClaimed, d.ClaimEntry(web2, time.Minute))
+
+	// expired, free to claim
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(t, d.ClaimEntry(web2, time.Minute))
+	assert.Equal(t, discovery.ErrNotRegistered, d.Heartbeat(web1, time.Minute))
+	assert.NoError(t, d.Heartbeat(web2, time.Minute))
+
+	// the late deregistration of web1 leaves the claim of web2
+	assert.NoError(t, d.Deregister(web1))
+	assert.NoError(t, d.Heartbeat(web2, time.Minute))
+	assert.NoError(t, d.Deregister(web2))
+	assert.Equal(t, discovery.ErrNotRegistered, d.Heartbeat(web2, time.Minute))
+}
+
+func TestClaimEntryShared(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "cluster")
+	d1, d2 := &Discovery{}, &Discovery{}
+	d1.Initialize(fn, 0)
+	d2.Initialize(fn, 0)
+
+	web1 := &discovery.Entry{Host: "10.0.0.1", Port: "80", ID: "wid-0"}
+	web2 := &discovery.Entry{Host: "10.0.0.2", Port: "80", ID: "wid-0"}
+
+	// d1 is in the middle of its update, as another process would be
+	lock, err := os.OpenFile(fn+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	assert.NoError(t, err)
+	defer lock.Close()
+	assert.NoError(t, locking.Flock(lock, time.Second))
+
+	claimed := make(chan error)
+	go func() {
+		claimed <- d2.ClaimEntry(web2, time.Minute)
+	}()
+	select {
+	case err = <-claimed:
+		t.Fatal("claim should wait for the other update", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// d1 claims, then releases the lock
+	line, _ := json.Marshal(record{Entry: *web1, Expires: expires(time.Minute)})
+	ioutil.WriteFile(fn, append(line, '\n'), 0644)
+	locking.Funlock(lock)
+
+	assert.Equal(t, discovery.ErrClaimed, <-claimed)
+	assert.NoError(t, d1.Heartbeat(web1, time.Minute))
+	assert.Equal(t, discovery.ErrClaimed, d1.ClaimEntry(web2, time.Minute))
+}
@@ -6,29 +6,41 @@ import (
 	"strconv"
 )
 
+var rangeRe = regexp.MustCompile(`\[(\d+):(\d+)\]`)
+
 // Generate takes care of IP generation
+//
+// Each [from:to] range in the pattern, IP or hostname alike, is expanded,
+// e.g. web[01:03].example.com:80 yields web01.example.com:80 to
+// web03.example.com:80, a leading zero padding the numbers to its width.
 func Generate(pattern string) []string {
-	re, _ := regexp.Compile(`\[(.+):(.+)\]`)
-	submatch := re.FindStringSubmatch(pattern)
-	if submatch == nil {
+	loc := rangeRe.FindStringSubmatchIndex(pattern)
+	if loc == nil {
 		return []string{pattern}
 	}
 
-	from, err := strconv.Atoi(submatch[1])
+	fromStr, toStr := pattern[loc[2]:loc[3]], pattern[loc[4]:loc[5]]
+	from, err := strconv.Atoi(fromStr)
 	if err != nil {
 		return []string{pattern}
 	}
-	to, err := strconv.Atoi(submatch[2])
+	to, err := strconv.Atoi(toStr)
 	if err != nil {
 		return []string{pattern}
 	}
 
-	template := re.ReplaceAllString(pattern, "%d")
+	width := 0
+	if len(fromStr) > 1 && fromStr[0] == '0' {
+		width = len(fromStr)
+	}
 
 	var result []string
+	rest := Generate(pattern[loc[1]:])
 	for val := from; val <= to; val++ {
-		entry := fmt.Sprintf(template, val)
-		result = append(result, entry)
+		prefix := pattern[:loc[0]] + fmt.Sprintf("%0*d", width, val)
+		for _, suffix := range rest {
+			result = append(result, prefix+suffix)
+		}
 	}
 
 	return result
@@ -53,3 +53,14 @@ func TestGenerateWithMalformedInputAtRangeEnd(t *testing.T) {
 	assert.Equal(t, len(ips), 1)
 	assert.Equal(t, ips[0], malformedInput)
 }
+
+func TestGenerateHostnames(t *testing.T) {
+	hosts := Generate("web[08:10].example.com:80")
+	assert.Equal(t, []string{"web08.example.com:80", "web09.example.com:80", "web10.example.com:80"}, hosts)
+
+	hosts = Generate("rack[1:2]-node[1:2].dc:22")
+	assert.Equal(t, []string{"rack1-node1.dc:22", "rack1-node2.dc:22", "rack2-node1.dc:22", "rack2-node2.dc:22"}, hosts)
+
+	hosts = Generate("[::1]:80")
+	assert.Equal(t, []string{"[::1]:80"}, hosts)
+}
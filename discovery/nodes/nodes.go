@@ -3,7 +3,7 @@ package nodes
 import (
 	"strings"
 
-	"github.com/docker/swarm/discovery"
+	"github.com/cjysmat/golib/discovery"
 )
 
 // Discovery is exported
@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	// ErrNotRegistered is returned by Registry.Heartbeat when the backend
+	// dropped the entry, e.g. after a session loss.
+	ErrNotRegistered = errors.New("entry not registered")
+
+	// ErrClaimed is returned by Claimer.ClaimEntry when the key of the
+	// entry is held by another one.
+	ErrClaimed = errors.New("entry key already claimed")
+)
+
+// Registry is implemented by the backends able to register entries that
+// expire unless kept alive.
+type Registry interface {
+	// RegisterEntry registers the entry, replacing the one of the same
+	// key, for ttl.
+	RegisterEntry(entry *Entry, ttl time.Duration) error
+
+	// Heartbeat keeps the entry registered for ttl more.
+	// It returns ErrNotRegistered if the entry is gone, or its key now
+	// holds another entry.
+	Heartbeat(entry *Entry, ttl time.Duration) error
+
+	// Deregister removes the entry.
+	Deregister(entry *Entry) error
+}
+
+// Claimer is implemented by the registries able to register an entry only
+// if its key is free, so that the entry can stand for a lease on the key.
+type Claimer interface {
+	Registry
+
+	// ClaimEntry registers the entry for ttl unless another entry holds
+	// its key, in which case it returns ErrClaimed.
+	ClaimEntry(entry *Entry, ttl time.Duration) error
+}
+
+// Registrar keeps an entry registered in a Registry till stopped.
+type Registrar struct {
+	registry Registry
+	entry    *Entry
+	ttl      time.Duration
+
+	// Interval between heartbeats, ttl/3 by default.
+	Interval time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewRegistrar is exported
+func NewRegistrar(registry Registry, entry *Entry, ttl time.Duration) *Registrar {
+	return &Registrar{
+		registry: registry,
+		entry:    entry,
+		ttl:      ttl,
+		Interval: ttl / 3,
+	}
+}
+
+// Start registers the entry, then heartbeats it in the background,
+// registering it again whenever the backend lost it.
+func (r *Registrar) Start() error {
+	if err := r.registry.RegisterEntry(r.entry, r.ttl); err != nil {
+		return err
+	}
+
+	r.stop = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+	return nil
+}
+
+// Stop stops the heartbeats and deregisters the entry.
+func (r *Registrar) Stop() error {
+	if r.stop != nil {
+		close(r.stop)
+		r.wg.Wait()
+		r.stop = nil
+	}
+
+	return r.registry.Deregister(r.entry)
+}
+
+func (r *Registrar) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	registered := true
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var err error
+		if registered {
+			err = r.registry.Heartbeat(r.entry, r.ttl)
+		}
+		if !registered || err == ErrNotRegistered {
+			log.WithField("entry", r.entry.Key()).Debug("Discovery re-registering")
+			err = r.registry.RegisterEntry(r.entry, r.ttl)
+		}
+
+		registered = err == nil
+		if err != nil {
+			log.WithField("entry", r.entry.Key()).Errorf("Discovery heartbeat error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRegistry struct {
+	sync.Mutex
+	entries    map[string]*Entry
+	registers  int
+	heartbeats int
+}
+
+func (r *fakeRegistry) RegisterEntry(entry *Entry, ttl time.Duration) error {
+	r.Lock()
+	defer r.Unlock()
+	r.registers++
+	r.entries[entry.Key()] = entry
+	return nil
+}
+
+func (r *fakeRegistry) Heartbeat(entry *Entry, ttl time.Duration) error {
+	r.Lock()
+	defer r.Unlock()
+	r.heartbeats++
+	if _, present := r.entries[entry.Key()]; !present {
+		return ErrNotRegistered
+	}
+	return nil
+}
+
+func (r *fakeRegistry) Deregister(entry *Entry) error {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.entries, entry.Key())
+	return nil
+}
+
+func (r *fakeRegistry) has(key string) bool {
+	r.Lock()
+	defer r.Unlock()
+	_, present := r.entries[key]
+	return present
+}
+
+func TestRegistrar(t *testing.T) {
+	registry := &fakeRegistry{entries: make(map[string]*Entry)}
+	entry := &Entry{Host: "127.0.0.1", Port: "80", ID: "web-1"}
+
+	r := NewRegistrar(registry, entry, 30*time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, r.Interval)
+	assert.NoError(t, r.Start())
+	assert.True(t, registry.has("web-1"))
+
+	time.Sleep(35 * time.Millisecond)
+	registry.Lock()
+	assert.True(t, registry.heartbeats >= 2)
+	// session loss
+	delete(registry.entries, "web-1")
+	registry.Unlock()
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, registry.has("web-1"))
+	registry.Lock()
+	assert.True(t, registry.registers >= 2)
+	registry.Unlock()
+
+	assert.NoError(t, r.Stop())
+	assert.False(t, registry.has("web-1"))
+}
+
+func TestParseEntry(t *testing.T) {
+	entry, err := ParseEntry([]byte("127.0.0.1:2375"))
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:2375", entry.Key())
+
+	entry = &Entry{Host: "10.0.0.1", Port: "80", ID: "web-1", Tags: []string{"v2"}, Meta: map[string]string{"dc": "sh"}}
+	parsed, err := ParseEntry(entry.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, entry, parsed)
+	assert.Equal(t, "web-1", parsed.Key())
+	assert.True(t, parsed.HasTag("v2"))
+	assert.False(t, parsed.HasTag("v1"))
+
+	_, err = ParseEntry([]byte(`{"id":"x"}`))
+	assert.Error(t, err)
+
+	entries, err := ParseEntries([][]byte{entry.Marshal(), nil, []byte("127.0.0.1:1")})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+}
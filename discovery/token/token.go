@@ -9,7 +9,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/docker/swarm/discovery"
+	"github.com/cjysmat/golib/discovery"
 )
 
 // DiscoveryUrl is exported
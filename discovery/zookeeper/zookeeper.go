@@ -1,13 +1,14 @@
 package zookeeper
 
 import (
+	"bytes"
 	"fmt"
 	"path"
 	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/docker/swarm/discovery"
+	"github.com/cjysmat/golib/discovery"
 	"github.com/samuel/go-zookeeper/zk"
 )
 
@@ -76,24 +77,42 @@ func (s *Discovery) Initialize(uris string, heartbeat uint64) error {
 
 // Fetch is exported
 func (s *Discovery) Fetch() ([]*discovery.Entry, error) {
-	addrs, _, err := s.conn.Children(s.fullpath())
+	children, _, err := s.conn.Children(s.fullpath())
 
 	if err != nil {
 		return nil, err
 	}
 
-	return discovery.CreateEntries(addrs)
+	entries := []*discovery.Entry{}
+	for _, child := range children {
+		data, _, err := s.conn.Get(path.Join(s.fullpath(), child))
+		if err == zk.ErrNoNode {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		entry, err := discovery.ParseEntry(data)
+		if err != nil {
+			// node named after its address
+			if entry, err = discovery.NewEntry(child); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
 }
 
 // Watch is exported
 func (s *Discovery) Watch(callback discovery.WatchCallback) {
 
-	addrs, _, eventChan, err := s.conn.ChildrenW(s.fullpath())
+	_, _, eventChan, err := s.conn.ChildrenW(s.fullpath())
 	if err != nil {
 		log.WithField("name", "zk").Debug("Discovery watch aborted")
 		return
 	}
-	entries, err := discovery.CreateEntries(addrs)
+	entries, err := s.Fetch()
 	if err == nil {
 		callback(entries)
 	}
@@ -147,3 +166,82 @@ func (s *Discovery) Register(addr string) error {
 	_, err = s.conn.Create(nodePath, []byte(addr), 0, zk.WorldACL(zk.PermAll))
 	return err
 }
+
+// RegisterEntry creates an ephemeral node holding the entry, which lives
+// as long as the zookeeper session: ttl is left to the session timeout.
+func (s *Discovery) RegisterEntry(entry *discovery.Entry, ttl time.Duration) error {
+	nodePath := path.Join(s.fullpath(), entry.Key())
+
+	if err := s.ensureFullpath(); err != nil {
+		return err
+	}
+
+	if err := s.conn.Delete(nodePath, -1); err != nil && err != zk.ErrNoNode {
+		return err
+	}
+
+	_, err := s.conn.Create(nodePath, entry.Marshal(), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	return err
+}
+
+// ClaimEntry creates the ephemeral node of the entry, failing if it
+// exists.
+func (s *Discovery) ClaimEntry(entry *discovery.Entry, ttl time.Duration) error {
+	if err := s.ensureFullpath(); err != nil {
+		return err
+	}
+
+	_, err := s.conn.Create(path.Join(s.fullpath(), entry.Key()), entry.Marshal(), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		return discovery.ErrClaimed
+	}
+	return err
+}
+
+func (s *Discovery) ensureFullpath() error {
+	exist, _, err := s.conn.Exists(s.fullpath())
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return s.createFullpath()
+	}
+	return nil
+}
+
+// Heartbeat checks the ephemeral node of the entry survived, the session
+// being kept alive by the client, and still holds the entry.
+func (s *Discovery) Heartbeat(entry *discovery.Entry, ttl time.Duration) error {
+	data, _, err := s.conn.Get(path.Join(s.fullpath(), entry.Key()))
+	if err == zk.ErrNoNode {
+		return discovery.ErrNotRegistered
+	} else if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, entry.Marshal()) {
+		return discovery.ErrNotRegistered
+	}
+	return nil
+}
+
+// Deregister deletes the node of the entry, only if it is owned by our
+// session, in the version read.
+func (s *Discovery) Deregister(entry *discovery.Entry) error {
+	nodePath := path.Join(s.fullpath(), entry.Key())
+	_, stat, err := s.conn.Get(nodePath)
+	if err == zk.ErrNoNode {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if stat.EphemeralOwner != s.conn.SessionID() {
+		// expired with our session, and claimed by another since
+		return nil
+	}
+
+	err = s.conn.Delete(nodePath, stat.Version)
+	if err == zk.ErrNoNode || err == zk.ErrBadVersion {
+		return nil
+	}
+	return err
+}
@@ -2,7 +2,16 @@
 Distributed logging api with help of syslog-ng.
 
 You need write your own syslog-ng agent that consumes
-messages by line from syslog-ng unix domain socket and 
+messages by line from syslog-ng unix domain socket and
 send it to your own central log server.
+syslogng.Listen can play that agent in a Go process.
+
+Dlog writes a single event synchronously. Logger is a leveled,
+structured alternative that batches events in the background,
+reconnects to syslog-ng and spools to a local file while it is down.
+
+	l := dlog.New("myapp", dlog.Options{SpoolFile: "/var/spool/myapp.dlog"})
+	defer l.Close()
+	l.Info("login", dlog.String("user", "bob"), dlog.Int("uid", 12))
 */
 package dlog
@@ -0,0 +1,119 @@
+package dlog
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+)
+
+type fieldKind uint8
+
+const (
+	kindString fieldKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindDuration
+	kindTime
+	kindAny
+)
+
+// Field is a typed key value pair of a logging event.
+type Field struct {
+	Key string
+
+	kind  fieldKind
+	str   string
+	num   int64
+	iface interface{}
+}
+
+func String(key, val string) Field {
+	return Field{Key: key, kind: kindString, str: val}
+}
+
+func Int(key string, val int) Field {
+	return Field{Key: key, kind: kindInt, num: int64(val)}
+}
+
+func Int64(key string, val int64) Field {
+	return Field{Key: key, kind: kindInt, num: val}
+}
+
+func Float64(key string, val float64) Field {
+	return Field{Key: key, kind: kindFloat, num: int64(math.Float64bits(val))}
+}
+
+func Bool(key string, val bool) Field {
+	f := Field{Key: key, kind: kindBool}
+	if val {
+		f.num = 1
+	}
+	return f
+}
+
+// Duration is serialised in ms.
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, kind: kindDuration, num: int64(val)}
+}
+
+// Time is serialised in RFC 3339 with ns.
+func Time(key string, val time.Time) Field {
+	return Field{Key: key, kind: kindTime, iface: val}
+}
+
+// Err is a field "error" holding err.Error(), or null.
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", kind: kindAny}
+	}
+	return String("error", err.Error())
+}
+
+// Any is serialised with encoding/json.
+func Any(key string, val interface{}) Field {
+	return Field{Key: key, kind: kindAny, iface: val}
+}
+
+func (f Field) appendJSON(buf []byte) []byte {
+	buf = appendString(buf, f.Key)
+	buf = append(buf, ':')
+
+	switch f.kind {
+	case kindString:
+		return appendString(buf, f.str)
+
+	case kindInt:
+		return strconv.AppendInt(buf, f.num, 10)
+
+	case kindFloat:
+		v := math.Float64frombits(uint64(f.num))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			// not representable in JSON
+			return appendString(buf, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(buf, v, 'g', -1, 64)
+
+	case kindBool:
+		return strconv.AppendBool(buf, f.num == 1)
+
+	case kindDuration:
+		return strconv.AppendFloat(buf, float64(f.num)/float64(time.Millisecond), 'f', -1, 64)
+
+	case kindTime:
+		return appendString(buf, f.iface.(time.Time).Format(time.RFC3339Nano))
+
+	default:
+		data, err := json.Marshal(f.iface)
+		if err != nil {
+			return appendString(buf, err.Error())
+		}
+		return append(buf, data...)
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	data, _ := json.Marshal(s)
+	return append(buf, data...)
+}
@@ -0,0 +1,524 @@
+package dlog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "level" + strconv.Itoa(int(l))
+	}
+}
+
+// Policy decides what a Logger does when its buffer is full.
+type Policy int
+
+const (
+	// PolicyDrop discards the event and counts it as dropped.
+	PolicyDrop Policy = iota
+
+	// PolicyBlock makes the caller wait for room in the buffer.
+	PolicyBlock
+)
+
+var ErrClosed = errors.New("dlog: logger closed")
+
+type Options struct {
+	// Network and Addr of syslog-ng, defaults to unix:/tmp/als.sock.
+	Network string
+	Addr    string
+
+	// Minimum level to log, LevelDebug by default.
+	Level Level
+
+	// Max number of events waiting in memory, 1024 by default.
+	BufferSize int
+
+	// Max number of events written in one batch, 64 by default.
+	BatchSize int
+
+	// How long an incomplete batch may wait, 100ms by default.
+	FlushInterval time.Duration
+
+	Policy Policy
+
+	// Min interval between two dial attempts, 1s by default.
+	ReconnectInterval time.Duration
+
+	// Write deadline of a batch, 5s by default.
+	WriteTimeout time.Duration
+
+	// Events are appended to SpoolFile while syslog-ng is unreachable and
+	// replayed in order after reconnect. Empty means drop them.
+	SpoolFile string
+
+	// Max bytes of SpoolFile, 0 means unlimited.
+	MaxSpoolSize int64
+}
+
+func (this *Options) setDefaults() {
+	if this.Network == "" {
+		this.Network = "unix"
+	}
+	if this.Addr == "" {
+		this.Addr = "/tmp/als.sock"
+	}
+	if this.BufferSize <= 0 {
+		this.BufferSize = 1024
+	}
+	if this.BatchSize <= 0 {
+		this.BatchSize = 64
+	}
+	if this.FlushInterval <= 0 {
+		this.FlushInterval = 100 * time.Millisecond
+	}
+	if this.ReconnectInterval <= 0 {
+		this.ReconnectInterval = time.Second
+	}
+	if this.WriteTimeout <= 0 {
+		this.WriteTimeout = 5 * time.Second
+	}
+}
+
+// Stats are counters of events since the Logger was created.
+type Stats struct {
+	Sent    uint64 // written to syslog-ng, including replayed ones
+	Dropped uint64 // lost because of full buffer, full spool or Close
+	Spooled uint64 // written to the spool file
+	Errors  uint64 // failed dials and writes
+}
+
+// Logger is a leveled structured logger that writes to syslog-ng
+// asynchronously, in the same `:ident,tag,ts,json` line format as Dlog.
+//
+// tag is the level name and json is an object holding ts, level, msg and
+// the fields of the event.
+type Logger struct {
+	ident  string
+	prefix []byte // encoded fields from With
+	core   *core
+}
+
+// New creates a Logger and starts its background writer. Close it to
+// flush pending events.
+func New(ident string, opts Options) *Logger {
+	opts.setDefaults()
+	c := newCore(opts)
+	go c.run()
+	return &Logger{ident: ident, core: c}
+}
+
+// With returns a Logger that adds fields to every event. It shares the
+// buffer, connection and level of this.
+func (this *Logger) With(fields ...Field) *Logger {
+	prefix := make([]byte, len(this.prefix), len(this.prefix)+32*len(fields))
+	copy(prefix, this.prefix)
+	for _, f := range fields {
+		prefix = append(prefix, ',')
+		prefix = f.appendJSON(prefix)
+	}
+	return &Logger{ident: this.ident, prefix: prefix, core: this.core}
+}
+
+func (this *Logger) SetLevel(lvl Level) {
+	atomic.StoreInt32(&this.core.level, int32(lvl))
+}
+
+func (this *Logger) Enabled(lvl Level) bool {
+	return lvl >= Level(atomic.LoadInt32(&this.core.level))
+}
+
+func (this *Logger) Debug(msg string, fields ...Field) {
+	this.Log(LevelDebug, msg, fields...)
+}
+
+func (this *Logger) Info(msg string, fields ...Field) {
+	this.Log(LevelInfo, msg, fields...)
+}
+
+func (this *Logger) Warn(msg string, fields ...Field) {
+	this.Log(LevelWarn, msg, fields...)
+}
+
+func (this *Logger) Error(msg string, fields ...Field) {
+	this.Log(LevelError, msg, fields...)
+}
+
+func (this *Logger) Log(lvl Level, msg string, fields ...Field) {
+	if !this.Enabled(lvl) {
+		return
+	}
+
+	this.core.enqueue(this.encode(time.Now().UTC(), lvl, msg, fields))
+}
+
+func (this *Logger) encode(now time.Time, lvl Level, msg string, fields []Field) []byte {
+	level := lvl.String()
+
+	buf := make([]byte, 0, 128+len(this.prefix)+32*len(fields))
+	buf = append(buf, ':')
+	buf = append(buf, this.ident...)
+	buf = append(buf, ',')
+	buf = append(buf, level...)
+	buf = append(buf, ',')
+	buf = strconv.AppendInt(buf, now.Unix(), 10)
+	buf = append(buf, `,{"ts":"`...)
+	buf = now.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, `","level":"`...)
+	buf = append(buf, level...)
+	buf = append(buf, `","msg":`...)
+	buf = appendString(buf, msg)
+	buf = append(buf, this.prefix...)
+	for _, f := range fields {
+		buf = append(buf, ',')
+		buf = f.appendJSON(buf)
+	}
+	buf = append(buf, '}', '\n')
+	return buf
+}
+
+// Flush blocks until every event logged before the call has been written
+// to syslog-ng or the spool, or dropped.
+func (this *Logger) Flush() error {
+	return this.core.flush()
+}
+
+// Close flushes pending events and releases the connection. Events
+// logged afterwards are dropped.
+func (this *Logger) Close() error {
+	return this.core.close()
+}
+
+func (this *Logger) Stats() Stats {
+	c := this.core
+	return Stats{
+		Sent:    atomic.LoadUint64(&c.sent),
+		Dropped: atomic.LoadUint64(&c.dropped),
+		Spooled: atomic.LoadUint64(&c.spooled),
+		Errors:  atomic.LoadUint64(&c.errors),
+	}
+}
+
+type core struct {
+	// stats, accessed atomically
+	sent, dropped, spooled, errors uint64
+
+	level int32
+	opts  Options
+
+	mu     sync.RWMutex // guards closed against senders to ch
+	closed bool
+	ch     chan []byte
+	flushc chan chan struct{}
+	quit   chan struct{}
+	done   chan struct{}
+
+	// owned by run
+	batch     bytes.Buffer
+	batchN    int
+	conn      net.Conn
+	lastDial  time.Time
+	spoolf    *os.File
+	spoolSize int64
+}
+
+func newCore(opts Options) *core {
+	return &core{
+		level:  int32(opts.Level),
+		opts:   opts,
+		ch:     make(chan []byte, opts.BufferSize),
+		flushc: make(chan chan struct{}),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (this *core) enqueue(line []byte) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	if this.closed {
+		atomic.AddUint64(&this.dropped, 1)
+		return
+	}
+
+	if this.opts.Policy == PolicyBlock {
+		this.ch <- line
+		return
+	}
+
+	select {
+	case this.ch <- line:
+	default:
+		atomic.AddUint64(&this.dropped, 1)
+	}
+}
+
+func (this *core) flush() error {
+	this.mu.RLock()
+	if this.closed {
+		this.mu.RUnlock()
+		return ErrClosed
+	}
+
+	ack := make(chan struct{})
+	this.flushc <- ack
+	this.mu.RUnlock()
+
+	<-ack
+	return nil
+}
+
+func (this *core) close() error {
+	this.mu.Lock()
+	if this.closed {
+		this.mu.Unlock()
+		return nil
+	}
+	this.closed = true
+	close(this.quit)
+	this.mu.Unlock()
+
+	<-this.done
+	return nil
+}
+
+func (this *core) run() {
+	defer close(this.done)
+
+	ticker := time.NewTicker(this.opts.FlushInterval)
+	defer ticker.Stop()
+
+	this.connect()
+
+	for {
+		select {
+		case line := <-this.ch:
+			this.add(line)
+			if this.batchN >= this.opts.BatchSize {
+				this.write()
+			}
+
+		case <-ticker.C:
+			if this.conn == nil {
+				this.connect()
+			}
+			this.write()
+
+		case ack := <-this.flushc:
+			this.drain()
+			this.write()
+			close(ack)
+
+		case <-this.quit:
+			this.drain()
+			this.write()
+			if this.conn != nil {
+				this.conn.Close()
+			}
+			if this.spoolf != nil {
+				this.spoolf.Close()
+			}
+			return
+		}
+	}
+}
+
+func (this *core) add(line []byte) {
+	this.batch.Write(line)
+	this.batchN++
+}
+
+func (this *core) drain() {
+	for {
+		select {
+		case line := <-this.ch:
+			this.add(line)
+			if this.batchN >= this.opts.BatchSize {
+				this.write()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// write sends the pending batch, spooling it if syslog-ng is unreachable.
+func (this *core) write() {
+	if this.batchN == 0 {
+		return
+	}
+
+	if this.conn == nil {
+		this.connect()
+	}
+	if this.conn != nil {
+		this.conn.SetWriteDeadline(time.Now().Add(this.opts.WriteTimeout))
+		if _, err := this.conn.Write(this.batch.Bytes()); err == nil {
+			atomic.AddUint64(&this.sent, uint64(this.batchN))
+			this.reset()
+			return
+		}
+
+		// a partially written batch is spooled as a whole, so some lines
+		// may be delivered twice
+		atomic.AddUint64(&this.errors, 1)
+		this.conn.Close()
+		this.conn = nil
+	}
+
+	this.spool()
+	this.reset()
+}
+
+func (this *core) reset() {
+	this.batch.Reset()
+	this.batchN = 0
+}
+
+// connect dials syslog-ng at most once per ReconnectInterval and replays
+// the spool on success.
+func (this *core) connect() {
+	now := time.Now()
+	if now.Sub(this.lastDial) < this.opts.ReconnectInterval {
+		return
+	}
+	this.lastDial = now
+
+	conn, err := net.DialTimeout(this.opts.Network, this.opts.Addr, this.opts.WriteTimeout)
+	if err != nil {
+		atomic.AddUint64(&this.errors, 1)
+		return
+	}
+
+	this.conn = conn
+	if err = this.replay(); err != nil {
+		atomic.AddUint64(&this.errors, 1)
+		this.conn.Close()
+		this.conn = nil
+	}
+}
+
+func (this *core) openSpool() error {
+	if this.spoolf != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(this.opts.SpoolFile, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	this.spoolf = f
+	this.spoolSize = st.Size()
+	return nil
+}
+
+func (this *core) spool() {
+	n := uint64(this.batchN)
+	if this.opts.SpoolFile == "" {
+		atomic.AddUint64(&this.dropped, n)
+		return
+	}
+
+	if this.opts.MaxSpoolSize > 0 &&
+		this.spoolSize+int64(this.batch.Len()) > this.opts.MaxSpoolSize {
+		atomic.AddUint64(&this.dropped, n)
+		return
+	}
+
+	if err := this.openSpool(); err != nil {
+		atomic.AddUint64(&this.errors, 1)
+		atomic.AddUint64(&this.dropped, n)
+		return
+	}
+
+	written, err := this.spoolf.Write(this.batch.Bytes())
+	this.spoolSize += int64(written)
+	if err != nil {
+		atomic.AddUint64(&this.errors, 1)
+		atomic.AddUint64(&this.dropped, n)
+		return
+	}
+
+	atomic.AddUint64(&this.spooled, n)
+}
+
+// replay copies the spool, including one left by a previous process, to
+// the connection and truncates it.
+func (this *core) replay() error {
+	if this.opts.SpoolFile == "" {
+		return nil
+	}
+
+	if this.spoolf == nil {
+		if _, err := os.Stat(this.opts.SpoolFile); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	if err := this.openSpool(); err != nil {
+		return err
+	}
+	if this.spoolSize == 0 {
+		return nil
+	}
+
+	if _, err := this.spoolf.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := this.spoolf.Read(buf)
+		if n > 0 {
+			this.conn.SetWriteDeadline(time.Now().Add(this.opts.WriteTimeout))
+			if _, werr := this.conn.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			atomic.AddUint64(&this.sent, uint64(bytes.Count(buf[:n], []byte{'\n'})))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := this.spoolf.Truncate(0); err != nil {
+		return err
+	}
+	this.spoolSize = 0
+	return nil
+}
@@ -0,0 +1,276 @@
+package dlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+	"github.com/cjysmat/golib/syslogng"
+)
+
+type agent struct {
+	ln    net.Listener
+	lines chan string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startAgent(t *testing.T, path string) *agent {
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &agent{ln: ln, lines: make(chan string, 1000)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			a.mu.Lock()
+			a.conns = append(a.conns, conn)
+			a.mu.Unlock()
+			go func() {
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						conn.Close()
+						return
+					}
+					a.lines <- strings.TrimSuffix(line, "\n")
+				}
+			}()
+		}
+	}()
+	return a
+}
+
+func (this *agent) close() {
+	this.ln.Close()
+	this.mu.Lock()
+	for _, conn := range this.conns {
+		conn.Close()
+	}
+	this.mu.Unlock()
+}
+
+func (this *agent) next(t *testing.T) string {
+	select {
+	case line := <-this.lines:
+		return line
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for line")
+		return ""
+	}
+}
+
+func parseLine(t *testing.T, line string) (ident, tag string, obj map[string]interface{}) {
+	parts := strings.SplitN(line, ",", 4)
+	if len(parts) != 4 || !strings.HasPrefix(parts[0], ":") {
+		t.Fatalf("bad line %q", line)
+	}
+	if err := json.Unmarshal([]byte(parts[3]), &obj); err != nil {
+		t.Fatalf("bad json %q: %v", parts[3], err)
+	}
+	return parts[0][1:], parts[1], obj
+}
+
+func TestFieldJSON(t *testing.T) {
+	fields := []Field{
+		String("s", "a\"b\n"),
+		Int("i", -3),
+		Float64("f", 1.5),
+		Bool("b", true),
+		Duration("d", 1500*time.Microsecond),
+		Err(errors.New("oops")),
+		Any("m", map[string]int{"x": 1}),
+	}
+
+	buf := []byte{'{'}
+	for i, f := range fields {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = f.appendJSON(buf)
+	}
+	buf = append(buf, '}')
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		t.Fatalf("%s: %v", buf, err)
+	}
+	assert.Equal(t, "a\"b\n", obj["s"])
+	assert.Equal(t, float64(-3), obj["i"])
+	assert.Equal(t, 1.5, obj["f"])
+	assert.Equal(t, true, obj["b"])
+	assert.Equal(t, 1.5, obj["d"])
+	assert.Equal(t, "oops", obj["error"])
+	assert.Equal(t, float64(1), obj["m"].(map[string]interface{})["x"])
+}
+
+func TestLogger(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "als.sock")
+	a := startAgent(t, sock)
+	defer a.close()
+
+	l := New("app", Options{Network: "unix", Addr: sock, Level: LevelInfo})
+	defer l.Close()
+
+	l.Debug("hidden")
+	l.With(String("req", "r1")).Info("hello", Int("n", 7))
+	l.SetLevel(LevelDebug)
+	l.Debug("shown")
+	assert.Equal(t, nil, l.Flush())
+
+	ident, tag, obj := parseLine(t, a.next(t))
+	assert.Equal(t, "app", ident)
+	assert.Equal(t, "info", tag)
+	assert.Equal(t, "hello", obj["msg"])
+	assert.Equal(t, "info", obj["level"])
+	assert.Equal(t, "r1", obj["req"])
+	assert.Equal(t, float64(7), obj["n"])
+
+	_, tag, obj = parseLine(t, a.next(t))
+	assert.Equal(t, "debug", tag)
+	assert.Equal(t, "shown", obj["msg"])
+	assert.Equal(t, nil, obj["req"])
+
+	assert.Equal(t, Stats{Sent: 2}, l.Stats())
+}
+
+func TestLoggerDropPolicy(t *testing.T) {
+	// no writer: the buffer never drains
+	c := newCore(Options{BufferSize: 2, Policy: PolicyDrop})
+	l := &Logger{ident: "app", core: c}
+
+	for i := 0; i < 5; i++ {
+		l.Info("x")
+	}
+	assert.Equal(t, 2, len(c.ch))
+	assert.Equal(t, uint64(3), l.Stats().Dropped)
+}
+
+func TestLoggerBlockPolicy(t *testing.T) {
+	c := newCore(Options{BufferSize: 1, Policy: PolicyBlock})
+	l := &Logger{ident: "app", core: c}
+
+	l.Info("first")
+	done := make(chan struct{})
+	go func() {
+		l.Info("second")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("should block while buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-c.ch
+	<-done
+	assert.Equal(t, uint64(0), l.Stats().Dropped)
+}
+
+func TestLoggerSpoolAndReconnect(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "als.sock")
+	spool := filepath.Join(dir, "spool.log")
+
+	l := New("app", Options{
+		Addr:              sock,
+		SpoolFile:         spool,
+		ReconnectInterval: 10 * time.Millisecond,
+		FlushInterval:     5 * time.Millisecond,
+	})
+	defer l.Close()
+
+	// agent is down
+	for i := 0; i < 3; i++ {
+		l.Info("spooled", Int("i", i))
+	}
+	assert.Equal(t, nil, l.Flush())
+	st := l.Stats()
+	assert.Equal(t, uint64(3), st.Spooled)
+	assert.Equal(t, uint64(0), st.Sent)
+	assert.Equal(t, uint64(0), st.Dropped)
+
+	a := startAgent(t, sock)
+	for i := 0; i < 3; i++ {
+		_, _, obj := parseLine(t, a.next(t))
+		assert.Equal(t, float64(i), obj["i"])
+	}
+	l.Info("live")
+	_, _, obj := parseLine(t, a.next(t))
+	assert.Equal(t, "live", obj["msg"])
+
+	fi, err := os.Stat(spool)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(0), fi.Size())
+
+	// agent restarts
+	a.close()
+	a = startAgent(t, sock)
+	defer a.close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		l.Info("again")
+		select {
+		case line := <-a.lines:
+			_, _, obj = parseLine(t, line)
+			assert.Equal(t, "again", obj["msg"])
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("logger did not reconnect")
+		}
+	}
+}
+
+func TestLoggerClose(t *testing.T) {
+	l := New("app", Options{Addr: filepath.Join(t.TempDir(), "none.sock")})
+	l.Info("lost")
+	assert.Equal(t, nil, l.Close())
+	assert.Equal(t, nil, l.Close())
+	assert.Equal(t, ErrClosed, l.Flush())
+
+	l.Info("after close")
+	assert.Equal(t, uint64(2), l.Stats().Dropped)
+}
+
+func TestLoggerToServer(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "als.sock")
+	s, err := syslogng.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ch := s.Messages(10)
+
+	l := New("app", Options{Addr: sock})
+	defer l.Close()
+	l.Warn("disk", Int("free", 3))
+
+	select {
+	case m := <-ch:
+		ident, tag, obj := parseLine(t, m.Msg)
+		assert.Equal(t, "app", ident)
+		assert.Equal(t, "warn", tag)
+		assert.Equal(t, float64(3), obj["free"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+}
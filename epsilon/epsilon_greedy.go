@@ -58,13 +58,25 @@ func NewEpsilonGreedy(hosts []string, decayDuration time.Duration, calc EpsilonV
 
 	// allocate structures
 	for _, h := range p.hostList {
-		h.epsilonCounts = make([]int64, epsilonBuckets)
-		h.epsilonValues = make([]int64, epsilonBuckets)
+		initEpsilon(h)
 	}
 	go p.epsilonGreedyDecay()
 	return p
 }
 
+func initEpsilon(h *hostEntry) {
+	h.epsilonCounts = make([]int64, epsilonBuckets)
+	h.epsilonValues = make([]int64, epsilonBuckets)
+}
+
+// SetHosts replaces the hosts, the response times learnt of the ones
+// staying are kept.
+func (p *epsilonGreedyHostPool) SetHosts(hosts []string) {
+	p.Lock()
+	defer p.Unlock()
+	p.setHosts(hosts, initEpsilon)
+}
+
 func (p *epsilonGreedyHostPool) Close() {
 	close(p.quit)
 }
@@ -180,13 +192,14 @@ func (p *epsilonGreedyHostPool) markSuccess(hostR HostPoolResponse) {
 	duration := p.between(eHostR.started, eHostR.ended)
 
 	p.Lock()
+	defer p.Unlock()
 	h, ok := p.hosts[host]
 	if !ok {
-		log.Fatalf("host %s not in HostPool %v", host, p.Hosts())
+		// removed by SetHosts meanwhile
+		return
 	}
 	h.epsilonCounts[h.epsilonIndex]++
 	h.epsilonValues[h.epsilonIndex] += int64(duration.Seconds() * 1000)
-	p.Unlock()
 }
 
 type timer interface {
@@ -1,7 +1,6 @@
 package epsilon
 
 import (
-	"log"
 	"sync"
 	"time"
 )
@@ -28,6 +27,10 @@ type HostPool interface {
 	ResetAll()
 	Hosts() []string
 
+	// SetHosts replaces the hosts of the pool, the ones staying keep
+	// their state.
+	SetHosts(hosts []string)
+
 	// Close the hostpool and release all resources.
 	Close()
 }
@@ -138,6 +141,39 @@ func (p *standardHostPool) doResetAll() {
 	}
 }
 
+func (p *standardHostPool) SetHosts(hosts []string) {
+	p.Lock()
+	defer p.Unlock()
+	p.setHosts(hosts, nil)
+}
+
+// setHosts replaces the hosts, calling init on the new entries, and
+// should only be called with the lock held
+func (p *standardHostPool) setHosts(hosts []string, init func(h *hostEntry)) {
+	entries := make(map[string]*hostEntry, len(hosts))
+	hostList := make([]*hostEntry, len(hosts))
+	for i, host := range hosts {
+		e, ok := p.hosts[host]
+		if !ok {
+			e = &hostEntry{
+				host:       host,
+				retryDelay: p.initialRetryDelay,
+			}
+			if init != nil {
+				init(e)
+			}
+		}
+		entries[host] = e
+		hostList[i] = e
+	}
+
+	p.hosts = entries
+	p.hostList = hostList
+	if p.nextHostIndex >= len(hostList) {
+		p.nextHostIndex = 0
+	}
+}
+
 func (p *standardHostPool) Close() {
 	for _, h := range p.hosts {
 		h.dead = true
@@ -151,7 +187,8 @@ func (p *standardHostPool) markSuccess(hostR HostPoolResponse) {
 
 	h, ok := p.hosts[host]
 	if !ok {
-		log.Fatalf("host %s not in HostPool %v", host, p.Hosts())
+		// removed by SetHosts meanwhile
+		return
 	}
 	h.dead = false
 }
@@ -162,7 +199,7 @@ func (p *standardHostPool) markFailed(hostR HostPoolResponse) {
 	defer p.Unlock()
 	h, ok := p.hosts[host]
 	if !ok {
-		log.Fatalf("host %s not in HostPool %v", host, p.Hosts())
+		return
 	}
 	if !h.dead {
 		h.dead = true
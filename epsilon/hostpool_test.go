@@ -120,6 +120,26 @@ func TestEpsilonGreedy(t *testing.T) {
 	assert.Equal(t, hitCounts["b"] > hitCounts["a"], true)
 }
 
+func TestEpsilonGreedySetHosts(t *testing.T) {
+	p := NewEpsilonGreedy([]string{"a", "b"}, 0, &LinearEpsilonValueCalculator{}).(*epsilonGreedyHostPool)
+	p.timer = &mockTimer{t: 100}
+	respA := &epsilonHostPoolResponse{standardHostPoolResponse: standardHostPoolResponse{host: "a", pool: p}}
+	respA.Mark(nil)
+	respB := &epsilonHostPoolResponse{standardHostPoolResponse: standardHostPoolResponse{host: "b", pool: p}}
+
+	p.SetHosts([]string{"a", "c"})
+	assert.Equal(t, int64(1), p.hosts["a"].epsilonCounts[p.hosts["a"].epsilonIndex])
+	assert.Equal(t, int64(100), p.hosts["a"].epsilonValues[p.hosts["a"].epsilonIndex])
+	assert.Equal(t, epsilonBuckets, len(p.hosts["c"].epsilonCounts))
+
+	// b is gone, marking it is a noop
+	respB.Mark(nil)
+	for i := 0; i < 10; i++ {
+		host := p.Get().Host()
+		assert.NotEqual(t, "b", host)
+	}
+}
+
 func BenchmarkEpsilonGreedy(b *testing.B) {
 	b.StopTimer()
 
@@ -0,0 +1,141 @@
+package golocal
+
+import (
+	"sync"
+
+	"github.com/cjysmat/golib/hack"
+)
+
+var (
+	registry    = make(map[*Local]struct{})
+	registryMtx sync.RWMutex
+)
+
+// Local is a goroutine local variable: each goroutine sees its own value.
+//
+// Locals are usually declared globally at package scope. Values set on a
+// goroutine started by Go or GoInherit are released when the goroutine
+// exits; for other goroutines call Delete or Clear explicitly, otherwise the
+// value leaks.
+type Local struct {
+	mtx    sync.RWMutex
+	values map[uint64]interface{}
+}
+
+// NewLocal returns a new Local and registers it so that Go and GoInherit
+// can release and propagate its values.
+func NewLocal() *Local {
+	l := &Local{values: make(map[uint64]interface{})}
+	registryMtx.Lock()
+	registry[l] = struct{}{}
+	registryMtx.Unlock()
+	return l
+}
+
+// Unregister removes the Local from the global registry. Only intended for
+// use when you're completely done with a Local.
+func (l *Local) Unregister() {
+	registryMtx.Lock()
+	delete(registry, l)
+	registryMtx.Unlock()
+
+	l.mtx.Lock()
+	l.values = make(map[uint64]interface{})
+	l.mtx.Unlock()
+}
+
+// Get returns the value set on the current goroutine.
+func (l *Local) Get() (value interface{}, ok bool) {
+	return l.get(hack.GoroutineID())
+}
+
+// Set sets the value for the current goroutine.
+func (l *Local) Set(value interface{}) {
+	l.set(hack.GoroutineID(), value)
+}
+
+// Delete removes the value of the current goroutine.
+func (l *Local) Delete() {
+	l.del(hack.GoroutineID())
+}
+
+// Len returns how many goroutines currently have a value set.
+func (l *Local) Len() int {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return len(l.values)
+}
+
+func (l *Local) get(gid uint64) (value interface{}, ok bool) {
+	l.mtx.RLock()
+	value, ok = l.values[gid]
+	l.mtx.RUnlock()
+	return
+}
+
+func (l *Local) set(gid uint64, value interface{}) {
+	l.mtx.Lock()
+	l.values[gid] = value
+	l.mtx.Unlock()
+}
+
+func (l *Local) del(gid uint64) {
+	l.mtx.Lock()
+	delete(l.values, gid)
+	l.mtx.Unlock()
+}
+
+// Clear removes the values of the current goroutine from all Locals.
+func Clear() {
+	release(hack.GoroutineID())
+}
+
+func release(gid uint64) {
+	registryMtx.RLock()
+	defer registryMtx.RUnlock()
+
+	for l := range registry {
+		l.del(gid)
+	}
+}
+
+// snapshot copies the values of the goroutine from all Locals.
+func snapshot(gid uint64) map[*Local]interface{} {
+	registryMtx.RLock()
+	defer registryMtx.RUnlock()
+
+	values := make(map[*Local]interface{})
+	for l := range registry {
+		if v, ok := l.get(gid); ok {
+			values[l] = v
+		}
+	}
+	return values
+}
+
+// Go starts fn in a new goroutine whose Locals are released when fn
+// returns, even if it panics.
+func Go(fn func()) {
+	go run(nil, fn)
+}
+
+// GoInherit is like Go, but the new goroutine starts with a copy of the
+// caller's values of all Locals.
+//
+// Only the value references are copied: a pointer value set in the parent
+// is shared with the child.
+func GoInherit(fn func()) {
+	values := snapshot(hack.GoroutineID())
+	go run(values, fn)
+}
+
+func run(values map[*Local]interface{}, fn func()) {
+	gid := hack.GoroutineID()
+	defer release(gid)
+
+	for l, v := range values {
+		l.set(gid, v)
+	}
+
+	fn()
+}
@@ -0,0 +1,144 @@
+package golocal
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+)
+
+func TestLocalGetSetDelete(t *testing.T) {
+	l := NewLocal()
+	defer l.Unregister()
+
+	_, ok := l.Get()
+	assert.Equal(t, false, ok)
+
+	l.Set("foo")
+	v, ok := l.Get()
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "foo", v)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, ok := l.Get()
+		assert.Equal(t, false, ok)
+		l.Set("bar")
+	}()
+	wg.Wait()
+
+	v, _ = l.Get()
+	assert.Equal(t, "foo", v)
+	assert.Equal(t, 2, l.Len())
+
+	l.Delete()
+	_, ok = l.Get()
+	assert.Equal(t, false, ok)
+}
+
+func TestGoCleanup(t *testing.T) {
+	l := NewLocal()
+	defer l.Unregister()
+
+	l.Set("parent")
+	defer Clear()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	Go(func() {
+		defer wg.Done()
+		_, ok := l.Get()
+		assert.Equal(t, false, ok)
+		l.Set("child")
+	})
+	wg.Wait()
+
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestGoPanicCleanup(t *testing.T) {
+	l := NewLocal()
+	defer l.Unregister()
+
+	done := make(chan struct{})
+	Go(func() {
+		defer func() {
+			recover()
+			close(done)
+		}()
+		l.Set(1)
+		panic("boom")
+	})
+	<-done
+
+	// the deferred release in run executes after the recover above
+	for i := 0; l.Len() != 0 && i < 100; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, l.Len())
+}
+
+func TestGoInherit(t *testing.T) {
+	l1, l2 := NewLocal(), NewLocal()
+	defer l1.Unregister()
+	defer l2.Unregister()
+
+	l1.Set("request-1")
+	defer Clear()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	GoInherit(func() {
+		defer wg.Done()
+		v, ok := l1.Get()
+		assert.Equal(t, true, ok)
+		assert.Equal(t, "request-1", v)
+		_, ok = l2.Get()
+		assert.Equal(t, false, ok)
+
+		// child changes are invisible to parent
+		l1.Set("request-2")
+	})
+	wg.Wait()
+
+	v, _ := l1.Get()
+	assert.Equal(t, "request-1", v)
+	assert.Equal(t, 1, l1.Len())
+}
+
+func ExampleGoInherit() {
+	requestId := NewLocal()
+
+	log := func(msg string) {
+		if id, ok := requestId.Get(); ok {
+			fmt.Printf("[%v] %s\n", id, msg)
+		} else {
+			fmt.Println(msg)
+		}
+	}
+
+	done := make(chan struct{})
+	Go(func() {
+		defer close(done)
+		requestId.Set("12345")
+		log("handling")
+
+		child := make(chan struct{})
+		GoInherit(func() {
+			defer close(child)
+			log("async job")
+		})
+		<-child
+	})
+	<-done
+	log("finished")
+
+	// Output:
+	// [12345] handling
+	// [12345] async job
+	// finished
+}
@@ -39,6 +39,13 @@ func (g goroutineLock) CheckNotOn() {
 
 var goroutineSpace = []byte("goroutine ")
 
+// GoroutineID returns the id of the current goroutine.
+//
+// It parses the runtime stack, so it is not cheap: don't call it in hot path.
+func GoroutineID() uint64 {
+	return curGoroutineID()
+}
+
 func curGoroutineID() uint64 {
 	bp := littleBuf.Get().(*[]byte)
 	defer littleBuf.Put(bp)
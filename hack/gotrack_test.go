@@ -26,3 +26,16 @@ func TestGoroutineLock(t *testing.T) {
 		t.Errorf("expected on see panic about running on the wrong goroutine; got %v", e)
 	}
 }
+
+func TestGoroutineID(t *testing.T) {
+	id := GoroutineID()
+	if id != GoroutineID() {
+		t.Fatal("goroutine id changed on the same goroutine")
+	}
+
+	ch := make(chan uint64)
+	go func() { ch <- GoroutineID() }()
+	if other := <-ch; other == id {
+		t.Fatalf("expected different goroutine id, got %d", other)
+	}
+}
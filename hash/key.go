@@ -0,0 +1,87 @@
+package hash
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	offset32 = 2166136261
+	prime32  = 16777619
+)
+
+// Key hashes a map key: strings with fnv-1a, integers and floats with the
+// murmur3 finalizer, and any other key with fnv-1a of its fmt string form.
+// Neither strings nor numbers allocate.
+func Key[K comparable](key K) uint32 {
+	switch k := interface{}(key).(type) {
+	case string:
+		return String(k)
+	case int:
+		return Uint64(uint64(k))
+	case int8:
+		return Uint64(uint64(k))
+	case int16:
+		return Uint64(uint64(k))
+	case int32:
+		return Uint64(uint64(k))
+	case int64:
+		return Uint64(uint64(k))
+	case uint:
+		return Uint64(uint64(k))
+	case uint8:
+		return Uint64(uint64(k))
+	case uint16:
+		return Uint64(uint64(k))
+	case uint32:
+		return Uint64(uint64(k))
+	case uint64:
+		return Uint64(k)
+	case uintptr:
+		return Uint64(uint64(k))
+	case float32:
+		return Float64(float64(k))
+	case float64:
+		return Float64(k)
+	default:
+		return formatted(key)
+	}
+}
+
+// formatted is kept apart so that boxing the key for the switch of Key
+// doesn't escape, fmt taking it.
+func formatted[K comparable](key K) uint32 {
+	hasher := fnv.New32a()
+	fmt.Fprint(hasher, key)
+	return hasher.Sum32()
+}
+
+// String is fnv-1a of s.
+func String(s string) uint32 {
+	h := uint32(offset32)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= prime32
+	}
+	return h
+}
+
+// Float64 is Uint64 of the bits of f, -0 being hashed like 0 as they are
+// equal.
+func Float64(f float64) uint32 {
+	if f == 0 {
+		f = 0
+	}
+	return Uint64(math.Float64bits(f))
+}
+
+// Uint64 is the finalizer of murmur3.
+func Uint64(k uint64) uint32 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return uint32(k)
+}
@@ -0,0 +1,36 @@
+package hash
+
+import (
+	"hash/fnv"
+	"math"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	hasher := fnv.New32a()
+	hasher.Write([]byte("foo"))
+	if Key("foo") != hasher.Sum32() {
+		t.Error("strings should be hashed with fnv-1a")
+	}
+	if Key(42) != Key(int64(42)) || Key(42) == Key(43) {
+		t.Error("integers should be hashed by value")
+	}
+	if Key(0.0) != Key(math.Copysign(0, -1)) || Key(float32(0)) != Key(float32(math.Copysign(0, -1))) {
+		t.Error("-0 should be hashed like 0")
+	}
+	if Key(1.5) == Key(2.5) {
+		t.Error("floats should be hashed by value")
+	}
+	if Key(struct{ a int }{1}) == Key(struct{ a int }{2}) {
+		t.Error("other keys should be hashed by their string form")
+	}
+
+	s, i := string([]byte("foo")), 1<<40
+	if n := testing.AllocsPerRun(100, func() {
+		Key(s)
+		Key(i)
+		Key(uint16(i))
+	}); n != 0 {
+		t.Errorf("%v allocations", n)
+	}
+}
@@ -0,0 +1,134 @@
+package hlc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClockDrift = errors.New("hlc: remote clock drift too large")
+)
+
+type instantProvider interface {
+	Now() time.Time
+}
+
+type systemInstantProvider struct{}
+
+func (i *systemInstantProvider) Now() time.Time {
+	return time.Now()
+}
+
+var (
+	systemTimer = &systemInstantProvider{}
+)
+
+// Clock is a hybrid logical clock whose zero value is ready to use.
+//
+// It is concurrency safe.
+type Clock struct {
+	// MaxDrift is the maximum duration a remote timestamp may be ahead of
+	// the local physical time before Update rejects it.
+	// Zero disables the guard.
+	MaxDrift time.Duration
+
+	mutex sync.Mutex
+
+	last            Timestamp
+	instantProvider instantProvider
+}
+
+// NewClock returns a clock that rejects remote timestamps more than
+// maxDrift ahead of the local physical time.
+func NewClock(maxDrift time.Duration) *Clock {
+	return &Clock{MaxDrift: maxDrift}
+}
+
+func (c *Clock) String() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return fmt.Sprintf("HLC %s with %s MaxDrift", c.last, c.MaxDrift)
+}
+
+// physicalTime returns the wall time in milliseconds since unix epoch.
+func (c *Clock) physicalTime() int64 {
+	if c.instantProvider == nil {
+		c.instantProvider = systemTimer
+	}
+
+	return c.instantProvider.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// Now returns a timestamp for a local or send event.
+// It is always strictly greater than any timestamp returned before.
+func (c *Clock) Now() Timestamp {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	pt := c.physicalTime()
+	if pt > c.last.WallTime {
+		c.last = Timestamp{WallTime: pt}
+	} else {
+		c.tick(c.last.WallTime, c.last.Logical)
+	}
+
+	return c.last
+}
+
+// Update witnesses a timestamp received from a remote node and returns a
+// timestamp for the receive event that is greater than both remote and any
+// timestamp issued before.
+//
+// If remote is ahead of the local physical time by more than MaxDrift,
+// the clock is left untouched and ErrClockDrift is returned.
+func (c *Clock) Update(remote Timestamp) (Timestamp, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	pt := c.physicalTime()
+	if c.MaxDrift > 0 && remote.WallTime-pt > int64(c.MaxDrift/time.Millisecond) {
+		return c.last, ErrClockDrift
+	}
+
+	switch {
+	case pt > c.last.WallTime && pt > remote.WallTime:
+		c.last = Timestamp{WallTime: pt}
+
+	case c.last.WallTime == remote.WallTime:
+		logical := c.last.Logical
+		if remote.Logical > logical {
+			logical = remote.Logical
+		}
+		c.tick(c.last.WallTime, logical)
+
+	case c.last.WallTime > remote.WallTime:
+		c.tick(c.last.WallTime, c.last.Logical)
+
+	default:
+		c.tick(remote.WallTime, remote.Logical)
+	}
+
+	return c.last, nil
+}
+
+// Last returns the most recent timestamp issued without advancing the clock.
+func (c *Clock) Last() Timestamp {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.last
+}
+
+// tick sets the clock right after (wall, logical), carrying into the wall
+// time when the logical counter overflows.
+func (c *Clock) tick(wall int64, logical uint16) {
+	if uint64(logical) == MaxLogical {
+		c.last = Timestamp{WallTime: wall + 1}
+		return
+	}
+
+	c.last = Timestamp{WallTime: wall, Logical: logical + 1}
+}
@@ -0,0 +1,120 @@
+package hlc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+)
+
+type testInstantProvider struct {
+	now time.Time
+}
+
+func (i *testInstantProvider) Now() time.Time {
+	return i.now
+}
+
+func (i *testInstantProvider) advance(d time.Duration) {
+	i.now = i.now.Add(d)
+}
+
+func newTestClock(maxDrift time.Duration) (*Clock, *testInstantProvider) {
+	p := &testInstantProvider{now: time.Unix(1000, 0)}
+	c := NewClock(maxDrift)
+	c.instantProvider = p
+	return c, p
+}
+
+func TestClockNow(t *testing.T) {
+	c, p := newTestClock(0)
+
+	assert.Equal(t, Timestamp{WallTime: 1000000}, c.Now())
+	assert.Equal(t, Timestamp{WallTime: 1000000, Logical: 1}, c.Now())
+	assert.Equal(t, Timestamp{WallTime: 1000000, Logical: 2}, c.Now())
+
+	p.advance(time.Millisecond)
+	assert.Equal(t, Timestamp{WallTime: 1000001}, c.Now())
+
+	// physical clock goes backwards
+	p.advance(-time.Second)
+	assert.Equal(t, Timestamp{WallTime: 1000001, Logical: 1}, c.Now())
+	assert.Equal(t, Timestamp{WallTime: 1000001, Logical: 1}, c.Last())
+}
+
+func TestClockLogicalOverflow(t *testing.T) {
+	c, _ := newTestClock(0)
+	c.last = Timestamp{WallTime: 1000000, Logical: uint16(MaxLogical)}
+	assert.Equal(t, Timestamp{WallTime: 1000001}, c.Now())
+}
+
+func TestClockUpdate(t *testing.T) {
+	c, p := newTestClock(time.Second)
+	c.Now()
+
+	// remote ahead of us
+	ts, err := c.Update(Timestamp{WallTime: 1000500, Logical: 7})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Timestamp{WallTime: 1000500, Logical: 8}, ts)
+
+	// remote behind us
+	ts, err = c.Update(Timestamp{WallTime: 1000100, Logical: 70})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Timestamp{WallTime: 1000500, Logical: 9}, ts)
+
+	// same wall time, larger logical
+	ts, err = c.Update(Timestamp{WallTime: 1000500, Logical: 20})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Timestamp{WallTime: 1000500, Logical: 21}, ts)
+
+	// physical time catches up
+	p.advance(time.Second)
+	ts, err = c.Update(Timestamp{WallTime: 1000500, Logical: 20})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Timestamp{WallTime: 1001000}, ts)
+
+	// too far ahead
+	ts, err = c.Update(Timestamp{WallTime: 1002001})
+	assert.Equal(t, ErrClockDrift, err)
+	assert.Equal(t, Timestamp{WallTime: 1001000}, ts)
+	assert.Equal(t, Timestamp{WallTime: 1001000, Logical: 1}, c.Now())
+}
+
+func TestTimestampEncoding(t *testing.T) {
+	ts := Timestamp{WallTime: 1388834974657, Logical: 42}
+	assert.Equal(t, ts, Decode(ts.Encode()))
+
+	b, err := ts.MarshalBinary()
+	assert.Equal(t, nil, err)
+	var ts1 Timestamp
+	assert.Equal(t, nil, ts1.UnmarshalBinary(b))
+	assert.Equal(t, ts, ts1)
+	assert.Equal(t, ErrInvalidFormat, ts1.UnmarshalBinary(b[1:]))
+
+	b, err = ts.MarshalText()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1388834974657.42", string(b))
+	var ts2 Timestamp
+	assert.Equal(t, nil, ts2.UnmarshalText(b))
+	assert.Equal(t, ts, ts2)
+}
+
+func TestTimestampCompare(t *testing.T) {
+	a := Timestamp{WallTime: 10, Logical: 5}
+	b := Timestamp{WallTime: 10, Logical: 6}
+	c := Timestamp{WallTime: 11}
+
+	assert.Equal(t, -1, a.Compare(b))
+	assert.Equal(t, 1, c.Compare(b))
+	assert.Equal(t, 0, a.Compare(a))
+	assert.Equal(t, true, a.Less(c))
+	assert.Equal(t, true, a.Encode() < b.Encode())
+	assert.Equal(t, true, b.Encode() < c.Encode())
+}
+
+func BenchmarkClockNow(b *testing.B) {
+	c := &Clock{}
+	for i := 0; i < b.N; i++ {
+		c.Now()
+	}
+}
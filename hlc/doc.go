@@ -1,2 +1,8 @@
-// Pakcage hlc implements hybrid logical clock.
+// Package hlc implements hybrid logical clock.
+//
+// A hybrid logical clock combines the physical wall time with a logical
+// counter so that timestamps are causally ordered across nodes while
+// staying close to the wall time.
+//
+// See http://www.cse.buffalo.edu/tech-reports/2014-04.pdf
 package hlc
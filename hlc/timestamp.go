@@ -0,0 +1,110 @@
+package hlc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	LogicalBits = uint64(16) // max 65535 events per millisecond
+	WallBits    = 64 - LogicalBits
+
+	LogicalMask = uint64(1)<<LogicalBits - 1
+	MaxLogical  = LogicalMask
+)
+
+var (
+	ErrInvalidFormat = errors.New("hlc: invalid timestamp format")
+)
+
+// Timestamp is a point in time of a hybrid logical clock.
+//
+// WallTime is the physical component in milliseconds since unix epoch and
+// Logical is the counter that orders events within the same millisecond.
+type Timestamp struct {
+	WallTime int64
+	Logical  uint16
+}
+
+// Decode converts the compact 64-bit encoding back into a Timestamp.
+func Decode(v uint64) Timestamp {
+	return Timestamp{
+		WallTime: int64(v >> LogicalBits),
+		Logical:  uint16(v & LogicalMask),
+	}
+}
+
+// Encode packs the timestamp into 64 bits: wall(48) | logical(16).
+//
+// The encoded values have the same ordering as the timestamps themselves.
+func (t Timestamp) Encode() uint64 {
+	return uint64(t.WallTime)<<LogicalBits | uint64(t.Logical)
+}
+
+// Compare returns -1, 0 or 1 if t is before, equal to or after that.
+func (t Timestamp) Compare(that Timestamp) int {
+	switch {
+	case t.WallTime < that.WallTime:
+		return -1
+	case t.WallTime > that.WallTime:
+		return 1
+	case t.Logical < that.Logical:
+		return -1
+	case t.Logical > that.Logical:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (t Timestamp) Less(that Timestamp) bool {
+	return t.Compare(that) < 0
+}
+
+func (t Timestamp) Equal(that Timestamp) bool {
+	return t == that
+}
+
+func (t Timestamp) IsZero() bool {
+	return t.WallTime == 0 && t.Logical == 0
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%d.%d", t.WallTime, t.Logical)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler with the big endian
+// form of Encode so that the bytes sort the same way as timestamps.
+func (t Timestamp) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, t.Encode())
+	return b, nil
+}
+
+func (t *Timestamp) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return ErrInvalidFormat
+	}
+
+	*t = Decode(binary.BigEndian.Uint64(data))
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, the format is "wall.logical".
+func (t Timestamp) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Timestamp) UnmarshalText(data []byte) error {
+	var (
+		wall    int64
+		logical uint16
+	)
+	if n, err := fmt.Sscanf(string(data), "%d.%d", &wall, &logical); err != nil || n != 2 {
+		return ErrInvalidFormat
+	}
+
+	t.WallTime, t.Logical = wall, logical
+	return nil
+}
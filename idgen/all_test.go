@@ -3,6 +3,7 @@ package idgen
 import (
 	"github.com/cjysmat/assert"
 	"testing"
+	"time"
 )
 
 func TestNextId(t *testing.T) {
@@ -63,3 +64,142 @@ func BenchmarkIdNext(b *testing.B) {
 		id.Next()
 	}
 }
+
+func TestLayout(t *testing.T) {
+	layout := Layout{
+		Epoch:         time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Resolution:    time.Second,
+		TimestampBits: 32,
+		TagBits:       8,
+		WorkerBits:    10,
+		SequenceBits:  13,
+	}
+	_, err := NewIdGeneratorWithLayout(1024, layout)
+	assert.Equal(t, ErrorInvalidWorkerId, err)
+
+	idgen, err := NewIdGeneratorWithLayout(1000, layout)
+	assert.Equal(t, nil, err)
+	for i := 0; i < 3; i++ {
+		idgen.NextWithTag(200)
+	}
+	id, err := idgen.NextWithTag(200)
+	assert.Equal(t, nil, err)
+	ts, tag, wid, seq := idgen.DecodeId(id)
+	assert.Equal(t, int64(200), tag)
+	assert.Equal(t, int64(1000), wid)
+	if seq != 3 && seq != 0 {
+		t.Errorf("seq %d", seq)
+	}
+	if d := time.Now().Unix() - ts/1000; d < 0 || d > 1 {
+		t.Errorf("ts %d", ts)
+	}
+	if ts%1000 != 0 {
+		t.Errorf("ts %d should be whole seconds", ts)
+	}
+	if layout.MaxTime().Year() != 2156 {
+		t.Errorf("max time %s", layout.MaxTime())
+	}
+
+	_, err = idgen.NextWithTag(256)
+	assert.Equal(t, ErrorInvalidTag, err)
+
+	layout.TimestampBits = 33
+	_, err = NewIdGeneratorWithLayout(1, layout)
+	assert.Equal(t, ErrorInvalidLayout, err)
+}
+
+func TestLayoutSequenceExhausted(t *testing.T) {
+	layout := DefaultLayout
+	layout.SequenceBits = 2
+	idgen, _ := NewIdGeneratorWithLayout(1, layout)
+	last := int64(0)
+	for i := 0; i < 20; i++ {
+		n, err := idgen.Next()
+		assert.Equal(t, nil, err)
+		if n <= last {
+			t.Fatalf("expected %d > %d", n, last)
+		}
+		last = n
+	}
+}
+
+func TestClockBackwards(t *testing.T) {
+	var offset time.Duration
+	idgen, _ := NewIdGenerator(1)
+	idgen.now = func() time.Time { return time.Now().Add(-offset) }
+
+	n, err := idgen.Next()
+	assert.Equal(t, nil, err)
+
+	offset = 20 * time.Millisecond
+	_, err = idgen.Next()
+	assert.Equal(t, ErrorClockBackwards, err)
+
+	// wait for the clock within the drift
+	idgen.WithMaxDrift(50 * time.Millisecond)
+	start := time.Now()
+	n1, err := idgen.Next()
+	assert.Equal(t, nil, err)
+	if n1 <= n {
+		t.Errorf("expected %d > %d", n1, n)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("should wait for the clock")
+	}
+
+	offset += 100 * time.Millisecond
+	_, err = idgen.Next()
+	assert.Equal(t, ErrorClockBackwards, err)
+}
+
+func TestClockBackwardsKeepsState(t *testing.T) {
+	now := time.Now()
+	idgen, _ := NewIdGenerator(1)
+	idgen.now = func() time.Time { return now }
+
+	n, err := idgen.Next()
+	assert.Equal(t, nil, err)
+	seq, last := idgen.seq, idgen.lastTimestamp
+
+	now = now.Add(-time.Second)
+	for i := 0; i < 3; i++ {
+		_, err = idgen.Next()
+		assert.Equal(t, ErrorClockBackwards, err)
+	}
+	assert.Equal(t, seq, idgen.seq)
+	assert.Equal(t, last, idgen.lastTimestamp)
+
+	now = now.Add(time.Second)
+	n1, err := idgen.Next()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, n+1, n1)
+}
+
+func TestClockBackwardsBorrow(t *testing.T) {
+	var offset time.Duration
+	layout := DefaultLayout
+	layout.SequenceBits = 1
+	idgen, _ := NewIdGeneratorWithLayout(1, layout)
+	idgen.WithMaxDrift(50 * time.Millisecond).WithBorrow(true)
+	idgen.now = func() time.Time { return time.Now().Add(-offset) }
+
+	n, _ := idgen.Next()
+	offset = 30 * time.Millisecond
+	start := time.Now()
+	// two ids a tick, borrowing future ticks up to the drift
+	for i := 0; i < 6; i++ {
+		n1, err := idgen.Next()
+		assert.Equal(t, nil, err)
+		if n1 <= n {
+			t.Fatalf("expected %d > %d", n1, n)
+		}
+		n = n1
+	}
+	if time.Since(start) > 10*time.Millisecond {
+		t.Error("should borrow instead of waiting")
+	}
+
+	offset = time.Second
+	_, err := idgen.Next()
+	assert.Equal(t, ErrorClockBackwards, err)
+}
@@ -0,0 +1,140 @@
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cjysmat/golib/locking"
+)
+
+var (
+	ErrorLeaseLost   = errors.New("Worker id lease lost")
+	ErrorNoWorkerId  = errors.New("No free worker id")
+	ErrorLeaseActive = errors.New("Worker id already leased")
+)
+
+// WorkerIDAllocator leases worker ids, so that the generators sharing
+// an allocation backend never use the same one at the same time.
+type WorkerIDAllocator interface {
+	// Acquire leases a free worker id in [0, max] and keeps renewing it
+	// till Release.
+	Acquire(max int) (wid int, err error)
+
+	// Lost returns a channel closed once the lease is lost or released,
+	// nil when no id is leased.
+	Lost() <-chan struct{}
+
+	// Release gives the worker id back.
+	Release() error
+}
+
+// NewIdGeneratorWithAllocator returns an IdGenerator of the layout whose
+// worker id is leased from a. Once the lease is lost the generator fails
+// with ErrorLeaseLost, as another one may be given the id. Close releases
+// the lease.
+func NewIdGeneratorWithAllocator(a WorkerIDAllocator, layout Layout) (*IdGenerator, error) {
+	if err := layout.validate(); err != nil {
+		return nil, err
+	}
+	wid, err := a.Acquire(int(layout.MaxWorkerId()))
+	if err != nil {
+		return nil, err
+	}
+
+	this, err := NewIdGeneratorWithLayout(wid, layout)
+	if err != nil {
+		a.Release()
+		return nil, err
+	}
+	this.allocator = a
+	this.lost = a.Lost()
+	return this, nil
+}
+
+// Close releases the worker id of a generator created with an allocator.
+func (this *IdGenerator) Close() error {
+	if this.allocator == nil {
+		return nil
+	}
+	return this.allocator.Release()
+}
+
+// FileAllocator leases worker ids among the processes of a host, by
+// flocking the file wid.<id>.lock of a directory. The kernel drops the
+// lock along with the process, so the lease needs no renewal and is only
+// lost by Release.
+type FileAllocator struct {
+	dir string
+
+	mu   sync.Mutex
+	f    *os.File
+	lost chan struct{}
+}
+
+func NewFileAllocator(dir string) *FileAllocator {
+	return &FileAllocator{dir: dir}
+}
+
+func (this *FileAllocator) Acquire(max int) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.f != nil {
+		return 0, ErrorLeaseActive
+	}
+	if err := os.MkdirAll(this.dir, 0755); err != nil {
+		return 0, err
+	}
+
+	for wid := 0; wid <= max; wid++ {
+		f, err := os.OpenFile(filepath.Join(this.dir, fmt.Sprintf("wid.%d.lock", wid)), os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return 0, err
+		}
+		if err = locking.Flock(f, time.Nanosecond); err != nil {
+			f.Close()
+			if err == locking.ErrTimeout {
+				continue
+			}
+			return 0, err
+		}
+
+		// who holds it, for the curious
+		f.Truncate(0)
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+
+		this.f = f
+		this.lost = make(chan struct{})
+		return wid, nil
+	}
+	return 0, ErrorNoWorkerId
+}
+
+func (this *FileAllocator) Lost() <-chan struct{} {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.f == nil {
+		return nil
+	}
+	return this.lost
+}
+
+func (this *FileAllocator) Release() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.f == nil {
+		return nil
+	}
+	close(this.lost)
+	err := locking.Funlock(this.f)
+	this.f.Close()
+	this.f = nil
+	return err
+}
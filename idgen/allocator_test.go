@@ -0,0 +1,41 @@
+package idgen
+
+import (
+	"testing"
+
+	"github.com/cjysmat/assert"
+)
+
+func TestFileAllocator(t *testing.T) {
+	dir := t.TempDir()
+	layout := DefaultLayout
+	layout.WorkerBits = 1
+
+	g1, err := NewIdGeneratorWithAllocator(NewFileAllocator(dir), layout)
+	assert.Equal(t, nil, err)
+	g2, err := NewIdGeneratorWithAllocator(NewFileAllocator(dir), layout)
+	assert.Equal(t, nil, err)
+	_, err = NewIdGeneratorWithAllocator(NewFileAllocator(dir), layout)
+	assert.Equal(t, ErrorNoWorkerId, err)
+
+	n1, _ := g1.Next()
+	n2, _ := g2.Next()
+	_, _, wid1, _ := g1.DecodeId(n1)
+	_, _, wid2, _ := g2.DecodeId(n2)
+	assert.Equal(t, int64(0), wid1)
+	assert.Equal(t, int64(1), wid2)
+
+	assert.Equal(t, nil, g1.Close())
+	_, err = g1.Next()
+	assert.Equal(t, ErrorLeaseLost, err)
+
+	// released ids are given again
+	a := NewFileAllocator(dir)
+	wid, err := a.Acquire(1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, wid)
+	_, err = a.Acquire(1)
+	assert.Equal(t, ErrorLeaseActive, err)
+	a.Release()
+	g2.Close()
+}
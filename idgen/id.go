@@ -9,9 +9,11 @@ import (
 )
 
 var (
-	ErrorClockBackwards  = errors.New("Clock backwards")
-	ErrorInvalidWorkerId = errors.New("Too big worker id")
-	ErrorInvalidTag      = errors.New("Too big tag")
+	ErrorClockBackwards    = errors.New("Clock backwards")
+	ErrorInvalidWorkerId   = errors.New("Too big worker id")
+	ErrorInvalidTag        = errors.New("Too big tag")
+	ErrorInvalidLayout     = errors.New("Invalid id layout")
+	ErrorTimestampOverflow = errors.New("Timestamp out of layout range")
 )
 
 const (
@@ -39,14 +41,33 @@ type IdGenerator struct {
 	seq           int64
 	lastTimestamp int64
 	randStartSeq  bool
+
+	layout   Layout
+	maxDrift time.Duration
+	borrow   bool
+	now      func() time.Time
+
+	allocator WorkerIDAllocator
+	lost      <-chan struct{}
 }
 
 func NewIdGenerator(wid int) (this *IdGenerator, err error) {
-	this = new(IdGenerator)
-	this.wid = int64(wid)
-	if wid > MaxWorkerId {
+	return NewIdGeneratorWithLayout(wid, DefaultLayout)
+}
+
+// NewIdGeneratorWithLayout returns an IdGenerator issuing ids of the
+// given layout.
+func NewIdGeneratorWithLayout(wid int, layout Layout) (this *IdGenerator, err error) {
+	if err = layout.validate(); err != nil {
+		return nil, err
+	}
+	if wid < 0 || int64(wid) > layout.MaxWorkerId() {
 		return nil, ErrorInvalidWorkerId
 	}
+	this = new(IdGenerator)
+	this.wid = int64(wid)
+	this.layout = layout
+	this.now = time.Now
 	return
 }
 
@@ -60,8 +81,31 @@ func (this *IdGenerator) WithRandStartSeq(r bool) *IdGenerator {
 	return this
 }
 
-func (this *IdGenerator) milliseconds() int64 {
-	return time.Now().UnixNano() / 1e6
+// WithMaxDrift sets how far the clock may go backwards before Next
+// fails with ErrorClockBackwards. Within it Next waits for the clock to
+// catch up, or borrows timestamps, see WithBorrow. Defaults to 0.
+func (this *IdGenerator) WithMaxDrift(d time.Duration) *IdGenerator {
+	this.maxDrift = d
+	return this
+}
+
+// WithBorrow makes the generator keep issuing ids from the last
+// timestamp, and the ones after it, instead of waiting when the clock
+// goes backwards or the sequence is exhausted. It never borrows more
+// than the max drift ahead of the clock.
+func (this *IdGenerator) WithBorrow(b bool) *IdGenerator {
+	this.borrow = b
+	return this
+}
+
+// Layout returns the layout of the generated ids.
+func (this *IdGenerator) Layout() Layout {
+	return this.layout
+}
+
+// DecodeId splits an id of the generator's layout, see Layout.Decode.
+func (this *IdGenerator) DecodeId(id int64) (ts int64, tag int64, wid int64, seq int64) {
+	return this.layout.Decode(id)
 }
 
 func (this *IdGenerator) Next() (int64, error) {
@@ -73,38 +117,87 @@ func (this *IdGenerator) NextWithTag(tag int16) (int64, error) {
 }
 
 func (this *IdGenerator) nextId(tag int16) (int64, error) {
-	if tag > MaxTagId {
+	if tag < 0 || int64(tag) > this.layout.MaxTagId() {
 		return 0, ErrorInvalidTag
 	}
 
+	if this.lost != nil {
+		select {
+		case <-this.lost:
+			return 0, ErrorLeaseLost
+		default:
+		}
+	}
+
 	this.mutex.Lock()
 	defer this.mutex.Unlock()
 
-	ts := this.milliseconds()
-	if ts < this.lastTimestamp {
-		return 0, ErrorClockBackwards
+	ts, err := this.timestamp()
+	if err != nil {
+		return 0, err
 	}
 
-	if this.lastTimestamp == ts {
-		this.seq = (this.seq + 1) & SequenceMask
-		if this.seq == 0 {
-			for ts <= this.lastTimestamp {
-				ts = this.milliseconds()
-			}
+	// seq and lastTimestamp are only committed once the id is sure
+	seq := this.seq
+	if ts <= this.lastTimestamp {
+		seq = (seq + 1) & this.layout.sequenceMask()
+		if seq == 0 {
+			ts = this.lastTimestamp + 1
+		} else {
+			ts = this.lastTimestamp
+		}
+		if ts, err = this.await(ts); err != nil {
+			return 0, err
 		}
 	} else {
 		if this.randStartSeq {
-			this.seq = rand.Int63n(10)
+			seq = rand.Int63n(10) & this.layout.sequenceMask()
 		} else {
-			this.seq = 0
+			seq = 0
 		}
 	}
 
-	this.lastTimestamp = ts
+	if ts >= int64(1)<<this.layout.TimestampBits {
+		return 0, ErrorTimestampOverflow
+	}
+	this.seq, this.lastTimestamp = seq, ts
 
-	r := ((ts - twepoch) << TimestampLeftShift) |
-		(int64(tag) << TagIdShift) |
-		(this.wid << WorkerIdShift) |
-		this.seq
+	l := this.layout
+	r := (ts << l.timestampShift()) |
+		(int64(tag) << l.tagShift()) |
+		(this.wid << l.workerShift()) |
+		seq
 	return r, nil
 }
+
+// timestamp reads the clock in layout ticks since the epoch.
+func (this *IdGenerator) timestamp() (int64, error) {
+	ts := int64(this.now().Sub(this.layout.Epoch) / this.layout.resolution())
+	if ts < 0 {
+		return 0, ErrorTimestampOverflow
+	}
+	return ts, nil
+}
+
+// await makes sure the clock has reached ts, the timestamp an id is
+// about to be issued with. A clock gone back by more than the max drift
+// is an error. Otherwise ts is borrowed if allowed, or waited for.
+func (this *IdGenerator) await(ts int64) (int64, error) {
+	res := this.layout.resolution()
+	for {
+		now, err := this.timestamp()
+		if err != nil {
+			return 0, err
+		}
+		if now >= ts {
+			return now, nil
+		}
+		if back := this.lastTimestamp - now; back > 0 && time.Duration(back)*res > this.maxDrift {
+			return 0, ErrorClockBackwards
+		}
+		if this.borrow && time.Duration(ts-now)*res <= this.maxDrift {
+			return ts, nil
+		}
+		time.Sleep(this.layout.tickTime(ts).Sub(this.now()))
+	}
+}
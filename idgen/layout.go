@@ -0,0 +1,98 @@
+package idgen
+
+import (
+	"time"
+)
+
+// Layout describes how an id is made of, from the highest bits:
+//
+//	ts(TimestampBits) | tag(TagBits) | wid(WorkerBits) | seq(SequenceBits)
+//
+// The bits add up to at most 63, so ids are positive. ts counts
+// Resolution ticks since Epoch.
+type Layout struct {
+	Epoch         time.Time
+	Resolution    time.Duration // time.Millisecond or time.Second, defaults to ms
+	TimestampBits uint64
+	TagBits       uint64
+	WorkerBits    uint64
+	SequenceBits  uint64
+}
+
+// DefaultLayout is the layout of NewIdGenerator and DecodeId.
+var DefaultLayout = Layout{
+	Epoch:         time.Unix(0, twepoch*int64(time.Millisecond)),
+	Resolution:    time.Millisecond,
+	TimestampBits: 64 - 1 - TimestampLeftShift,
+	TagBits:       TagIdBits,
+	WorkerBits:    WorkerIdBits,
+	SequenceBits:  SequenceBits,
+}
+
+func (this Layout) validate() error {
+	switch {
+	case this.Resolution != 0 && this.Resolution != time.Millisecond && this.Resolution != time.Second,
+		this.TimestampBits == 0, this.SequenceBits == 0,
+		this.TagBits > 15, // tags are int16
+		this.TimestampBits+this.TagBits+this.WorkerBits+this.SequenceBits > 63:
+		return ErrorInvalidLayout
+	}
+	return nil
+}
+
+func (this Layout) resolution() time.Duration {
+	if this.Resolution == 0 {
+		return time.Millisecond
+	}
+	return this.Resolution
+}
+
+func (this Layout) MaxWorkerId() int64 {
+	return (1 << this.WorkerBits) - 1
+}
+
+func (this Layout) MaxTagId() int64 {
+	return (1 << this.TagBits) - 1
+}
+
+// MaxTime returns the time after which the layout runs out of timestamps.
+func (this Layout) MaxTime() time.Time {
+	return this.tickTime((int64(1) << this.TimestampBits) - 1)
+}
+
+// tickTime returns the time of ticks since the epoch, without going
+// through a time.Duration that overflows after 292 years.
+func (this Layout) tickTime(ticks int64) time.Time {
+	sec, ms := ticks, int64(0)
+	if this.resolution() == time.Millisecond {
+		sec, ms = ticks/1000, ticks%1000
+	}
+	return time.Unix(this.Epoch.Unix()+sec, int64(this.Epoch.Nanosecond())+ms*1e6)
+}
+
+func (this Layout) sequenceMask() int64 {
+	return (1 << this.SequenceBits) - 1
+}
+
+func (this Layout) workerShift() uint64 {
+	return this.SequenceBits
+}
+
+func (this Layout) tagShift() uint64 {
+	return this.SequenceBits + this.WorkerBits
+}
+
+func (this Layout) timestampShift() uint64 {
+	return this.SequenceBits + this.WorkerBits + this.TagBits
+}
+
+// Decode splits an id of the layout. ts is in unix milliseconds whatever
+// the resolution.
+func (this Layout) Decode(id int64) (ts int64, tag int64, wid int64, seq int64) {
+	t := this.tickTime(id >> this.timestampShift())
+	ts = t.Unix()*1000 + int64(t.Nanosecond())/1e6
+	tag = (id >> this.tagShift()) & this.MaxTagId()
+	wid = (id >> this.workerShift()) & this.MaxWorkerId()
+	seq = id & this.sequenceMask()
+	return
+}
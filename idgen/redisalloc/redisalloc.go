@@ -0,0 +1,78 @@
+// Package redisalloc leases idgen worker ids through the redis lock
+// package.
+package redisalloc
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cjysmat/golib/idgen"
+	"github.com/cjysmat/golib/lock"
+	redis "gopkg.in/redis.v5"
+)
+
+// Allocator is an idgen.WorkerIDAllocator holding the worker id n by the
+// lock.Mutex of the key <key>:<n>, renewed in the background. The lease
+// is lost along with the lock.
+type Allocator struct {
+	rds redis.Cmdable
+	key string
+	ttl time.Duration
+
+	mu sync.Mutex
+	m  *lock.Mutex
+}
+
+var _ idgen.WorkerIDAllocator = (*Allocator)(nil)
+
+func New(rds redis.Cmdable, key string, ttl time.Duration) *Allocator {
+	return &Allocator{rds: rds, key: key, ttl: ttl}
+}
+
+// Acquire takes the lock of the lowest free worker id.
+func (this *Allocator) Acquire(max int) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.m != nil {
+		return 0, idgen.ErrorLeaseActive
+	}
+
+	for wid := 0; wid <= max; wid++ {
+		m := lock.NewMutex(this.rds, this.key+":"+strconv.Itoa(wid), this.ttl)
+		ok, err := m.TryLock()
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			this.m = m
+			return wid, nil
+		}
+	}
+	return 0, idgen.ErrorNoWorkerId
+}
+
+func (this *Allocator) Lost() <-chan struct{} {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.m == nil {
+		return nil
+	}
+	return this.m.Lost()
+}
+
+// Release unlocks the worker id. It returns lock.ErrLockLost if the lease
+// was lost meanwhile.
+func (this *Allocator) Release() error {
+	this.mu.Lock()
+	m := this.m
+	this.m = nil
+	this.mu.Unlock()
+
+	if m == nil {
+		return nil
+	}
+	return m.Unlock()
+}
@@ -0,0 +1,69 @@
+package redisalloc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cjysmat/golib/idgen"
+	redis "gopkg.in/redis.v5"
+)
+
+func TestAllocator(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer c.Close()
+
+	layout := idgen.DefaultLayout
+	layout.WorkerBits = 1
+
+	g1, err := idgen.NewIdGeneratorWithAllocator(New(c, "wid", time.Second), layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := idgen.NewIdGeneratorWithAllocator(New(c, "wid", time.Second), layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = idgen.NewIdGeneratorWithAllocator(New(c, "wid", time.Second), layout); err != idgen.ErrorNoWorkerId {
+		t.Fatal(err)
+	}
+
+	n1, _ := g1.Next()
+	n2, _ := g2.Next()
+	_, _, wid1, _ := g1.DecodeId(n1)
+	_, _, wid2, _ := g2.DecodeId(n2)
+	if wid1 != 0 || wid2 != 1 {
+		t.Errorf("worker ids %d %d", wid1, wid2)
+	}
+	if !s.Exists("wid:0") || !s.Exists("wid:1") {
+		t.Error("worker ids should be locked")
+	}
+
+	// the lock of g2 is taken over
+	s.Set("wid:1", "other")
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err = g2.Next(); err == idgen.ErrorLeaseLost {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("generator should stop once its lease is lost")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err = g1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = g1.Next(); err != idgen.ErrorLeaseLost {
+		t.Error(err)
+	}
+	if s.Exists("wid:0") {
+		t.Error("worker id should be released")
+	}
+}
@@ -0,0 +1,160 @@
+// Package registryalloc leases idgen worker ids through the discovery
+// backends able to claim entries, like consul, etcd or zookeeper.
+package registryalloc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cjysmat/golib/discovery"
+	"github.com/cjysmat/golib/idgen"
+)
+
+// Allocator is an idgen.WorkerIDAllocator holding the worker id n by
+// claiming a copy of its entry whose ID is the one of the entry followed
+// by n, e.g. "idgen-3" for an entry of ID "idgen-". The claimed entry is
+// heartbeated every Interval and the lease lost when the registry lost
+// it, or when no heartbeat succeeded for long enough for it to expire.
+type Allocator struct {
+	registry discovery.Claimer
+	entry    discovery.Entry
+	ttl      time.Duration
+
+	// Interval between heartbeats, ttl/3 by default.
+	Interval time.Duration
+
+	mu      sync.Mutex
+	claimed *discovery.Entry
+	lost    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+var _ idgen.WorkerIDAllocator = (*Allocator)(nil)
+
+func New(registry discovery.Claimer, entry *discovery.Entry, ttl time.Duration) *Allocator {
+	return &Allocator{
+		registry: registry,
+		entry:    *entry,
+		ttl:      ttl,
+		Interval: ttl / 3,
+	}
+}
+
+// Acquire claims the entry of the lowest free worker id.
+func (this *Allocator) Acquire(max int) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.claimed != nil {
+		return 0, idgen.ErrorLeaseActive
+	}
+
+	for wid := 0; wid <= max; wid++ {
+		entry := this.newEntry(wid)
+		err := this.registry.ClaimEntry(entry, this.ttl)
+		if err == discovery.ErrClaimed {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		this.claimed = entry
+		this.lost = make(chan struct{})
+		this.stop = make(chan struct{})
+		this.wg.Add(1)
+		go this.run(entry, this.lost, this.stop)
+		return wid, nil
+	}
+	return 0, idgen.ErrorNoWorkerId
+}
+
+// newEntry returns the entry of wid. Its meta tells instances sharing an
+// address apart, so that none heartbeats the entry of another.
+func (this *Allocator) newEntry(wid int) *discovery.Entry {
+	entry := this.entry
+	entry.ID += strconv.Itoa(wid)
+	entry.Meta = map[string]string{}
+	for k, v := range this.entry.Meta {
+		entry.Meta[k] = v
+	}
+
+	owner := make([]byte, 8)
+	rand.Read(owner)
+	entry.Meta["wid"] = strconv.Itoa(wid)
+	entry.Meta["owner"] = hex.EncodeToString(owner)
+	return &entry
+}
+
+func (this *Allocator) Lost() <-chan struct{} {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.claimed == nil {
+		return nil
+	}
+	return this.lost
+}
+
+// Release stops the heartbeats and deregisters the entry, unless the
+// lease was lost in which case it returns idgen.ErrorLeaseLost. The lease
+// may be lost without the heartbeats knowing yet, the entry claimed by
+// another: Deregister leaves the entry of another alone.
+func (this *Allocator) Release() error {
+	this.mu.Lock()
+	entry := this.claimed
+	this.claimed = nil
+	this.mu.Unlock()
+
+	if entry == nil {
+		return nil
+	}
+
+	close(this.stop)
+	this.wg.Wait()
+	select {
+	case <-this.lost:
+		// the key may be someone else's by now
+		return idgen.ErrorLeaseLost
+	default:
+	}
+	close(this.lost)
+
+	if err := this.registry.Heartbeat(entry, this.ttl); err == discovery.ErrNotRegistered {
+		return idgen.ErrorLeaseLost
+	}
+	return this.registry.Deregister(entry)
+}
+
+func (this *Allocator) run(entry *discovery.Entry, lost, stop chan struct{}) {
+	defer this.wg.Done()
+
+	ticker := time.NewTicker(this.Interval)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := this.registry.Heartbeat(entry, this.ttl)
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+
+		log.WithField("entry", entry.Key()).Errorf("Worker id heartbeat error: %v", err)
+		// give up before the entry could expire, one heartbeat ahead
+		if err == discovery.ErrNotRegistered || time.Since(renewed)+this.Interval >= this.ttl {
+			close(lost)
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package registryalloc
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/golib/discovery"
+	"github.com/cjysmat/golib/discovery/file"
+	"github.com/cjysmat/golib/idgen"
+)
+
+func TestAllocator(t *testing.T) {
+	d := &file.Discovery{}
+	d.Initialize(filepath.Join(t.TempDir(), "cluster"), 0)
+
+	layout := idgen.DefaultLayout
+	layout.WorkerBits = 1
+	entry := &discovery.Entry{Host: "10.0.0.1", Port: "80", ID: "idgen-"}
+
+	a1 := New(d, entry, 60*time.Millisecond)
+	g1, err := idgen.NewIdGeneratorWithAllocator(a1, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same address, another instance
+	a2 := New(d, entry, 60*time.Millisecond)
+	g2, err := idgen.NewIdGeneratorWithAllocator(a2, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = idgen.NewIdGeneratorWithAllocator(New(d, entry, time.Second), layout); err != idgen.ErrorNoWorkerId {
+		t.Fatal(err)
+	}
+
+	// outlives its ttl thanks to the heartbeats
+	time.Sleep(100 * time.Millisecond)
+	entries, err := d.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Key() != "idgen-0" || entries[1].Key() != "idgen-1" {
+		t.Fatalf("entries %v", entries)
+	}
+	n, err := g2.Next()
+	if _, _, wid, _ := g2.DecodeId(n); err != nil || wid != 1 {
+		t.Errorf("worker id %d %v", wid, err)
+	}
+
+	// the entry of g2 is lost
+	d.Deregister(entries[1])
+	select {
+	case <-a2.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease should be lost")
+	}
+	if _, err = g2.Next(); err != idgen.ErrorLeaseLost {
+		t.Error(err)
+	}
+
+	// and claimed by another instance
+	g3, err := idgen.NewIdGeneratorWithAllocator(New(d, entry, time.Second), layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = g2.Close(); err != idgen.ErrorLeaseLost {
+		t.Error(err)
+	}
+	if entries, _ = d.Fetch(); len(entries) != 2 {
+		t.Error("release of a lost lease must not deregister the new holder")
+	}
+
+	if err = g1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = g1.Next(); err != idgen.ErrorLeaseLost {
+		t.Error(err)
+	}
+	g3.Close()
+	if entries, _ = d.Fetch(); len(entries) != 0 {
+		t.Errorf("entries %v", entries)
+	}
+}
+
+func TestReleaseTakenOver(t *testing.T) {
+	d := &file.Discovery{}
+	d.Initialize(filepath.Join(t.TempDir(), "cluster"), 0)
+	entry := &discovery.Entry{Host: "10.0.0.1", Port: "80", ID: "idgen-"}
+
+	// no heartbeat to notice the entry expired
+	a1 := New(d, entry, 20*time.Millisecond)
+	a1.Interval = time.Hour
+	if wid, err := a1.Acquire(0); wid != 0 || err != nil {
+		t.Fatal(wid, err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	a2 := New(d, entry, time.Minute)
+	if wid, err := a2.Acquire(0); wid != 0 || err != nil {
+		t.Fatal("expired worker id should be claimed", wid, err)
+	}
+
+	if err := a1.Release(); err != idgen.ErrorLeaseLost {
+		t.Error(err)
+	}
+	// the claim of a2 is left, no third instance gets the worker id
+	if _, err := New(d, entry, time.Minute).Acquire(0); err != idgen.ErrorNoWorkerId {
+		t.Error("worker id should still be held", err)
+	}
+	if err := a2.Release(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,159 @@
+package lock
+
+import (
+	"sync"
+	"time"
+)
+
+// WaitStats are counters of Lock calls in this process.
+type WaitStats struct {
+	Acquired  uint64 // successful Lock calls
+	Contended uint64 // successful Lock calls that had to wait
+	Timeouts  uint64 // Lock calls given up because ctx was done
+	Waiting   int64  // Lock calls in progress
+
+	WaitTime    time.Duration // total wait of successful Lock calls
+	MaxWaitTime time.Duration
+}
+
+// AvgWaitTime is the mean wait of successful Lock calls.
+func (this WaitStats) AvgWaitTime() time.Duration {
+	if this.Acquired == 0 {
+		return 0
+	}
+	return this.WaitTime / time.Duration(this.Acquired)
+}
+
+func (this *WaitStats) begin() {
+	this.Waiting++
+}
+
+func (this *WaitStats) end(waited time.Duration, contended bool, err error) {
+	this.Waiting--
+	if err != nil {
+		this.Timeouts++
+		return
+	}
+
+	this.Acquired++
+	if contended {
+		this.Contended++
+	}
+	this.WaitTime += waited
+	if waited > this.MaxWaitTime {
+		this.MaxWaitTime = waited
+	}
+}
+
+// The stats of all keys are always kept. Those of each key only once
+// enabled by EnableKeyStats, as a process locking many keys, e.g. one per
+// user, would grow the map without bound.
+var waitStats = struct {
+	sync.Mutex
+	total WaitStats
+	keyed bool
+	m     map[string]*WaitStats
+}{m: make(map[string]*WaitStats)}
+
+// EnableKeyStats turns the stats of each key on or off. Turning them off
+// drops those kept so far.
+func EnableKeyStats(on bool) {
+	waitStats.Lock()
+	defer waitStats.Unlock()
+
+	waitStats.keyed = on
+	if !on {
+		waitStats.m = make(map[string]*WaitStats)
+	}
+}
+
+// keyStats returns the stats of key, nil if not kept.
+func keyStats(key string, create bool) *WaitStats {
+	if !waitStats.keyed {
+		return nil
+	}
+	st := waitStats.m[key]
+	if st == nil && create {
+		st = &WaitStats{}
+		waitStats.m[key] = st
+	}
+	return st
+}
+
+// waitBegin tells if the stats of key are kept, waitEnd is to be called
+// with it.
+func waitBegin(key string) (keyed bool) {
+	waitStats.Lock()
+	defer waitStats.Unlock()
+
+	waitStats.total.begin()
+	if st := keyStats(key, true); st != nil {
+		st.begin()
+		return true
+	}
+	return false
+}
+
+func waitEnd(key string, keyed bool, waited time.Duration, contended bool, err error) {
+	waitStats.Lock()
+	defer waitStats.Unlock()
+
+	waitStats.total.end(waited, contended, err)
+	if !keyed {
+		return
+	}
+	// the stats of key may have been reset or dropped meanwhile
+	if st := keyStats(key, false); st != nil && st.Waiting > 0 {
+		st.end(waited, contended, err)
+	}
+}
+
+// TotalStats returns the wait statistics of all the keys locked by this
+// process.
+func TotalStats() WaitStats {
+	waitStats.Lock()
+	defer waitStats.Unlock()
+
+	return waitStats.total
+}
+
+// Stats returns the wait statistics of every key locked by this process
+// since EnableKeyStats.
+func Stats() map[string]WaitStats {
+	waitStats.Lock()
+	defer waitStats.Unlock()
+
+	r := make(map[string]WaitStats, len(waitStats.m))
+	for key, st := range waitStats.m {
+		r[key] = *st
+	}
+	return r
+}
+
+// KeyStats returns the wait statistics of key, zero unless EnableKeyStats.
+func KeyStats(key string) WaitStats {
+	waitStats.Lock()
+	defer waitStats.Unlock()
+
+	if st := keyStats(key, false); st != nil {
+		return *st
+	}
+	return WaitStats{}
+}
+
+// ResetKeyStats drops the wait statistics of key, keeping the count of
+// Lock calls in progress.
+func ResetKeyStats(key string) {
+	waitStats.Lock()
+	defer waitStats.Unlock()
+
+	st := waitStats.m[key]
+	if st == nil {
+		return
+	}
+	if st.Waiting > 0 {
+		*st = WaitStats{Waiting: st.Waiting}
+	} else {
+		delete(waitStats.m, key)
+	}
+}
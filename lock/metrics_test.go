@@ -0,0 +1,50 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKeyStats(t *testing.T) {
+	_, c := newRedis(t)
+
+	lock := func(key string) {
+		m := NewMutex(c, key, time.Second)
+		if err := m.Lock(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		m.Unlock()
+	}
+
+	// only the total by default
+	before := TotalStats()
+	lock("stats1")
+	if st := TotalStats(); st.Acquired-before.Acquired != 1 || st.Waiting != before.Waiting {
+		t.Errorf("total stats %+v", st)
+	}
+	if _, ok := Stats()["stats1"]; ok {
+		t.Error("key stats should be opt-in")
+	}
+
+	EnableKeyStats(true)
+	defer EnableKeyStats(false)
+	lock("stats1")
+	lock("stats2")
+	if st := KeyStats("stats1"); st.Acquired != 1 {
+		t.Errorf("key stats %+v", st)
+	}
+	if n := len(Stats()); n != 2 {
+		t.Errorf("%d keys, want 2", n)
+	}
+
+	ResetKeyStats("stats1")
+	if _, ok := Stats()["stats1"]; ok {
+		t.Error("reset key stats should be dropped")
+	}
+
+	EnableKeyStats(false)
+	if n := len(Stats()); n != 0 {
+		t.Errorf("%d keys, want none", n)
+	}
+}
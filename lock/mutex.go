@@ -0,0 +1,501 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	redis "gopkg.in/redis.v5"
+)
+
+var (
+	ErrNotLocked = errors.New("lock: not locked")
+	ErrLockLost  = errors.New("lock: lease lost")
+)
+
+// head returns the first live waiter of the fair queue, dropping the
+// ones whose deadline in the waiters zset passed. free tells if the lock
+// is free, a number older than now being an expired lock of Lock/LockRetry.
+//
+// Deadlines are kept in the clock of redis, so the scripts replicate
+// their effects rather than themselves.
+const headLua = `redis.replicate_commands()
+local function mstime()
+	local t = redis.call('time')
+	return tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+local function head(queue, waiters)
+	redis.call('zremrangebyscore', waiters, '-inf', mstime())
+	while true do
+		local h = redis.call('zrange', queue, 0, 0)[1]
+		if not h or redis.call('zscore', waiters, h) then
+			return h
+		end
+		redis.call('zrem', queue, h)
+	end
+end
+local function free(key, now)
+	local v = redis.call('get', key)
+	return v == false or (tonumber(v) ~= nil and tonumber(v) < tonumber(now))
+end
+`
+
+// KEYS[1] lock key, KEYS[2] fencing counter, KEYS[3] fair queue,
+// KEYS[4] waiter deadlines
+// ARGV[1] owner, ARGV[2] ttl ms, ARGV[3] now ns
+//
+// The lock is taken only if no other waiter is first in the queue.
+const takeLua = `if not free(KEYS[1], ARGV[3]) then
+	return 0
+end
+local h = head(KEYS[3], KEYS[4])
+if h and h ~= ARGV[1] then
+	return 0
+end
+if h then
+	redis.call('zrem', KEYS[3], h)
+	redis.call('zrem', KEYS[4], h)
+end
+local token = redis.call('incr', KEYS[2])
+redis.call('set', KEYS[1], ARGV[1], 'px', ARGV[2])
+return token`
+
+const acquireScript = headLua + takeLua
+
+const renewScript = `if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('pexpire', KEYS[1], ARGV[2])
+end
+return 0`
+
+// KEYS[1] lock key, KEYS[2] fair queue, KEYS[3] waiter deadlines
+// ARGV[1] owner, ARGV[2] release channel
+//
+// The first waiter is told it may go through pub/sub.
+const releaseScript = headLua + `if redis.call('get', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('del', KEYS[1])
+redis.call('publish', ARGV[2], head(KEYS[2], KEYS[3]) or '')
+return 1`
+
+// Locker is implemented by Mutex and RWMutex.
+type Locker interface {
+	Lock(ctx context.Context) error
+	Unlock() error
+}
+
+// leaser takes, extends and gives up leases on behalf of an owner.
+// validity is how long the lease is known to be held from the start of
+// the call.
+type leaser interface {
+	acquire(owner string) (token int64, validity time.Duration, err error)
+	extend(owner string) (validity time.Duration, err error)
+	release(owner string) error
+}
+
+// Mutex is a lease based distributed lock on a redis key.
+//
+// The lease is renewed in the background every TTL/3 while the lock is
+// held. If it can't be renewed in time, or the key has been taken over,
+// the lock is lost and Lost is closed a little before the lease expires.
+//
+// Every acquisition gets a fencing token, strictly greater than the tokens
+// of previous acquisitions of the same key. Pass it along with writes so
+// that storage can reject a stale holder.
+//
+// Like sync.Mutex, a Mutex is held by one goroutine at a time.
+type Mutex struct {
+	key string
+	ttl time.Duration
+	l   leaser
+
+	// Interval between two attempts of Lock, jittered by ±50%.
+	// 50ms by default.
+	RetryInterval time.Duration
+
+	// set by NewFairMutex
+	sub  Subscriber
+	fair *single
+
+	mu    sync.Mutex
+	lease *lease
+}
+
+// lease is the state of one acquisition.
+type lease struct {
+	owner  string
+	token  int64
+	lost   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	isLost bool
+}
+
+// MinTTL is the shortest lease, shorter ones are raised to it.
+const MinTTL = 10 * time.Millisecond
+
+// NewMutex creates a Mutex on key with a lease of ttl. The fencing counter
+// is kept in "{key}:fence", which never expires.
+//
+// The keys besides key are named after it with a hash tag, so that they
+// are in its slot of a redis cluster. A key with a hash tag of its own
+// keeps it, one with braces but no hash tag isn't supported in a cluster.
+func NewMutex(rds redis.Cmdable, key string, ttl time.Duration) *Mutex {
+	ttl = leaseTTL(ttl)
+	return newMutex(key, ttl, &single{rds: rds, key: key, ttl: ttl})
+}
+
+func leaseTTL(ttl time.Duration) time.Duration {
+	if ttl < MinTTL {
+		return MinTTL
+	}
+	return ttl
+}
+
+// companion returns the key named key + suffix, in the same cluster slot
+// as key.
+func companion(key, suffix string) string {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			// the hash tag of key stays the first one
+			return key + suffix
+		}
+	}
+	return "{" + key + "}" + suffix
+}
+
+func newMutex(key string, ttl time.Duration, l leaser) *Mutex {
+	return &Mutex{
+		key:           key,
+		ttl:           ttl,
+		l:             l,
+		RetryInterval: 50 * time.Millisecond,
+	}
+}
+
+func (this *Mutex) Key() string {
+	return this.key
+}
+
+// newOwner returns a random lease owner, never a number so that it isn't
+// mistaken for a timestamp of Lock.
+func newOwner() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "o" + hex.EncodeToString(b)
+}
+
+func ms(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+func toInt64(v interface{}) (int64, error) {
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("lock: unexpected script result %v", v)
+	}
+	return n, nil
+}
+
+// TryLock acquires the lock if it is free.
+func (this *Mutex) TryLock() (bool, error) {
+	owner := newOwner()
+	start := time.Now()
+	// token is negative for leasers without fencing tokens
+	token, validity, err := this.l.acquire(owner)
+	if err != nil || token == 0 {
+		return false, err
+	}
+
+	this.held(owner, token, start.Add(validity))
+	return true, nil
+}
+
+// Lock blocks until the lock is acquired or ctx is done. Redis errors
+// are retried.
+//
+// Contenders poll every RetryInterval, unless the Mutex was created by
+// NewFairMutex.
+func (this *Mutex) Lock(ctx context.Context) error {
+	start := time.Now()
+	keyed := waitBegin(this.key)
+
+	var (
+		contended bool
+		err       error
+	)
+	if this.sub != nil {
+		contended, err = this.lockWait(ctx)
+	} else {
+		contended, err = this.lockPoll(ctx)
+	}
+
+	waitEnd(this.key, keyed, time.Since(start), contended, err)
+	return err
+}
+
+func (this *Mutex) lockPoll(ctx context.Context) (contended bool, err error) {
+	for {
+		if ok, _ := this.TryLock(); ok {
+			return contended, nil
+		}
+		contended = true
+
+		timer := time.NewTimer(jitter(this.RetryInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return contended, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(mrand.Int63n(int64(d)))
+}
+
+func (this *Mutex) held(owner string, token int64, until time.Time) {
+	l := &lease{
+		owner: owner,
+		token: token,
+		lost:  make(chan struct{}),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	this.mu.Lock()
+	this.lease = l
+	this.mu.Unlock()
+
+	go this.renew(l, until)
+}
+
+func (this *Mutex) renew(l *lease, until time.Time) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(this.ttl / 3)
+	defer ticker.Stop()
+
+	// the lease is given up a bit before it expires, even if a renewal
+	// is stuck on a dead connection
+	margin := this.ttl / 10
+	expiry := time.NewTimer(time.Until(until.Add(-margin)))
+	defer expiry.Stop()
+
+	type extended struct {
+		validity time.Duration
+		err      error
+	}
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-expiry.C:
+			this.markLost(l)
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		result := make(chan extended, 1)
+		go func() {
+			validity, err := this.l.extend(l.owner)
+			result <- extended{validity, err}
+		}()
+
+		select {
+		case <-l.stop:
+			return
+		case <-expiry.C:
+			this.markLost(l)
+			return
+		case r := <-result:
+			if r.err == ErrLockLost {
+				// expired or taken over
+				this.markLost(l)
+				return
+			}
+			if r.err == nil {
+				if !expiry.Stop() {
+					<-expiry.C
+				}
+				expiry.Reset(time.Until(start.Add(r.validity - margin)))
+			}
+			// else retry on the next tick while the lease may be valid
+		}
+	}
+}
+
+func (this *Mutex) markLost(l *lease) {
+	this.mu.Lock()
+	l.isLost = true
+	this.mu.Unlock()
+	close(l.lost)
+}
+
+// Unlock releases the lock. It returns ErrLockLost if the lease was lost
+// before, in which case someone else may hold the lock already.
+func (this *Mutex) Unlock() error {
+	this.mu.Lock()
+	l := this.lease
+	this.lease = nil
+	this.mu.Unlock()
+
+	if l == nil {
+		return ErrNotLocked
+	}
+
+	close(l.stop)
+	<-l.done
+	if l.isLost {
+		return ErrLockLost
+	}
+	close(l.lost)
+
+	return this.l.release(l.owner)
+}
+
+// Token returns the fencing token of the current acquisition, 0 if the
+// lock isn't held or doesn't provide tokens.
+func (this *Mutex) Token() int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.lease == nil || this.lease.token < 0 {
+		return 0
+	}
+	return this.lease.token
+}
+
+// Lost returns a channel closed when the current lease is lost or
+// released. It is nil if the lock isn't held.
+func (this *Mutex) Lost() <-chan struct{} {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.lease == nil {
+		return nil
+	}
+	return this.lease.lost
+}
+
+// Err returns ErrLockLost once the current lease is lost.
+func (this *Mutex) Err() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.lease != nil && this.lease.isLost {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// single leases a key of one redis instance.
+type single struct {
+	rds redis.Cmdable
+	key string
+	ttl time.Duration
+}
+
+func (this *single) queueKey() string {
+	return companion(this.key, ":queue")
+}
+
+func (this *single) waitersKey() string {
+	return companion(this.key, ":waiters")
+}
+
+func (this *single) channel() string {
+	return companion(this.key, ":released")
+}
+
+func (this *single) acquire(owner string) (int64, time.Duration, error) {
+	return this.eval(acquireScript, owner)
+}
+
+// eval runs acquireScript or fairAcquireScript.
+func (this *single) eval(script, owner string) (int64, time.Duration, error) {
+	v, err := this.rds.Eval(script,
+		[]string{this.key, companion(this.key, ":fence"), this.queueKey(), this.waitersKey(),
+			companion(this.key, ":queue:seq")},
+		owner, ms(this.ttl), time.Now().UnixNano()).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	token, err := toInt64(v)
+	return token, this.ttl, err
+}
+
+func (this *single) extend(owner string) (time.Duration, error) {
+	return this.ttl, evalOwned(this.rds, renewScript, []string{this.key}, owner, ms(this.ttl))
+}
+
+func (this *single) release(owner string) error {
+	return evalOwned(this.rds, releaseScript, []string{this.key, this.queueKey(), this.waitersKey()},
+		owner, this.channel())
+}
+
+// evalOwned runs a script that returns 0 if owner doesn't hold the lease.
+func evalOwned(rds redis.Cmdable, script string, keys []string, args ...interface{}) error {
+	v, err := rds.Eval(script, keys, args...).Result()
+	if err != nil {
+		return err
+	}
+	n, err := toInt64(v)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// SyncDoLocker is SyncDo on a Locker: do is told to stop through timeout
+// when timeout_ms elapses, or when the lease of a Mutex is lost.
+func SyncDoLocker(l Locker, timeout_ms int, do func(timeout chan bool) chan bool) error {
+	d := time.Duration(timeout_ms) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	if err := l.Lock(ctx); err != nil {
+		return fmt.Errorf("lock failed: %v", err)
+	}
+	defer l.Unlock()
+
+	var lost <-chan struct{}
+	if m, ok := l.(interface {
+		Lost() <-chan struct{}
+	}); ok {
+		lost = m.Lost()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	timeout := make(chan bool, 1)
+	doRet := do(timeout)
+	select {
+	case <-timer.C:
+		timeout <- true
+		return fmt.Errorf("timeout!")
+	case <-lost:
+		timeout <- true
+		return ErrLockLost
+	case <-doRet:
+		return nil
+	}
+}
@@ -0,0 +1,164 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "gopkg.in/redis.v5"
+)
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+func TestMutex(t *testing.T) {
+	s, c := newRedis(t)
+
+	m1 := NewMutex(c, "job", time.Second)
+	m2 := NewMutex(c, "job", time.Second)
+	m2.RetryInterval = 5 * time.Millisecond
+
+	if err := m1.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t1 := m1.Token()
+	if t1 != 1 {
+		t.Errorf("token %d", t1)
+	}
+	if s.TTL("job") <= 0 {
+		t.Error("lock key should expire")
+	}
+
+	if ok, err := m2.TryLock(); ok || err != nil {
+		t.Errorf("TryLock %v %v", ok, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := m2.Lock(ctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- m2.Lock(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	lost := m1.Lost()
+	if err := m1.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lost:
+	default:
+		t.Error("Lost should be closed by Unlock")
+	}
+	if err := m1.Unlock(); err != ErrNotLocked {
+		t.Error(err)
+	}
+
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	if m2.Token() <= t1 {
+		t.Errorf("token %d should be greater than %d", m2.Token(), t1)
+	}
+	if err := m2.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Exists("job") {
+		t.Error("lock key should be deleted")
+	}
+}
+
+func TestMutexMinTTL(t *testing.T) {
+	s, c := newRedis(t)
+
+	m := NewMutex(c, "job", time.Nanosecond)
+	if ok, err := m.TryLock(); !ok {
+		t.Fatal(err)
+	}
+	if ttl := s.TTL("job"); ttl != MinTTL {
+		t.Errorf("ttl %s, want %s", ttl, MinTTL)
+	}
+	m.Unlock()
+}
+
+func TestCompanion(t *testing.T) {
+	for key, want := range map[string]string{
+		"job":        "{job}:fence",
+		"user:{42}":  "user:{42}:fence",
+		"{a}b{c}":    "{a}b{c}:fence",
+		"open{brace": "{open{brace}:fence",
+	} {
+		if got := companion(key, ":fence"); got != want {
+			t.Errorf("companion(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestMutexRenew(t *testing.T) {
+	s, c := newRedis(t)
+
+	m := NewMutex(c, "job", 60*time.Millisecond)
+	if ok, err := m.TryLock(); !ok {
+		t.Fatal(err)
+	}
+
+	// renewed every 20ms
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		s.FastForward(20 * time.Millisecond)
+	}
+	if !s.Exists("job") || m.Err() != nil {
+		t.Fatal("lease should be renewed")
+	}
+
+	// someone else took over
+	s.Set("job", "other")
+	select {
+	case <-m.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease should be lost")
+	}
+	if m.Err() != ErrLockLost {
+		t.Error(m.Err())
+	}
+	if err := m.Unlock(); err != ErrLockLost {
+		t.Error(err)
+	}
+	if v, _ := s.Get("job"); v != "other" {
+		t.Error("Unlock must not delete a lock held by someone else")
+	}
+}
+
+func TestMutexRedisDown(t *testing.T) {
+	s, c := newRedis(t)
+
+	start := time.Now()
+	m := NewMutex(c, "job", 300*time.Millisecond)
+	if ok, err := m.TryLock(); !ok {
+		t.Fatal(err)
+	}
+
+	s.Close()
+	select {
+	case <-m.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease should be lost")
+	}
+	if d := time.Since(start); d >= 300*time.Millisecond {
+		t.Errorf("lost after %s, later than the lease", d)
+	}
+}
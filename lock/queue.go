@@ -0,0 +1,128 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	redis "gopkg.in/redis.v5"
+)
+
+// KEYS[1] lock key, KEYS[2] fencing counter, KEYS[3] fair queue,
+// KEYS[4] waiter deadlines, KEYS[5] queue sequence
+// ARGV[1] owner, ARGV[2] ttl ms, ARGV[3] now ns
+//
+// Waiters are ordered by a sequence number and stay in the queue while
+// their deadline, pushed back on every attempt, hasn't passed.
+const fairAcquireScript = headLua + `if redis.call('zscore', KEYS[3], ARGV[1]) == false then
+	redis.call('zadd', KEYS[3], redis.call('incr', KEYS[5]), ARGV[1])
+end
+redis.call('zadd', KEYS[4], mstime() + tonumber(ARGV[2]), ARGV[1])
+` + takeLua
+
+// KEYS[1] lock key, KEYS[2] fair queue, KEYS[3] waiter deadlines
+// ARGV[1] owner, ARGV[2] release channel
+const dequeueScript = headLua + `redis.call('zrem', KEYS[2], ARGV[1])
+redis.call('zrem', KEYS[3], ARGV[1])
+if redis.call('exists', KEYS[1]) == 0 then
+	redis.call('publish', ARGV[2], head(KEYS[2], KEYS[3]) or '')
+end
+return 1`
+
+// Subscriber is implemented by *redis.Client.
+type Subscriber interface {
+	Subscribe(channels ...string) (*redis.PubSub, error)
+}
+
+// PubSubCmdable is a redis.Cmdable that can subscribe, like *redis.Client.
+type PubSubCmdable interface {
+	redis.Cmdable
+	Subscriber
+}
+
+// NewFairMutex creates a Mutex whose Lock waits in a FIFO queue instead of
+// polling. The queue is the sorted set "{key}:queue", the deadlines of
+// the waiters are in "{key}:waiters". On release the first live waiter
+// is woken through the channel "{key}:released", so
+// contenders don't race each other and none of them starves. Waiters
+// also retry every TTL/3, which refreshes their place in the queue and
+// catches leases that expired without release.
+//
+// TryLock and Lock of other Mutexes on the key wait for the queue too, as
+// do Lock, LockRetry and SyncDo.
+func NewFairMutex(rds PubSubCmdable, key string, ttl time.Duration) *Mutex {
+	m := NewMutex(rds, key, ttl)
+	m.sub = rds
+	m.fair = m.l.(*single)
+	return m
+}
+
+// QueueLen returns the number of contenders waiting in the fair queue,
+// including dead ones not yet pruned.
+func (this *Mutex) QueueLen() (int64, error) {
+	s, ok := this.l.(*single)
+	if !ok {
+		return 0, nil
+	}
+	return s.rds.ZCard(s.queueKey()).Result()
+}
+
+func (this *Mutex) lockWait(ctx context.Context) (contended bool, err error) {
+	ps, err := this.sub.Subscribe(this.fair.channel())
+	if err != nil {
+		return this.lockPoll(ctx)
+	}
+
+	// subscribed before the first attempt, so no release is missed
+	wake := make(chan string, 1)
+	go func() {
+		for {
+			msg, err := ps.ReceiveMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case wake <- msg.Payload:
+			default:
+				// a retry is already pending
+			}
+		}
+	}()
+	defer ps.Close()
+
+	owner := newOwner()
+	heartbeat := time.NewTicker(this.ttl / 3)
+	defer heartbeat.Stop()
+
+	for {
+		start := time.Now()
+		token, validity, err := this.fair.eval(fairAcquireScript, owner)
+		if err == nil && token != 0 {
+			this.held(owner, token, start.Add(validity))
+			return contended, nil
+		}
+		contended = true
+
+		if !waitTurn(ctx, wake, heartbeat.C, owner) {
+			this.fair.rds.Eval(dequeueScript,
+				[]string{this.key, this.fair.queueKey(), this.fair.waitersKey()},
+				owner, this.fair.channel())
+			return contended, ctx.Err()
+		}
+	}
+}
+
+// waitTurn waits until owner is told to go, or the next heartbeat.
+func waitTurn(ctx context.Context, wake <-chan string, heartbeat <-chan time.Time, owner string) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case next := <-wake:
+			if next == "" || next == owner {
+				return true
+			}
+		case <-heartbeat:
+			return true
+		}
+	}
+}
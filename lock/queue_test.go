@@ -0,0 +1,160 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitQueueLen(t *testing.T, m *Mutex, n int64) {
+	for i := 0; i < 200; i++ {
+		if l, _ := m.QueueLen(); l == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	l, _ := m.QueueLen()
+	t.Fatalf("queue length %d, want %d", l, n)
+}
+
+func TestFairMutexFIFO(t *testing.T) {
+	_, c := newRedis(t)
+
+	EnableKeyStats(true)
+	defer EnableKeyStats(false)
+	before := KeyStats("fifo")
+
+	// a long ttl: waiters are only woken through pub/sub
+	holder := NewFairMutex(c, "fifo", 10*time.Second)
+	if err := holder.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := NewFairMutex(c, "fifo", 10*time.Second)
+			if err := m.Lock(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			m.Unlock()
+		}(i)
+		waitQueueLen(t, holder, int64(i+1))
+	}
+
+	start := time.Now()
+	holder.Unlock()
+	wg.Wait()
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("waiters took %s, should be woken on release", d)
+	}
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("order %v is not FIFO", order)
+		}
+	}
+
+	st := KeyStats("fifo")
+	if st.Acquired-before.Acquired != 6 || st.Contended-before.Contended != 5 ||
+		st.Waiting != 0 || st.MaxWaitTime == 0 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestFairMutexTimeout(t *testing.T) {
+	_, c := newRedis(t)
+
+	EnableKeyStats(true)
+	defer EnableKeyStats(false)
+	before := KeyStats("to")
+
+	holder := NewFairMutex(c, "to", 10*time.Second)
+	if ok, err := holder.TryLock(); !ok {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	m := NewFairMutex(c, "to", 10*time.Second)
+	if err := m.Lock(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if n, _ := m.QueueLen(); n != 0 {
+		t.Errorf("timed out waiter should leave the queue, %d left", n)
+	}
+	if st := KeyStats("to"); st.Timeouts-before.Timeouts != 1 {
+		t.Errorf("stats %+v", st)
+	}
+
+	// the lock still works for the next one
+	holder.Unlock()
+	if ok, err := m.TryLock(); !ok {
+		t.Fatal(err)
+	}
+	m.Unlock()
+}
+
+func TestFairQueueBlocksBarging(t *testing.T) {
+	s, c := newRedis(t)
+
+	// a live waiter is first in the queue
+	now := time.Now()
+	s.ZAdd("{job}:queue", 1, "w1")
+	s.ZAdd("{job}:waiters", float64(now.Add(time.Second).UnixNano()/1e6), "w1")
+
+	m := NewMutex(c, "job", time.Second)
+	if ok, _ := m.TryLock(); ok {
+		t.Fatal("TryLock should not jump the queue")
+	}
+	if ok, _ := LockRetry(c, "job", 1000, 3); ok {
+		t.Fatal("LockRetry should not jump the queue")
+	}
+
+	// the waiter died
+	s.SetTime(now.Add(2 * time.Second))
+	if ok, err := m.TryLock(); !ok {
+		t.Fatal("dead waiter should be skipped", err)
+	}
+	if n, _ := m.QueueLen(); n != 0 {
+		t.Errorf("dead waiter should be pruned")
+	}
+	m.Unlock()
+}
+
+func TestFairMutexExpiredHolder(t *testing.T) {
+	s, c := newRedis(t)
+
+	// a holder that crashed, its lease expires without release
+	s.Set("exp", "ocrashed")
+	s.SetTTL("exp", 100*time.Millisecond)
+
+	m := NewFairMutex(c, "exp", 90*time.Millisecond)
+	done := make(chan error)
+	go func() {
+		done <- m.Lock(context.Background())
+	}()
+	waitQueueLen(t, m, 1)
+	s.FastForward(time.Second)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter should retry on heartbeat")
+	}
+	m.Unlock()
+}
@@ -9,19 +9,27 @@ import (
 	redis "gopkg.in/redis.v5"
 )
 
+// KEYS[1] lock key, KEYS[2] fair queue, KEYS[3] waiter deadlines
+// ARGV[1] ex, ARGV[2] release channel
+//
+// Like releaseScript, the first waiter of the fair queue is woken.
+const legacyUnlockScript = headLua + `local key = redis.call('get', KEYS[1])
+if key ~= ARGV[1] then
+	return key
+end
+redis.call('del', KEYS[1])
+redis.call('publish', ARGV[2], head(KEYS[2], KEYS[3]) or '')
+return 1`
+
 func UnLock(rds redis.Cmdable, key string, ex interface{}) bool {
 	if fmt.Sprintf("%d", ex) == "0" {
 		// if ex <= 0 {
 		// 如果没有获得锁，不能尝试解锁
 		return false
 	}
-	script := `local key = redis.call('get',KEYS[1])
-if (key == KEYS[2])
-then
-	return redis.call('del',KEYS[1])
-end
-return key`
-	eval := rds.Eval(script, []string{key, fmt.Sprintf("%+v", ex)})
+	eval := rds.Eval(legacyUnlockScript,
+		[]string{key, companion(key, ":queue"), companion(key, ":waiters")},
+		fmt.Sprintf("%+v", ex), companion(key, ":released"))
 	if eval.Err() != nil {
 		log.Printf("unlock failed, err:%+v", eval.Err())
 		return false
@@ -70,36 +78,27 @@ func expiredTime(timeout_ms int) (int64, int64) {
 	return now.UnixNano(), now.Add(time.Duration(timeout_ms * 1000000)).UnixNano()
 }
 
+// KEYS[1] lock key, KEYS[2] fair queue, KEYS[3] waiter deadlines
+// ARGV[1] ex, ARGV[2] now ns
+//
+// SETNX, or GETSET of an expired lock, in one go. Like TryLock, the lock
+// isn't taken while a waiter of NewFairMutex is first in the queue.
+const legacyLockScript = headLua + `if not free(KEYS[1], ARGV[2]) or head(KEYS[2], KEYS[3]) then
+	return 0
+end
+redis.call('set', KEYS[1], ARGV[1])
+return 1`
+
 func Lock(rds redis.Cmdable, key string, timeout_ms int) (bool, string) {
 	now, ex := expiredTime(timeout_ms)
-	setnxCmd := rds.SetNX(key, ex, 0)
-	if setnxCmd.Val() {
-		// log.Println("setnx got a lock, ex:", ex)
-		return true, strconv.FormatInt(ex, 10)
+	v, err := rds.Eval(legacyLockScript,
+		[]string{key, companion(key, ":queue"), companion(key, ":waiters")}, ex, now).Result()
+	if err != nil {
+		log.Println("lock err:", err)
+		return false, "0"
 	}
-	getCmd := rds.Get(key)
-	if getCmd.Val() == "" {
-		getSetCmd := rds.GetSet(key, ex)
-		if getSetCmd.Val() == "" {
-			// log.Println("get nil, then getset got a lock, ex:", ex)
-			return true, strconv.FormatInt(ex, 10)
-		}
-	} else {
-		prevTime, err := getCmd.Int64()
-		if err != nil {
-			log.Println("get key int64 err:", err)
-			return false, "0"
-		}
-		// 已经过期，可以尝试获得锁了
-		if now > prevTime {
-			getSetCmd2 := rds.GetSet(key, ex)
-			if getSetCmd2.Val() == getCmd.Val() {
-				// log.Println("timeout, then getset got a lock, ex:", ex)
-				return true, strconv.FormatInt(ex, 10)
-			}
-		} else {
-			return false, "0"
-		}
+	if n, _ := toInt64(v); n == 1 {
+		return true, strconv.FormatInt(ex, 10)
 	}
 	return false, "0"
 }
@@ -107,30 +106,8 @@ func Lock(rds redis.Cmdable, key string, timeout_ms int) (bool, string) {
 // 重试 retry_times 次
 func LockRetry(rds redis.Cmdable, key string, timeout_ms, retry_times int) (bool, string) {
 	for i := 0; i < retry_times; i++ {
-		now, ex := expiredTime(timeout_ms)
-		setnxCmd := rds.SetNX(key, ex, 0)
-		if setnxCmd.Val() {
-			return true, strconv.FormatInt(ex, 10)
-		}
-		getCmd := rds.Get(key)
-		if getCmd.Val() == "" {
-			getSetCmd := rds.GetSet(key, ex)
-			if getSetCmd.Val() == "" {
-				return true, strconv.FormatInt(ex, 10)
-			}
-		} else {
-			prevTime, err := getCmd.Int64()
-			if err != nil {
-				log.Println("get key int64 err:", err)
-			} else {
-				// 已经过期，可以尝试获得锁了
-				if now > prevTime {
-					getSetCmd2 := rds.GetSet(key, ex)
-					if getSetCmd2.Val() == getCmd.Val() {
-						return true, strconv.FormatInt(ex, 10)
-					}
-				}
-			}
+		if locked, ex := Lock(rds, key, timeout_ms); locked {
+			return true, ex
 		}
 		time.Sleep(time.Millisecond)
 	}
@@ -0,0 +1,131 @@
+package lock
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	redis "gopkg.in/redis.v5"
+)
+
+var ErrNoQuorum = errors.New("lock: no quorum")
+
+// DriftFactor is the share of the TTL that Redlock reserves for clock
+// drift between instances, plus 2ms.
+const DriftFactor = 0.01
+
+// NewRedlock creates a Mutex that holds key on a majority of independent
+// redis instances, following the Redlock algorithm: the lock is acquired
+// only if a majority accepted it and the time spent doing so, plus the
+// clock drift allowance, leaves some of the TTL. Renewal requires a
+// majority too.
+//
+// A majority of instances can't agree on a counter, so Token is always 0.
+func NewRedlock(instances []redis.Cmdable, key string, ttl time.Duration) *Mutex {
+	ttl = leaseTTL(ttl)
+	q := &quorum{ttl: ttl}
+	for _, rds := range instances {
+		q.instances = append(q.instances, &single{rds: rds, key: key, ttl: ttl})
+	}
+	return newMutex(key, ttl, q)
+}
+
+type quorum struct {
+	instances []*single
+	ttl       time.Duration
+}
+
+func (this *quorum) quorum() int {
+	return len(this.instances)/2 + 1
+}
+
+// validity is what remains of the TTL after elapsed and the drift.
+func (this *quorum) validity(start time.Time) time.Duration {
+	drift := time.Duration(float64(this.ttl)*DriftFactor) + 2*time.Millisecond
+	return this.ttl - time.Since(start) - drift
+}
+
+// each calls f on all instances in parallel, returning the number of
+// successes and ErrLockLost replies, and the first other error.
+func (this *quorum) each(f func(*single) error) (ok, lost int, err error) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, s := range this.instances {
+		wg.Add(1)
+		go func(s *single) {
+			defer wg.Done()
+			e := f(s)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case e == nil:
+				ok++
+			case e == ErrLockLost:
+				lost++
+			case err == nil:
+				err = e
+			}
+		}(s)
+	}
+	wg.Wait()
+	return
+}
+
+func (this *quorum) acquire(owner string) (int64, time.Duration, error) {
+	start := time.Now()
+	ok, _, err := this.each(func(s *single) error {
+		token, _, err := s.acquire(owner)
+		if err == nil && token == 0 {
+			err = ErrLockLost
+		}
+		return err
+	})
+
+	validity := this.validity(start)
+	if ok >= this.quorum() && validity > 0 {
+		return -1, validity, nil
+	}
+
+	// give back what we got, including leases whose reply was lost
+	this.release(owner)
+	if ok == 0 && err != nil {
+		return 0, 0, err
+	}
+	return 0, 0, nil
+}
+
+func (this *quorum) extend(owner string) (time.Duration, error) {
+	start := time.Now()
+	ok, lost, err := this.each(func(s *single) error {
+		_, err := s.extend(owner)
+		return err
+	})
+
+	validity := this.validity(start)
+	if ok >= this.quorum() && validity > 0 {
+		return validity, nil
+	}
+	if lost > len(this.instances)-this.quorum() {
+		return 0, ErrLockLost
+	}
+	if err == nil {
+		err = ErrNoQuorum
+	}
+	return 0, err
+}
+
+func (this *quorum) release(owner string) error {
+	ok, _, err := this.each(func(s *single) error {
+		return s.release(owner)
+	})
+	if ok >= this.quorum() {
+		return nil
+	}
+	if err == nil {
+		err = ErrLockLost
+	}
+	return err
+}
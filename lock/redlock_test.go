@@ -0,0 +1,123 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "gopkg.in/redis.v5"
+)
+
+func newRedisN(t *testing.T, n int) ([]*miniredis.Miniredis, []redis.Cmdable) {
+	var (
+		servers []*miniredis.Miniredis
+		clients []redis.Cmdable
+	)
+	for i := 0; i < n; i++ {
+		s, c := newRedis(t)
+		servers = append(servers, s)
+		clients = append(clients, c)
+	}
+	return servers, clients
+}
+
+func TestRedlock(t *testing.T) {
+	servers, clients := newRedisN(t, 3)
+
+	m1 := NewRedlock(clients, "job", time.Second)
+	m2 := NewRedlock(clients, "job", time.Second)
+
+	if ok, err := m1.TryLock(); !ok {
+		t.Fatal(err)
+	}
+	for _, s := range servers {
+		if !s.Exists("job") {
+			t.Error("all instances should be locked")
+		}
+	}
+	if m1.Token() != 0 {
+		t.Error("redlock has no fencing token")
+	}
+	if ok, _ := m2.TryLock(); ok {
+		t.Fatal("lock should be exclusive")
+	}
+
+	if err := m1.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range servers {
+		if s.Exists("job") {
+			t.Error("all instances should be unlocked")
+		}
+	}
+}
+
+func TestRedlockMinority(t *testing.T) {
+	servers, clients := newRedisN(t, 3)
+
+	// a minority is held by someone else
+	servers[0].Set("job", "other")
+
+	m := NewRedlock(clients, "job", time.Second)
+	if ok, err := m.TryLock(); !ok {
+		t.Fatal(err)
+	}
+	if v, _ := servers[0].Get("job"); v != "other" {
+		t.Error("minority holder must be kept")
+	}
+	m.Unlock()
+
+	// a majority is held by someone else
+	servers[1].Set("job", "other")
+	if ok, _ := m.TryLock(); ok {
+		t.Fatal("lock needs a majority")
+	}
+	if servers[2].Exists("job") {
+		t.Error("partial lease should be released")
+	}
+}
+
+func TestRedlockInstanceDown(t *testing.T) {
+	servers, clients := newRedisN(t, 3)
+
+	m := NewRedlock(clients, "job", 150*time.Millisecond)
+	servers[0].Close()
+	if err := m.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// renewals still reach a majority
+	time.Sleep(200 * time.Millisecond)
+	if m.Err() != nil {
+		t.Fatal(m.Err())
+	}
+
+	servers[1].Close()
+	select {
+	case <-m.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease should be lost without a majority")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := NewRedlock(clients, "job2", time.Second).Lock(ctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+}
+
+func TestRedlockValidity(t *testing.T) {
+	_, clients := newRedisN(t, 3)
+
+	// a ttl shorter than the drift allowance can't be valid, NewRedlock
+	// raises it to MinTTL
+	q := &quorum{ttl: time.Millisecond}
+	for _, rds := range clients {
+		q.instances = append(q.instances, &single{rds: rds, key: "job", ttl: q.ttl})
+	}
+	m := newMutex("job", q.ttl, q)
+	if ok, _ := m.TryLock(); ok {
+		t.Error("lock should have no validity left")
+	}
+}
@@ -0,0 +1,198 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	redis "gopkg.in/redis.v5"
+)
+
+// readersLua prunes the readers whose deadline passed from the zset of
+// readers, returning the time of redis in ms.
+const readersLua = `redis.replicate_commands()
+local function prune(readers)
+	local t = redis.call('time')
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+	redis.call('zremrangebyscore', readers, '-inf', now)
+	return now
+end
+`
+
+// KEYS[1] lock key, KEYS[2] fencing counter, KEYS[3] readers,
+// KEYS[4] waiting writer marker
+// ARGV[1] owner, ARGV[2] ttl ms, ARGV[3] now ns
+const writeAcquireScript = readersLua + `local v = redis.call('get', KEYS[1])
+if v ~= false and not (tonumber(v) and tonumber(v) < tonumber(ARGV[3])) then
+	return 0
+end
+prune(KEYS[3])
+if redis.call('zcard', KEYS[3]) > 0 then
+	redis.call('set', KEYS[4], ARGV[1], 'px', ARGV[2])
+	return 0
+end
+redis.call('del', KEYS[4])
+local token = redis.call('incr', KEYS[2])
+redis.call('set', KEYS[1], ARGV[1], 'px', ARGV[2])
+return token`
+
+// KEYS[1] lock key, KEYS[2] readers, KEYS[3] waiting writer marker
+// ARGV[1] owner, ARGV[2] ttl ms, ARGV[3] now ns
+const readAcquireScript = readersLua + `local v = redis.call('get', KEYS[1])
+if v ~= false and not (tonumber(v) and tonumber(v) < tonumber(ARGV[3])) then
+	return 0
+end
+if redis.call('exists', KEYS[3]) == 1 then
+	return 0
+end
+redis.call('zadd', KEYS[2], prune(KEYS[2]) + tonumber(ARGV[2]), ARGV[1])
+if redis.call('pttl', KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call('pexpire', KEYS[2], ARGV[2])
+end
+return 1`
+
+// KEYS[1] readers; ARGV[1] owner, ARGV[2] ttl ms
+const readRenewScript = readersLua + `local now = prune(KEYS[1])
+if redis.call('zscore', KEYS[1], ARGV[1]) == false then
+	return 0
+end
+redis.call('zadd', KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+if redis.call('pttl', KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call('pexpire', KEYS[1], ARGV[2])
+end
+return 1`
+
+// KEYS[1] readers; ARGV[1] owner
+const readReleaseScript = readersLua + `prune(KEYS[1])
+return redis.call('zrem', KEYS[1], ARGV[1])`
+
+// RWMutex is a distributed reader/writer lock on a redis key: many
+// holders of RLock, or one of Lock, which has the fencing token. Leases
+// are renewed like those of Mutex.
+//
+// A writer that waits for readers to leave stops new readers for a TTL,
+// so writers aren't starved.
+//
+// An RWMutex holds at most one lease, read or write. Concurrent readers
+// of a process use an RWMutex each.
+type RWMutex struct {
+	w *Mutex
+	r *Mutex
+}
+
+// NewRWMutex creates an RWMutex on key with a lease of ttl. Besides key,
+// it uses "{key}:fence", "{key}:readers", a sorted set of the deadlines
+// of the readers, and "{key}:wwait", named like those of NewMutex. The
+// write lock excludes Mutex and Lock on the same key.
+func NewRWMutex(rds redis.Cmdable, key string, ttl time.Duration) *RWMutex {
+	ttl = leaseTTL(ttl)
+	return &RWMutex{
+		w: newMutex(key, ttl, &rwWriter{single{rds: rds, key: key, ttl: ttl}}),
+		r: newMutex(key, ttl, &rwReader{rds: rds, key: key, ttl: ttl}),
+	}
+}
+
+func (this *RWMutex) SetRetryInterval(d time.Duration) {
+	this.w.RetryInterval = d
+	this.r.RetryInterval = d
+}
+
+func (this *RWMutex) Lock(ctx context.Context) error {
+	return this.w.Lock(ctx)
+}
+
+func (this *RWMutex) TryLock() (bool, error) {
+	return this.w.TryLock()
+}
+
+func (this *RWMutex) Unlock() error {
+	return this.w.Unlock()
+}
+
+func (this *RWMutex) RLock(ctx context.Context) error {
+	return this.r.Lock(ctx)
+}
+
+func (this *RWMutex) TryRLock() (bool, error) {
+	return this.r.TryLock()
+}
+
+func (this *RWMutex) RUnlock() error {
+	return this.r.Unlock()
+}
+
+// RLocker returns a Locker whose Lock and Unlock are RLock and RUnlock.
+func (this *RWMutex) RLocker() Locker {
+	return this.r
+}
+
+// Token returns the fencing token of the write lock, 0 if not held.
+func (this *RWMutex) Token() int64 {
+	return this.w.Token()
+}
+
+// Lost returns a channel closed when the current lease, read or write, is
+// lost or released. It is nil if no lock is held.
+func (this *RWMutex) Lost() <-chan struct{} {
+	if lost := this.w.Lost(); lost != nil {
+		return lost
+	}
+	return this.r.Lost()
+}
+
+// Err returns ErrLockLost once the current lease is lost.
+func (this *RWMutex) Err() error {
+	if err := this.w.Err(); err != nil {
+		return err
+	}
+	return this.r.Err()
+}
+
+type rwWriter struct {
+	single
+}
+
+func (this *rwWriter) acquire(owner string) (int64, time.Duration, error) {
+	k := this.key
+	v, err := this.rds.Eval(writeAcquireScript,
+		[]string{k, companion(k, ":fence"), companion(k, ":readers"), companion(k, ":wwait")},
+		owner, ms(this.ttl), time.Now().UnixNano()).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	token, err := toInt64(v)
+	return token, this.ttl, err
+}
+
+type rwReader struct {
+	rds redis.Cmdable
+	key string
+	ttl time.Duration
+}
+
+func (this *rwReader) readersKey() string {
+	return companion(this.key, ":readers")
+}
+
+func (this *rwReader) acquire(owner string) (int64, time.Duration, error) {
+	k := this.key
+	v, err := this.rds.Eval(readAcquireScript,
+		[]string{k, this.readersKey(), companion(k, ":wwait")},
+		owner, ms(this.ttl), time.Now().UnixNano()).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := toInt64(v)
+	if n == 1 {
+		// readers have no fencing token
+		n = -1
+	}
+	return n, this.ttl, err
+}
+
+func (this *rwReader) extend(owner string) (time.Duration, error) {
+	return this.ttl, evalOwned(this.rds, readRenewScript, []string{this.readersKey()}, owner, ms(this.ttl))
+}
+
+func (this *rwReader) release(owner string) error {
+	return evalOwned(this.rds, readReleaseScript, []string{this.readersKey()}, owner)
+}
@@ -0,0 +1,171 @@
+package lock
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRWMutex(t *testing.T) {
+	s, c := newRedis(t)
+
+	r1 := NewRWMutex(c, "doc", time.Second)
+	r2 := NewRWMutex(c, "doc", time.Second)
+	w := NewRWMutex(c, "doc", time.Second)
+	w.SetRetryInterval(5 * time.Millisecond)
+
+	if ok, err := r1.TryRLock(); !ok {
+		t.Fatal(err)
+	}
+	if ok, err := r2.TryRLock(); !ok {
+		t.Fatal(err)
+	}
+	if r1.Token() != 0 {
+		t.Error("readers have no token")
+	}
+
+	if ok, _ := w.TryLock(); ok {
+		t.Fatal("writer should wait for readers")
+	}
+	// the waiting writer holds new readers back
+	if ok, _ := NewRWMutex(c, "doc", time.Second).TryRLock(); ok {
+		t.Error("reader should wait for the waiting writer")
+	}
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- w.Lock(context.Background())
+	}()
+
+	r1.RUnlock()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-acquired:
+		t.Fatal("writer should wait for the last reader")
+	default:
+	}
+
+	if err := r2.RUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	if w.Token() == 0 {
+		t.Error("writer should have a token")
+	}
+
+	if ok, _ := r1.TryRLock(); ok {
+		t.Error("reader should wait for the writer")
+	}
+	if ok, _ := NewMutex(c, "doc", time.Second).TryLock(); ok {
+		t.Error("Mutex on the same key should be excluded")
+	}
+
+	if err := w.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := r1.TryRLock(); !ok {
+		t.Error("reader should get the lock")
+	}
+	r1.RUnlock()
+
+	if s.Exists("doc") || s.Exists("{doc}:wwait") {
+		t.Error("keys should be cleaned")
+	}
+}
+
+func TestRWMutexDeadReader(t *testing.T) {
+	s, c := newRedis(t)
+
+	r := NewRWMutex(c, "doc", 90*time.Millisecond)
+	if ok, err := r.TryRLock(); !ok {
+		t.Fatal(err)
+	}
+	// renewed while held
+	time.Sleep(50 * time.Millisecond)
+	s.FastForward(50 * time.Millisecond)
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+
+	// the reader crashes, its lease expires
+	r.r.mu.Lock()
+	close(r.r.lease.stop)
+	r.r.mu.Unlock()
+	s.SetTime(time.Now().Add(time.Second))
+
+	w := NewRWMutex(c, "doc", time.Second)
+	if ok, err := w.TryLock(); !ok {
+		t.Fatal("expired reader should not block writer", err)
+	}
+	if _, err := s.ZScore("{doc}:readers", r.r.lease.owner); err == nil {
+		t.Error("expired reader should be removed")
+	}
+}
+
+func TestLegacyLockCompat(t *testing.T) {
+	s, c := newRedis(t)
+
+	// a live lock of Lock
+	if ok, _ := Lock(c, "job", 1000); !ok {
+		t.Fatal("Lock failed")
+	}
+	m := NewMutex(c, "job", time.Second)
+	if ok, _ := m.TryLock(); ok {
+		t.Fatal("Mutex should respect Lock")
+	}
+
+	// an expired one, never deleted as Lock sets no TTL
+	s.Set("job", strconv.FormatInt(time.Now().Add(-time.Second).UnixNano(), 10))
+	if ok, err := m.TryLock(); !ok {
+		t.Fatal("Mutex should take over an expired Lock", err)
+	}
+	if ok, _ := Lock(c, "job", 1000); ok {
+		t.Error("Lock should respect Mutex")
+	}
+	m.Unlock()
+}
+
+func TestSyncDoLocker(t *testing.T) {
+	_, c := newRedis(t)
+
+	m := NewMutex(c, "job", time.Second)
+	err := SyncDoLocker(m, 1000, func(timeout chan bool) chan bool {
+		done := make(chan bool, 1)
+		if ok, _ := NewMutex(c, "job", time.Second).TryLock(); ok {
+			t.Error("lock should be held while doing")
+		}
+		done <- true
+		return done
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Token() != 0 {
+		t.Error("lock should be released")
+	}
+
+	err = SyncDoLocker(m, 20, func(timeout chan bool) chan bool {
+		done := make(chan bool, 1)
+		go func() {
+			<-timeout
+			done <- true
+		}()
+		return done
+	})
+	if err == nil {
+		t.Error("should time out")
+	}
+
+	rw := NewRWMutex(c, "doc", time.Second)
+	err = SyncDoLocker(rw.RLocker(), 1000, func(timeout chan bool) chan bool {
+		done := make(chan bool, 1)
+		done <- true
+		return done
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -39,7 +39,6 @@ func Flock(f *os.File, timeout time.Duration) error {
 		}
 
 		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
-		fmt.Println(err, int(f.Fd()))
 		if err == nil {
 			return nil
 		} else if err != syscall.EWOULDBLOCK {
@@ -2,17 +2,20 @@
 package retrier
 
 import (
+	"context"
 	"math/rand"
+	"sync"
 	"time"
 )
 
 // Retrier implements the "retriable" resiliency pattern, abstracting out the process of retrying a failed action
-// a certain number of times with an optional back-off between each retry.
+// a certain number of times with an optional back-off between each retry. It is safe for concurrent use.
 type Retrier struct {
 	backoff []time.Duration
 	class   Classifier
 	jitter  float64
 	rand    *rand.Rand
+	randMu  sync.Mutex
 }
 
 // New constructs a Retrier with the given backoff pattern and classifier. The length of the backoff pattern
@@ -37,9 +40,17 @@ func New(backoff []time.Duration, class Classifier) *Retrier {
 // before retrying. If the total number of retries is exceeded then the return value of the work function
 // is returned to the caller regardless.
 func (r *Retrier) Run(work func() error) error {
+	return r.RunCtx(context.Background(), func(ctx context.Context) error {
+		return work()
+	})
+}
+
+// RunCtx is like Run, passing ctx to the work function. It stops waiting for the next retry as soon as ctx
+// is done, returning ctx.Err().
+func (r *Retrier) RunCtx(ctx context.Context, work func(ctx context.Context) error) error {
 	retries := 0
 	for {
-		ret := work()
+		ret := work(ctx)
 
 		switch r.class.Classify(ret) {
 		case Succeed, Fail:
@@ -48,13 +59,23 @@ func (r *Retrier) Run(work func() error) error {
 			if retries >= len(r.backoff) {
 				return ret
 			}
-			time.Sleep(r.calcSleep(retries))
+
+			timer := time.NewTimer(r.calcSleep(retries))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
 			retries++
 		}
 	}
 }
 
 func (r *Retrier) calcSleep(i int) time.Duration {
+	r.randMu.Lock()
+	defer r.randMu.Unlock()
+
 	// take a random float in the range (-r.jitter, +r.jitter) and multiply it by the base amount
 	return r.backoff[i] + time.Duration(((r.rand.Float64()*2)-1)*r.jitter*float64(r.backoff[i]))
 }
@@ -1,6 +1,7 @@
 package retrier
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -127,3 +128,34 @@ func ExampleRetrier() {
 		// handle the case where the work failed three times
 	}
 }
+
+func TestRetrierCtx(t *testing.T) {
+	r := New([]time.Duration{0, 10 * time.Millisecond}, WhitelistClassifier{errFoo})
+
+	work := genWork([]error{errFoo, errFoo})
+	err := r.RunCtx(context.Background(), func(ctx context.Context) error {
+		return work()
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if i != 3 {
+		t.Error("run wrong number of times")
+	}
+
+	r = New([]time.Duration{time.Hour}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	i = 0
+	err = r.RunCtx(ctx, func(ctx context.Context) error {
+		i++
+		return errFoo
+	})
+	if err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	if i != 1 {
+		t.Error("run wrong number of times")
+	}
+}
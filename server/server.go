@@ -1,17 +1,23 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"github.com/cjysmat/golib/config"
 	"github.com/cjysmat/golib/signal"
-	conf "github.com/cjysmat/jsconf"
 	log "github.com/cjysmat/log4go"
 	"os"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 )
 
+var ErrConfigNotLoaded = errors.New("server config not loaded")
+
 type Server struct {
-	*conf.Conf
+	// Config is set by LoadConfig or LoadConfigFrom.
+	Config *config.Gosh
 
 	Name      string
 	StartedAt time.Time
@@ -26,23 +32,101 @@ func NewServer(name string) (this *Server) {
 	return
 }
 
+// LoadConfig loads config from a JSON, YAML or TOML file, see
+// config.FileSource. It panics if the file can't be loaded.
 func (this *Server) LoadConfig(fn string) *Server {
 	log.Info("Server[%s %s@%s] loading config file: %s", this.Name, BuildId, Version, fn)
 
-	var err error
-	this.Conf, err = conf.Load(fn)
-	if err != nil {
+	return this.LoadConfigFrom(config.NewFileSource(fn))
+}
+
+// LoadConfigFrom loads config from sources in order of precedence, the
+// same way as config.Gosh does. It panics if a source can't be loaded.
+func (this *Server) LoadConfigFrom(sources ...config.Source) *Server {
+	log.Info("Server[%s %s@%s] loading config from %d sources", this.Name, BuildId, Version, len(sources))
+
+	this.Config = config.New(sources...)
+	if err := this.Config.Load(context.Background()); err != nil {
 		panic(err)
 	}
 
 	return this
 }
 
+// Unmarshal decodes the config into v, reloading the sources.
+func (this *Server) Unmarshal(v interface{}) error {
+	if this.Config == nil {
+		return ErrConfigNotLoaded
+	}
+	return this.Config.Unmarshal(v)
+}
+
+// get decodes the loaded value of key, a dot separated path as in
+// "db.host", into v, which is left untouched if missing or invalid.
+func (this *Server) get(key string, v interface{}) {
+	if this.Config == nil {
+		return
+	}
+
+	if _, err := this.Config.Get(strings.Replace(key, ".", "/", -1), v); err != nil {
+		log.Error("Server[%s] config %v", this.Name, err)
+	}
+}
+
+// String returns the config value of key, or defaultValue if missing or
+// invalid, as do the other accessors for their types.
+func (this *Server) String(key string, defaultValue string) string {
+	this.get(key, &defaultValue)
+	return defaultValue
+}
+
+func (this *Server) Int(key string, defaultValue int) int {
+	this.get(key, &defaultValue)
+	return defaultValue
+}
+
+func (this *Server) Int64(key string, defaultValue int64) int64 {
+	this.get(key, &defaultValue)
+	return defaultValue
+}
+
+func (this *Server) Bool(key string, defaultValue bool) bool {
+	this.get(key, &defaultValue)
+	return defaultValue
+}
+
+func (this *Server) Float(key string, defaultValue float64) float64 {
+	this.get(key, &defaultValue)
+	return defaultValue
+}
+
+func (this *Server) Duration(key string, defaultValue time.Duration) time.Duration {
+	this.get(key, &defaultValue)
+	return defaultValue
+}
+
+func (this *Server) Strings(key string, defaultValue []string) []string {
+	this.get(key, &defaultValue)
+	return defaultValue
+}
+
+func (this *Server) Ints(key string, defaultValue []int) []int {
+	this.get(key, &defaultValue)
+	return defaultValue
+}
+
 func (this *Server) Launch() *Server {
 	this.StartedAt = time.Now()
 	this.hostname, _ = os.Hostname()
 	this.pid = os.Getpid()
 	signal.Ignore(syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGSTOP)
-	runtime.GOMAXPROCS(this.Int("max_cpu", runtime.NumCPU()))
+	runtime.GOMAXPROCS(this.maxCpu())
 	return this
 }
+
+func (this *Server) maxCpu() int {
+	if n := this.Int("max_cpu", 0); n > 0 {
+		return n
+	}
+	return runtime.NumCPU()
+}
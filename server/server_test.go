@@ -0,0 +1,67 @@
+package server
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cjysmat/assert"
+	"github.com/cjysmat/golib/config"
+)
+
+func TestConfigAccessors(t *testing.T) {
+	srv := NewServer("test")
+	assert.Equal(t, 4, srv.Int("max_cpu", 4)) // not loaded
+
+	fn := filepath.Join(t.TempDir(), "server.json")
+	assert.Equal(t, nil, ioutil.WriteFile(fn, []byte(`{
+		"max_cpu": 2,
+		"debug": true,
+		"ratio": 0.5,
+		"port": "x",
+		"tags": ["a", "b"],
+		"ids": [1, 2],
+		"db": {"host": "h", "timeout": "2s", "pool": 8}
+	}`), 0644))
+	srv.LoadConfig(fn)
+
+	assert.Equal(t, 2, srv.Int("max_cpu", 4))
+	assert.Equal(t, 2, srv.maxCpu())
+	assert.Equal(t, true, srv.Bool("debug", false))
+	assert.Equal(t, 0.5, srv.Float("ratio", 0))
+	assert.Equal(t, []string{"a", "b"}, srv.Strings("tags", nil))
+	assert.Equal(t, []int{1, 2}, srv.Ints("ids", nil))
+	assert.Equal(t, "h", srv.String("db.host", ""))
+	assert.Equal(t, int64(8), srv.Int64("db.pool", 0))
+	assert.Equal(t, 2*time.Second, srv.Duration("db.timeout", 0))
+
+	// missing or invalid
+	assert.Equal(t, "d", srv.String("db.user", "d"))
+	assert.Equal(t, 1, srv.Int("port", 1))
+
+	var c struct {
+		Host string `config:"db/host"`
+	}
+	assert.Equal(t, nil, srv.Unmarshal(&c))
+	assert.Equal(t, "h", c.Host)
+}
+
+func TestLoadConfigFrom(t *testing.T) {
+	srv := NewServer("test")
+	assert.Equal(t, ErrConfigNotLoaded, srv.Unmarshal(&struct{}{}))
+
+	srv.LoadConfigFrom(
+		config.Values{"max_cpu": []byte("0")},
+		config.Values{"name": []byte("demo"), "max_cpu": []byte("2")},
+	)
+	assert.Equal(t, "demo", srv.String("name", ""))
+	assert.Equal(t, 0, srv.Int("max_cpu", 4))
+	assert.NotEqual(t, 0, srv.maxCpu())
+
+	defer func() {
+		assert.NotEqual(t, nil, recover())
+	}()
+	srv.LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	t.Error("LoadConfig of a missing file should panic")
+}
@@ -3,9 +3,11 @@ package syslogng
 import (
 	"fmt"
 	"net"
+	"sync"
 )
 
 var (
+	mu       sync.Mutex
 	conn     net.Conn
 	sockPath = "/tmp/als.sock"
 )
@@ -18,28 +20,55 @@ func connIfNeccessary() error {
 	var err error
 	conn, err = net.Dial("unix", sockPath)
 	if err != nil {
+		conn = nil
 		return err
 	}
 
 	return nil
 }
 
+// closeOnError drops the connection after a failed write so that the
+// next call redials.
+func closeOnError(err error) {
+	if err != nil && conn != nil {
+		conn.Close()
+		conn = nil
+	}
+}
+
 func SetSocketPath(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+
 	sockPath = path
+	if conn != nil {
+		conn.Close()
+		conn = nil
+	}
 }
 
 func Printf(format string, args ...interface{}) (n int, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
 	err = connIfNeccessary()
 	if err != nil {
 		return 0, err
 	}
-	return fmt.Fprintf(conn, format, args...)
+	n, err = fmt.Fprintf(conn, format, args...)
+	closeOnError(err)
+	return
 }
 
 func Println(args ...interface{}) (n int, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
 	err = connIfNeccessary()
 	if err != nil {
 		return 0, err
 	}
-	return fmt.Fprintln(conn, args...)
+	n, err = fmt.Fprintln(conn, args...)
+	closeOnError(err)
+	return
 }
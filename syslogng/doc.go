@@ -1,4 +1,22 @@
 /*
 A client to write to and subscribe syslog-ng unix domain socket.
+
+Printf and Println write raw lines to the socket set by SetSocketPath.
+Writer speaks RFC 5424 or RFC 3164 over unix, unixgram, udp, tcp or TLS:
+
+	w, err := syslogng.Dial(syslogng.WriterConfig{
+	    Network:  "tcp",
+	    Addr:     "logs:6514",
+	    Facility: syslogng.FacilityLocal0,
+	})
+	log.SetOutput(w)
+
+Listen is the server side, it parses RFC 5424, RFC 3164 and octet
+counted frames into Message:
+
+	s, err := syslogng.Listen("unix", "/tmp/als.sock")
+	for m := range s.Messages(1024) {
+	    ...
+	}
 */
 package syslogng
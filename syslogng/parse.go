@@ -0,0 +1,244 @@
+package syslogng
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Message is a syslog message received by a Server.
+type Message struct {
+	Format   Format
+	Facility Facility
+	Severity Severity
+
+	// Zero if the sender didn't provide it.
+	Timestamp time.Time
+
+	Hostname string
+	AppName  string // TAG of RFC 3164
+	ProcID   string
+	MsgID    string
+	SD       []SDElement
+	Msg      string
+
+	// Filled by the Server.
+	Source   string
+	Received time.Time
+}
+
+var ErrBadMessage = errors.New("syslogng: malformed message")
+
+func badMessage(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", ErrBadMessage, fmt.Sprintf(format, args...))
+}
+
+// Parse parses a RFC 5424 or RFC 3164 message. A message without PRI is
+// taken as a RFC 3164 user.notice message, as that RFC says. now supplies
+// the year and location of RFC 3164 timestamps.
+func Parse(data []byte, now time.Time) (*Message, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+
+	m := &Message{
+		Format:   RFC3164,
+		Facility: FacilityUser,
+		Severity: SeverityNotice,
+	}
+	if len(data) == 0 || data[0] != '<' {
+		m.Msg = string(data)
+		return m, nil
+	}
+
+	end := bytes.IndexByte(data, '>')
+	if end < 2 || end > 4 {
+		return nil, badMessage("bad PRI")
+	}
+	pri, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || pri > 191 {
+		return nil, badMessage("bad PRI %q", data[1:end])
+	}
+	m.Facility, m.Severity = Facility(pri>>3), Severity(pri&7)
+	data = data[end+1:]
+
+	if len(data) >= 2 && data[0] == '1' && data[1] == ' ' {
+		m.Format = RFC5424
+		return m, parse5424(m, data[2:])
+	}
+
+	parse3164(m, data, now)
+	return m, nil
+}
+
+func nextField(data []byte) (field string, rest []byte, ok bool) {
+	i := bytes.IndexByte(data, ' ')
+	if i < 0 {
+		return string(data), nil, len(data) > 0
+	}
+	return string(data[:i]), data[i+1:], i > 0
+}
+
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+func parse5424(m *Message, data []byte) error {
+	var (
+		fields [5]string
+		ok     bool
+	)
+	for i := range fields {
+		if fields[i], data, ok = nextField(data); !ok {
+			return badMessage("missing header field %d", i)
+		}
+	}
+
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return badMessage("bad timestamp %q", fields[0])
+		}
+		m.Timestamp = ts
+	}
+	m.Hostname = nilValue(fields[1])
+	m.AppName = nilValue(fields[2])
+	m.ProcID = nilValue(fields[3])
+	m.MsgID = nilValue(fields[4])
+
+	if len(data) == 0 {
+		return badMessage("missing structured data")
+	}
+	if data[0] == '-' {
+		data = data[1:]
+	} else {
+		var err error
+		if m.SD, data, err = parseSD(data); err != nil {
+			return err
+		}
+	}
+
+	if len(data) > 0 {
+		if data[0] != ' ' {
+			return badMessage("no space before MSG")
+		}
+		data = bytes.TrimPrefix(data[1:], []byte("\xef\xbb\xbf"))
+		m.Msg = string(data)
+	}
+	return nil
+}
+
+func parseSD(data []byte) ([]SDElement, []byte, error) {
+	var sd []SDElement
+	for len(data) > 0 && data[0] == '[' {
+		data = data[1:]
+
+		var e SDElement
+		i := bytes.IndexAny(data, " ]")
+		if i <= 0 {
+			return nil, nil, badMessage("bad SD-ID")
+		}
+		e.ID, data = string(data[:i]), data[i:]
+
+		for len(data) > 0 && data[0] == ' ' {
+			data = data[1:]
+			i = bytes.Index(data, []byte(`="`))
+			if i <= 0 {
+				return nil, nil, badMessage("bad SD-PARAM in %s", e.ID)
+			}
+			p := SDParam{Name: string(data[:i])}
+			data = data[i+2:]
+
+			var val []byte
+			for {
+				if len(data) == 0 {
+					return nil, nil, badMessage("unterminated SD-PARAM %s", p.Name)
+				}
+				c := data[0]
+				data = data[1:]
+				if c == '"' {
+					break
+				}
+				if c == '\\' && len(data) > 0 &&
+					(data[0] == '"' || data[0] == '\\' || data[0] == ']') {
+					c = data[0]
+					data = data[1:]
+				}
+				val = append(val, c)
+			}
+			p.Value = string(val)
+			e.Params = append(e.Params, p)
+		}
+
+		if len(data) == 0 || data[0] != ']' {
+			return nil, nil, badMessage("unterminated SD-ELEMENT %s", e.ID)
+		}
+		data = data[1:]
+		sd = append(sd, e)
+	}
+
+	if sd == nil {
+		return nil, nil, badMessage("bad structured data")
+	}
+	return sd, data, nil
+}
+
+// parse3164 is lenient as RFC 3164 only describes common practice: any
+// part it can't recognise ends up in Msg.
+func parse3164(m *Message, data []byte, now time.Time) {
+	if len(data) >= len(time.Stamp)+1 && data[len(time.Stamp)] == ' ' {
+		ts, err := time.ParseInLocation(time.Stamp, string(data[:len(time.Stamp)]), now.Location())
+		if err == nil {
+			// no year on the wire, a date in the future is from last year
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			m.Timestamp = ts
+			data = data[len(time.Stamp)+1:]
+		}
+	}
+	if m.Timestamp.IsZero() {
+		m.Msg = string(data)
+		return
+	}
+
+	// HOSTNAME is omitted by local senders, TAG ends with '[' or ':'
+	word, rest, _ := nextField(data)
+	if !isTag(word) {
+		m.Hostname = word
+		data = rest
+	}
+
+	i := bytes.IndexAny(data, "[: ")
+	if i <= 0 || i > 48 || data[i] == ' ' {
+		m.Msg = string(data)
+		return
+	}
+	tag, rest := string(data[:i]), data[i:]
+
+	if rest[0] == '[' {
+		j := bytes.IndexByte(rest, ']')
+		if j < 0 {
+			m.Msg = string(data)
+			return
+		}
+		m.ProcID = string(rest[1:j])
+		rest = rest[j+1:]
+	}
+	if len(rest) == 0 || rest[0] != ':' {
+		m.Msg = string(data)
+		return
+	}
+
+	m.AppName = tag
+	m.Msg = string(bytes.TrimPrefix(rest[1:], []byte(" ")))
+}
+
+func isTag(word string) bool {
+	return len(word) > 0 &&
+		(word[len(word)-1] == ':' || bytes.IndexByte([]byte(word), '[') > 0)
+}
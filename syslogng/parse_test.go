@@ -0,0 +1,121 @@
+package syslogng
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse5424(t *testing.T) {
+	now := time.Date(2016, 3, 7, 10, 0, 0, 0, time.UTC)
+
+	m, err := Parse([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 `+
+		`[exampleSDID@32473 iut="3" eventSource="App\"lic\]a\\tion"][examplePriority@32473 class="high"] `+
+		"\xef\xbb\xbfAn application event\n"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &Message{
+		Format:    RFC5424,
+		Facility:  FacilityLocal4,
+		Severity:  SeverityNotice,
+		Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+		Hostname:  "mymachine.example.com",
+		AppName:   "evntslog",
+		MsgID:     "ID47",
+		SD: []SDElement{
+			{ID: "exampleSDID@32473", Params: []SDParam{{"iut", "3"}, {"eventSource", `App"lic]a\tion`}}},
+			{ID: "examplePriority@32473", Params: []SDParam{{"class", "high"}}},
+		},
+		Msg: "An application event",
+	}
+	if !reflect.DeepEqual(exp, m) {
+		t.Errorf("got %+v", m)
+	}
+
+	m, err = Parse([]byte(`<13>1 - - - - - -`), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Timestamp.IsZero() || m.Hostname != "" || m.SD != nil || m.Msg != "" {
+		t.Errorf("got %+v", m)
+	}
+
+	for _, bad := range []string{
+		`<13>1 - - -`,
+		`<13>1 yesterday host app - - - msg`,
+		`<13>1 - host app - - [id k="v] msg`,
+		`<13>1 - host app - - [id k=v] msg`,
+		`<13>1 - host app - - [id`,
+		`<13>1 - host app - - -msg`,
+		`<192>1 - - - - - -`,
+		`<x>1 - - - - - -`,
+	} {
+		if _, err = Parse([]byte(bad), now); err == nil {
+			t.Errorf("%s should fail", bad)
+		}
+	}
+}
+
+func TestParse3164(t *testing.T) {
+	now := time.Date(2016, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		in  string
+		exp Message
+	}{
+		{
+			"<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed",
+			Message{Facility: FacilityAuth, Severity: SeverityCrit,
+				Timestamp: time.Date(2015, 10, 11, 22, 14, 15, 0, time.UTC),
+				Hostname:  "mymachine", AppName: "su", ProcID: "230", Msg: "'su root' failed"},
+		},
+		{
+			"<13>Jan  2 09:00:00 cron: job done",
+			Message{Facility: FacilityUser, Severity: SeverityNotice,
+				Timestamp: time.Date(2016, 1, 2, 9, 0, 0, 0, time.UTC),
+				AppName:   "cron", Msg: "job done"},
+		},
+		{
+			"<13>Jan  2 09:00:00 host free text",
+			Message{Facility: FacilityUser, Severity: SeverityNotice,
+				Timestamp: time.Date(2016, 1, 2, 9, 0, 0, 0, time.UTC),
+				Hostname:  "host", Msg: "free text"},
+		},
+		{
+			"<0>not a date",
+			Message{Facility: FacilityKern, Severity: SeverityEmerg, Msg: "not a date"},
+		},
+		{
+			":app,info,1457344800,{}\n",
+			Message{Facility: FacilityUser, Severity: SeverityNotice, Msg: ":app,info,1457344800,{}"},
+		},
+	}
+	for _, c := range cases {
+		m, err := Parse([]byte(c.in), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.exp.Format = RFC3164
+		if !reflect.DeepEqual(&c.exp, m) {
+			t.Errorf("%s: got %+v", c.in, m)
+		}
+	}
+}
+
+func TestParseWriterOutput(t *testing.T) {
+	w := testWriter(WriterConfig{Facility: FacilityLocal7})
+	sd := []SDElement{{ID: "a@1", Params: []SDParam{{"k", `"]\`}}}}
+
+	m, err := Parse(w.format(testTime, SeverityDebug, "M", sd, "hi"), testTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Facility != FacilityLocal7 || m.Severity != SeverityDebug ||
+		!m.Timestamp.Equal(testTime.Truncate(time.Microsecond)) ||
+		m.Hostname != "host" || m.AppName != "app" || m.ProcID != "42" ||
+		m.MsgID != "M" || !reflect.DeepEqual(sd, m.SD) || m.Msg != "hi" {
+		t.Errorf("got %+v", m)
+	}
+}
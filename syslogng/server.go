@@ -0,0 +1,371 @@
+package syslogng
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrServerClosed = errors.New("syslogng: server closed")
+
+// SourceStats are counters of a message source: the remote host for IP
+// transports, the local address for unix sockets.
+type SourceStats struct {
+	Messages uint64
+	Bytes    uint64
+	Errors   uint64 // malformed messages and framing errors
+	LastSeen time.Time
+}
+
+// Server receives syslog messages, replacing a syslog-ng destination.
+//
+// Stream connections may use octet counting or LF framing, detected per
+// message. Messages of one connection or datagram socket are handled in
+// order, and reading stops until the handler returns, so a slow handler
+// pushes back to stream senders. Datagrams are dropped by the kernel
+// instead.
+type Server struct {
+	// Longer messages are truncated on datagram transports and close
+	// stream connections. 64KiB by default.
+	MaxMessageSize int
+
+	ln net.Listener
+	pc net.PacketConn
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	stats   map[string]*SourceStats
+	serving bool
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	now func() time.Time
+}
+
+// Listen binds a server to a unix, unixgram, udp or tcp address. Messages
+// are received once Serve or Messages is called.
+func Listen(network, addr string) (*Server, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		pc, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return newServer(nil, pc), nil
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return newServer(ln, nil), nil
+}
+
+// ListenTLS binds a server that accepts TLS connections on a tcp address.
+func ListenTLS(network, addr string, cfg *tls.Config) (*Server, error) {
+	ln, err := tls.Listen(network, addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newServer(ln, nil), nil
+}
+
+func newServer(ln net.Listener, pc net.PacketConn) *Server {
+	return &Server{
+		MaxMessageSize: 64 << 10,
+		ln:             ln,
+		pc:             pc,
+		conns:          make(map[net.Conn]struct{}),
+		stats:          make(map[string]*SourceStats),
+		done:           make(chan struct{}),
+		now:            time.Now,
+	}
+}
+
+func (this *Server) Addr() net.Addr {
+	if this.pc != nil {
+		return this.pc.LocalAddr()
+	}
+	return this.ln.Addr()
+}
+
+// Serve calls h for every message until Close, then returns
+// ErrServerClosed. h is called concurrently for different stream
+// connections.
+func (this *Server) Serve(h func(*Message)) error {
+	this.mu.Lock()
+	if this.closed {
+		this.mu.Unlock()
+		return ErrServerClosed
+	}
+	if this.serving {
+		this.mu.Unlock()
+		return errors.New("syslogng: server already serving")
+	}
+	this.serving = true
+	this.wg.Add(1)
+	this.mu.Unlock()
+	defer this.wg.Done()
+
+	if this.pc != nil {
+		return this.servePacket(h)
+	}
+
+	for {
+		conn, err := this.ln.Accept()
+		if err != nil {
+			if this.isClosed() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		if !this.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go this.serveConn(conn, h)
+	}
+}
+
+// Messages serves in the background and delivers messages on a channel
+// with the given buffer size, which is closed after Close. Senders are
+// pushed back while the channel is full.
+func (this *Server) Messages(size int) <-chan *Message {
+	ch := make(chan *Message, size)
+	go func() {
+		this.Serve(func(m *Message) {
+			select {
+			case ch <- m:
+			case <-this.done:
+			}
+		})
+
+		// Serve returns before connections are drained
+		this.wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+// Stats returns the counters of every source seen so far.
+func (this *Server) Stats() map[string]SourceStats {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	r := make(map[string]SourceStats, len(this.stats))
+	for src, st := range this.stats {
+		r[src] = *st
+	}
+	return r
+}
+
+// Close stops the server and closes all connections. It waits for
+// handlers in progress to return.
+func (this *Server) Close() error {
+	this.mu.Lock()
+	if this.closed {
+		this.mu.Unlock()
+		return nil
+	}
+	this.closed = true
+	close(this.done)
+
+	var err error
+	if this.pc != nil {
+		err = this.pc.Close()
+	} else {
+		err = this.ln.Close()
+	}
+	for conn := range this.conns {
+		conn.Close()
+	}
+	this.mu.Unlock()
+
+	this.wg.Wait()
+	return err
+}
+
+func (this *Server) isClosed() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.closed
+}
+
+func (this *Server) track(conn net.Conn) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return false
+	}
+	this.conns[conn] = struct{}{}
+	this.wg.Add(1)
+	return true
+}
+
+func (this *Server) untrack(conn net.Conn) {
+	this.mu.Lock()
+	delete(this.conns, conn)
+	this.mu.Unlock()
+	conn.Close()
+	this.wg.Done()
+}
+
+func sourceOf(local, remote net.Addr) string {
+	if remote == nil || remote.String() == "" || remote.String() == "@" {
+		return local.Network() + ":" + local.String()
+	}
+	if host, _, err := net.SplitHostPort(remote.String()); err == nil {
+		return host
+	}
+	return remote.String()
+}
+
+// deliver parses data and hands it to h. Malformed messages are delivered
+// raw as user.notice.
+func (this *Server) deliver(src string, data []byte, h func(*Message)) {
+	now := this.now()
+	m, err := Parse(data, now)
+
+	this.mu.Lock()
+	st := this.stats[src]
+	if st == nil {
+		st = &SourceStats{}
+		this.stats[src] = st
+	}
+	st.Messages++
+	st.Bytes += uint64(len(data))
+	st.LastSeen = now
+	if err != nil {
+		st.Errors++
+	}
+	this.mu.Unlock()
+
+	if err != nil {
+		m = &Message{
+			Format:   RFC3164,
+			Facility: FacilityUser,
+			Severity: SeverityNotice,
+			Msg:      string(bytes.TrimRight(data, "\r\n\x00")),
+		}
+	}
+	m.Source = src
+	m.Received = now
+	h(m)
+}
+
+func (this *Server) countError(src string) {
+	this.mu.Lock()
+	st := this.stats[src]
+	if st == nil {
+		st = &SourceStats{}
+		this.stats[src] = st
+	}
+	st.Errors++
+	st.LastSeen = this.now()
+	this.mu.Unlock()
+}
+
+func (this *Server) servePacket(h func(*Message)) error {
+	buf := make([]byte, this.MaxMessageSize)
+	for {
+		n, addr, err := this.pc.ReadFrom(buf)
+		if n > 0 {
+			this.deliver(sourceOf(this.pc.LocalAddr(), addr), buf[:n], h)
+		}
+		if err != nil {
+			if this.isClosed() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+	}
+}
+
+func (this *Server) serveConn(conn net.Conn, h func(*Message)) {
+	defer this.untrack(conn)
+
+	src := sourceOf(conn.LocalAddr(), conn.RemoteAddr())
+	r := bufio.NewReaderSize(conn, 4096)
+	for {
+		data, err := this.readFrame(r)
+		if len(data) > 0 {
+			this.deliver(src, data, h)
+		}
+		if err != nil {
+			if err != io.EOF && !this.isClosed() {
+				this.countError(src)
+			}
+			return
+		}
+	}
+}
+
+var errTooLong = errors.New("syslogng: message too long")
+
+// readFrame reads an octet counted frame if the next byte is a digit,
+// else a line (RFC 6587).
+func (this *Server) readFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == '\n' || c == '\r' || c == 0 {
+			// empty frame or trailer of the previous one
+			continue
+		}
+		r.UnreadByte()
+		if c < '0' || c > '9' {
+			break
+		}
+
+		size, err := r.ReadSlice(' ')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(string(size[:len(size)-1]))
+		if err != nil {
+			return nil, badMessage("bad frame length %q", size)
+		}
+		if n > this.MaxMessageSize {
+			return nil, errTooLong
+		}
+		data := make([]byte, n)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	var data []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		data = append(data, line...)
+		if len(data) > this.MaxMessageSize {
+			return nil, errTooLong
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(data) > 0 {
+			return data, nil
+		}
+		return data, err
+	}
+}
@@ -0,0 +1,202 @@
+package syslogng
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func recvMsg(t *testing.T, ch <-chan *Message) *Message {
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+		return nil
+	}
+}
+
+func TestServerTCP(t *testing.T) {
+	s, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ch := s.Messages(10)
+
+	w, err := Dial(WriterConfig{Network: "tcp", Addr: s.Addr().String(),
+		Hostname: "h", AppName: "app", ProcID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Send(SeverityWarning, "M1", []SDElement{{ID: "x@1", Params: []SDParam{{"k", "v"}}}}, "multi\nline")
+	m := recvMsg(t, ch)
+	if m.Format != RFC5424 || m.Severity != SeverityWarning || m.MsgID != "M1" ||
+		m.SD[0].Params[0].Value != "v" || m.Msg != "multi\nline" || m.Source != "127.0.0.1" {
+		t.Errorf("got %+v", m)
+	}
+
+	// LF framing and a malformed message on a raw connection
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(conn, "<13>Jan  2 09:00:00 host tag: one\n\n<13>1 bad\n")
+	conn.Close()
+
+	if m = recvMsg(t, ch); m.AppName != "tag" || m.Msg != "one" {
+		t.Errorf("got %+v", m)
+	}
+	if m = recvMsg(t, ch); m.Msg != "<13>1 bad" || m.Severity != SeverityNotice {
+		t.Errorf("got %+v", m)
+	}
+
+	st := s.Stats()["127.0.0.1"]
+	if st.Messages != 3 || st.Errors != 1 || st.LastSeen.IsZero() {
+		t.Errorf("got %+v", st)
+	}
+
+	s.Close()
+	if _, ok := <-ch; ok {
+		t.Error("channel should be closed")
+	}
+}
+
+func TestServerPacket(t *testing.T) {
+	for _, network := range []string{"udp", "unixgram"} {
+		addr := "127.0.0.1:0"
+		if network == "unixgram" {
+			addr = filepath.Join(t.TempDir(), "log.sock")
+		}
+
+		s, err := Listen(network, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch := s.Messages(10)
+
+		w, err := Dial(WriterConfig{Network: network, Addr: s.Addr().String(), Format: RFC3164,
+			Hostname: "h", AppName: "app", ProcID: "7"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Crit("datagram")
+		m := recvMsg(t, ch)
+		if m.Severity != SeverityCrit || m.Hostname != "h" || m.ProcID != "7" || m.Msg != "datagram" {
+			t.Errorf("%s: got %+v", network, m)
+		}
+		if len(s.Stats()) != 1 {
+			t.Errorf("%s: got %+v", network, s.Stats())
+		}
+
+		w.Close()
+		s.Close()
+	}
+}
+
+func TestServerUnixBackpressure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	s, err := Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	release := make(chan struct{})
+	got := make(chan string, 100)
+	go s.Serve(func(m *Message) {
+		<-release
+		got <- m.Msg
+	})
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	defer unblock()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the handler blocks, so socket buffers fill up and writes time out
+	msg := []byte("<14>1 - - - - - - " + strings.Repeat("x", 32<<10) + "\n")
+	var werr error
+	for i := 0; i < 1000 && werr == nil; i++ {
+		conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+		_, werr = conn.Write(msg)
+	}
+	if werr == nil {
+		t.Fatal("sender should be pushed back")
+	}
+
+	unblock()
+	if m := <-got; len(m) != 32<<10 {
+		t.Errorf("got %d bytes", len(m))
+	}
+
+	if _, ok := s.Stats()["unix:"+path]; !ok {
+		t.Errorf("got %+v", s.Stats())
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+	s, err := ListenTLS("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ch := s.Messages(1)
+
+	roots := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	roots.AddCert(leaf)
+
+	w, err := Dial(WriterConfig{Network: "tcp", Addr: s.Addr().String(),
+		TLSConfig: &tls.Config{RootCAs: roots}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Info("secure")
+	if m := recvMsg(t, ch); m.Msg != "secure" {
+		t.Errorf("got %+v", m)
+	}
+}
+
+func TestServerTooLong(t *testing.T) {
+	s, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.MaxMessageSize = 16
+	ch := s.Messages(1)
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "5 short100 too long for the server")
+
+	if m := recvMsg(t, ch); m.Msg != "short" {
+		t.Errorf("got %+v", m)
+	}
+	for i := 0; i < 100 && s.Stats()["127.0.0.1"].Errors == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := s.Stats()["127.0.0.1"]; st.Errors != 1 {
+		t.Errorf("got %+v", st)
+	}
+}
@@ -0,0 +1,418 @@
+package syslogng
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Facility int
+
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFtp
+	_
+	_
+	_
+	_
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+type Severity int
+
+const (
+	SeverityEmerg Severity = iota
+	SeverityAlert
+	SeverityCrit
+	SeverityErr
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+// Priority is the PRI part of a syslog message.
+func Priority(fac Facility, sev Severity) int {
+	return int(fac)<<3 | int(sev)
+}
+
+type Format int
+
+const (
+	// RFC5424 is the IETF syslog protocol.
+	RFC5424 Format = iota
+
+	// RFC3164 is the legacy BSD syslog protocol, structured data is dropped.
+	RFC3164
+)
+
+// Framing separates messages on stream transports.
+type Framing int
+
+const (
+	// FramingDefault is octet counting on TCP/TLS, LF elsewhere.
+	FramingDefault Framing = iota
+
+	// FramingOctetCounting prefixes each message with its length (RFC 6587).
+	FramingOctetCounting
+
+	// FramingLF terminates each message with a newline.
+	FramingLF
+)
+
+// SDElement is a structured data element of a RFC 5424 message.
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+var ErrWriterClosed = errors.New("syslogng: writer closed")
+
+type WriterConfig struct {
+	// Network is one of unix, unixgram, udp, tcp.
+	// TLS is used on tcp if TLSConfig is set.
+	Network string
+	Addr    string
+
+	TLSConfig *tls.Config
+
+	Format  Format
+	Framing Framing
+
+	// Facility of all messages. FacilityKern is reserved for the kernel,
+	// the zero value means FacilityUser.
+	Facility Facility
+
+	// Severity of messages written with Write, SeverityInfo if zero.
+	// Emergencies go through Emerg.
+	Severity Severity
+
+	// Defaults to os.Hostname, base name of os.Args[0] and the pid.
+	Hostname string
+	AppName  string
+	ProcID   string
+
+	// Defaults to 5s.
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// Writer sends syslog messages over a single connection, redialing once
+// per message when the connection fails. It is safe for concurrent use
+// and implements io.Writer so it can back log.New.
+type Writer struct {
+	cfg WriterConfig
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+
+	now func() time.Time
+}
+
+// Dial connects to a syslog server.
+func Dial(cfg WriterConfig) (*Writer, error) {
+	if cfg.Network == "" {
+		cfg.Network = "unix"
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = sockPath
+	}
+	if cfg.Facility == FacilityKern {
+		cfg.Facility = FacilityUser
+	}
+	if cfg.Severity == SeverityEmerg {
+		cfg.Severity = SeverityInfo
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = filepath.Base(os.Args[0])
+	}
+	if cfg.ProcID == "" {
+		cfg.ProcID = strconv.Itoa(os.Getpid())
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 5 * time.Second
+	}
+	if cfg.Framing == FramingDefault {
+		cfg.Framing = FramingLF
+		if cfg.Network == "tcp" || cfg.Network == "tcp4" || cfg.Network == "tcp6" {
+			cfg.Framing = FramingOctetCounting
+		}
+	}
+
+	w := &Writer{cfg: cfg, now: time.Now}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (this *Writer) connect() error {
+	d := &net.Dialer{Timeout: this.cfg.DialTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if this.cfg.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(d, this.cfg.Network, this.cfg.Addr, this.cfg.TLSConfig)
+	} else {
+		conn, err = d.Dial(this.cfg.Network, this.cfg.Addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	this.conn = conn
+	return nil
+}
+
+func (this *Writer) datagram() bool {
+	switch this.cfg.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+// Write sends p as one message with the configured facility and severity.
+// A trailing newline is removed.
+func (this *Writer) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	if err := this.Send(this.cfg.Severity, "", nil, msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Send sends a message with the configured facility. msgID and sd are only
+// used by RFC5424.
+func (this *Writer) Send(sev Severity, msgID string, sd []SDElement, msg string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return ErrWriterClosed
+	}
+
+	frame := this.frame(this.format(this.now(), sev, msgID, sd, msg))
+
+	if this.conn != nil {
+		if err := this.write(frame); err == nil {
+			return nil
+		}
+		this.conn.Close()
+		this.conn = nil
+	}
+
+	if err := this.connect(); err != nil {
+		return err
+	}
+	return this.write(frame)
+}
+
+func (this *Writer) write(frame []byte) error {
+	this.conn.SetWriteDeadline(time.Now().Add(this.cfg.WriteTimeout))
+	_, err := this.conn.Write(frame)
+	return err
+}
+
+func (this *Writer) Emerg(msg string) error {
+	return this.Send(SeverityEmerg, "", nil, msg)
+}
+
+func (this *Writer) Alert(msg string) error {
+	return this.Send(SeverityAlert, "", nil, msg)
+}
+
+func (this *Writer) Crit(msg string) error {
+	return this.Send(SeverityCrit, "", nil, msg)
+}
+
+func (this *Writer) Err(msg string) error {
+	return this.Send(SeverityErr, "", nil, msg)
+}
+
+func (this *Writer) Warning(msg string) error {
+	return this.Send(SeverityWarning, "", nil, msg)
+}
+
+func (this *Writer) Notice(msg string) error {
+	return this.Send(SeverityNotice, "", nil, msg)
+}
+
+func (this *Writer) Info(msg string) error {
+	return this.Send(SeverityInfo, "", nil, msg)
+}
+
+func (this *Writer) Debug(msg string) error {
+	return this.Send(SeverityDebug, "", nil, msg)
+}
+
+func (this *Writer) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+	if this.conn != nil {
+		return this.conn.Close()
+	}
+	return nil
+}
+
+func (this *Writer) frame(msg []byte) []byte {
+	if this.datagram() {
+		return msg
+	}
+
+	if this.cfg.Framing == FramingOctetCounting {
+		buf := strconv.AppendInt(make([]byte, 0, len(msg)+8), int64(len(msg)), 10)
+		buf = append(buf, ' ')
+		return append(buf, msg...)
+	}
+
+	// LF framing can't carry embedded newlines
+	msg = []byte(strings.Replace(string(msg), "\n", " ", -1))
+	return append(msg, '\n')
+}
+
+func (this *Writer) format(t time.Time, sev Severity, msgID string,
+	sd []SDElement, msg string) []byte {
+	pri := Priority(this.cfg.Facility, sev)
+
+	buf := make([]byte, 0, 128+len(msg))
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(pri), 10)
+	buf = append(buf, '>')
+
+	if this.cfg.Format == RFC3164 {
+		buf = t.AppendFormat(buf, time.Stamp)
+		buf = append(buf, ' ')
+		buf = append(buf, headerField(this.cfg.Hostname, 255)...)
+		buf = append(buf, ' ')
+		buf = append(buf, headerField(this.cfg.AppName, 32)...)
+		if this.cfg.ProcID != "" {
+			buf = append(buf, '[')
+			buf = append(buf, this.cfg.ProcID...)
+			buf = append(buf, ']')
+		}
+		buf = append(buf, ':', ' ')
+		return append(buf, msg...)
+	}
+
+	buf = append(buf, '1', ' ')
+	buf = t.AppendFormat(buf, rfc5424Time)
+	buf = append(buf, ' ')
+	buf = append(buf, headerField(this.cfg.Hostname, 255)...)
+	buf = append(buf, ' ')
+	buf = append(buf, headerField(this.cfg.AppName, 48)...)
+	buf = append(buf, ' ')
+	buf = append(buf, headerField(this.cfg.ProcID, 128)...)
+	buf = append(buf, ' ')
+	buf = append(buf, headerField(msgID, 32)...)
+	buf = append(buf, ' ')
+	buf = appendSD(buf, sd)
+	if msg != "" {
+		buf = append(buf, ' ')
+		buf = append(buf, msg...)
+	}
+	return buf
+}
+
+const rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+
+// headerField makes s a valid RFC 5424 header field: printable US-ASCII
+// without spaces, at most max bytes, or the nil value "-".
+func headerField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+
+	b := []byte(s)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+// sdName strips the characters not allowed in SD-ID and PARAM-NAME.
+func sdName(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < 32; i++ {
+		c := s[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			continue
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+func appendSD(buf []byte, sd []SDElement) []byte {
+	if len(sd) == 0 {
+		return append(buf, '-')
+	}
+
+	for _, e := range sd {
+		buf = append(buf, '[')
+		buf = append(buf, sdName(e.ID)...)
+		for _, p := range e.Params {
+			buf = append(buf, ' ')
+			buf = append(buf, sdName(p.Name)...)
+			buf = append(buf, '=', '"')
+			for i := 0; i < len(p.Value); i++ {
+				switch c := p.Value[i]; c {
+				case '"', '\\', ']':
+					buf = append(buf, '\\', c)
+				default:
+					buf = append(buf, c)
+				}
+			}
+			buf = append(buf, '"')
+		}
+		buf = append(buf, ']')
+	}
+	return buf
+}
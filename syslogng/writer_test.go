@@ -0,0 +1,331 @@
+package syslogng
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2016, 3, 7, 9, 5, 1, 123456789, time.UTC)
+
+func testWriter(cfg WriterConfig) *Writer {
+	cfg.Hostname, cfg.AppName, cfg.ProcID = "host", "app", "42"
+	w := &Writer{cfg: cfg, now: func() time.Time { return testTime }}
+	return w
+}
+
+func TestFormat5424(t *testing.T) {
+	w := testWriter(WriterConfig{Facility: FacilityLocal0})
+
+	got := string(w.format(testTime, SeverityErr, "ID47", []SDElement{
+		{ID: "exampleSDID@32473", Params: []SDParam{
+			{"iut", "3"}, {"eventSource", `App"lic]a\tion`},
+		}},
+		{ID: "origin"},
+	}, "hello"))
+	exp := `<131>1 2016-03-07T09:05:01.123456Z host app 42 ID47 ` +
+		`[exampleSDID@32473 iut="3" eventSource="App\"lic\]a\\tion"][origin] hello`
+	if got != exp {
+		t.Errorf("got %s", got)
+	}
+
+	w.cfg.ProcID = ""
+	w.cfg.Hostname = "my host"
+	got = string(w.format(testTime, SeverityInfo, "", nil, ""))
+	exp = `<134>1 2016-03-07T09:05:01.123456Z my_host app - - -`
+	if got != exp {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestFormat3164(t *testing.T) {
+	w := testWriter(WriterConfig{Format: RFC3164, Facility: FacilityDaemon})
+
+	got := string(w.format(testTime, SeverityWarning, "ID", []SDElement{{ID: "x"}}, "disk full"))
+	exp := `<28>Mar  7 09:05:01 host app[42]: disk full`
+	if got != exp {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestFraming(t *testing.T) {
+	w := testWriter(WriterConfig{Network: "tcp", Framing: FramingOctetCounting})
+	if got := string(w.frame([]byte("a\nb"))); got != "3 a\nb" {
+		t.Errorf("got %q", got)
+	}
+
+	w = testWriter(WriterConfig{Network: "unix", Framing: FramingLF})
+	if got := string(w.frame([]byte("a\nb"))); got != "a b\n" {
+		t.Errorf("got %q", got)
+	}
+
+	w = testWriter(WriterConfig{Network: "udp", Framing: FramingLF})
+	if got := string(w.frame([]byte("a\nb"))); got != "a\nb" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	size, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(size))
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(r, buf)
+	return string(buf), err
+}
+
+func TestWriterUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w, err := Dial(WriterConfig{Network: "udp", Addr: pc.LocalAddr().String(),
+		Hostname: "host", AppName: "app", ProcID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err = w.Notice("over udp"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<13>1 ") || !strings.HasSuffix(msg, " host app 1 - - over udp") {
+		t.Errorf("got %q", msg)
+	}
+}
+
+func TestWriterUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	pc, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w, err := Dial(WriterConfig{Network: "unixgram", Addr: path, Format: RFC3164,
+		Hostname: "host", AppName: "app", ProcID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Err("boom")
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<11>") ||
+		!strings.HasSuffix(msg, " host app[1]: boom") {
+		t.Errorf("got %q", msg)
+	}
+}
+
+func serveStream(t *testing.T, ln net.Listener, read func(*bufio.Reader) (string, error)) chan string {
+	ch := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					msg, err := read(r)
+					if err != nil {
+						return
+					}
+					ch <- msg
+				}
+			}()
+		}
+	}()
+	return ch
+}
+
+func recv(t *testing.T, ch chan string) string {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+		return ""
+	}
+}
+
+func TestWriterTCPLog(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ch := serveStream(t, ln, readOctetCounted)
+
+	w, err := Dial(WriterConfig{Network: "tcp", Addr: ln.Addr().String(),
+		Facility: FacilityLocal3, Severity: SeverityInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	logger := log.New(w, "", 0)
+	logger.Println("multi\nline")
+
+	if msg := recv(t, ch); !strings.HasPrefix(msg, "<158>1 ") || !strings.HasSuffix(msg, " - - multi\nline") {
+		t.Errorf("got %q", msg)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fmt.Fprintf(w, "msg %d", i)
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		msg := recv(t, ch)
+		seen[msg[strings.LastIndex(msg, " - - ")+5:]] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("got %v", seen)
+	}
+}
+
+func TestWriterUnixReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readLine := func(r *bufio.Reader) (string, error) {
+		line, err := r.ReadString('\n')
+		return strings.TrimSuffix(line, "\n"), err
+	}
+	ch := serveStream(t, ln, readLine)
+
+	w, err := Dial(WriterConfig{Network: "unix", Addr: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Info("one")
+	if msg := recv(t, ch); !strings.HasSuffix(msg, " - - one") {
+		t.Errorf("got %q", msg)
+	}
+
+	// server restarts and drops our connection
+	ln.Close()
+	w.mu.Lock()
+	w.conn.Close()
+	w.mu.Unlock()
+
+	ln, err = net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ch = serveStream(t, ln, readLine)
+
+	if err = w.Info("two"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := recv(t, ch); !strings.HasSuffix(msg, " - - two") {
+		t.Errorf("got %q", msg)
+	}
+
+	w.Close()
+	if err = w.Info("three"); err != ErrWriterClosed {
+		t.Error(err)
+	}
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestWriterTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ch := serveStream(t, ln, readOctetCounted)
+
+	roots := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	roots.AddCert(leaf)
+
+	w, err := Dial(WriterConfig{Network: "tcp", Addr: ln.Addr().String(),
+		TLSConfig: &tls.Config{RootCAs: roots}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err = w.Send(SeverityAlert, "TLS", []SDElement{{ID: "meta", Params: []SDParam{{"k", "v"}}}}, "secure"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := recv(t, ch); !strings.HasSuffix(msg, ` TLS [meta k="v"] secure`) {
+		t.Errorf("got %q", msg)
+	}
+}